@@ -5,12 +5,14 @@ import (
 	"github.com/GabrielCarpr/cqrs/auth"
 	"github.com/GabrielCarpr/cqrs/bus"
 	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/GabrielCarpr/cqrs/bus/queue/admin"
 	"github.com/GabrielCarpr/cqrs/bus/queue/sql"
 	"github.com/GabrielCarpr/cqrs/ports"
 	pgEventStore "github.com/GabrielCarpr/cqrs/eventstore/postgres"
 	"example/rest"
 	"example/users"
 	"context"
+	"io"
 	//"fmt"
 	"github.com/google/uuid"
 	"os/signal"
@@ -60,12 +62,13 @@ func Make(ctx context.Context) *App {
 	bus.RegisterContextKey(auth.AuthCtxKey, auth.Credentials{})
 	bus.RegisterContextKey(log.CtxIDKey, uuid.New())
 
-	app := App{Bus: b, ctx: ctx}
+	app := App{Bus: b, queue: queue, ctx: ctx}
 	return &app
 }
 
 type App struct {
 	Bus    *bus.Bus
+	queue *sql.SQLQueue
 	ctx context.Context
 }
 
@@ -85,6 +88,11 @@ func (a *App) Work() {
 	}
 }
 
+// DeadLetters inspects, replays or purges messages that failed on the queue
+func (a *App) DeadLetters(out io.Writer, args ...string) error {
+	return admin.DeadLetters(a.ctx, a.queue, out, args...)
+}
+
 func (a *App) Delete() {
 	a.Bus.Close()
 }
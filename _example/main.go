@@ -5,6 +5,7 @@ import (
 	"flag"
 	"log"
 	"context"
+	"os"
 )
 
 var mode string
@@ -27,6 +28,10 @@ func main() {
 	case "worker":
 		log.Print("Running worker")
 		app.Work()
+	case "deadletters":
+		if err := app.DeadLetters(os.Stdout, flag.Args()...); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	log.Print("Shutting down")
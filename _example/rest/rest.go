@@ -10,7 +10,6 @@ import (
     "example/internal/support"
     "github.com/gin-gonic/gin"
     "net/http"
-    cqrsErrs "github.com/GabrielCarpr/cqrs/errors"
     "encoding/json"
 )
 
@@ -22,6 +21,7 @@ func Rest(b *bus.Bus, config config.Config) *rest.Server {
         URL: config.AppURL,
         Development: config.Environment == "development",
     })
+    server.Statuses()
 
     server.Map("POST", "/rest/v1/auth/login", func (b *bus.Bus) gin.HandlerFunc {
         return func(c *gin.Context) {
@@ -38,14 +38,7 @@ func Rest(b *bus.Bus, config config.Config) *rest.Server {
                 c.JSON(http.StatusOK, result)
                 return
             }
-            switch err := err.(type) {
-            case cqrsErrs.Error:
-                c.JSON(err.Code, err)
-                return
-            default:
-                c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
-                return
-            }
+            server.Error(c, err)
         }
     })
 
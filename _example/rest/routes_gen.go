@@ -3,7 +3,6 @@ package rest
 import (
     "github.com/GabrielCarpr/cqrs/bus"
     adapter "github.com/GabrielCarpr/cqrs/ports/rest"
-    cqrsErrs "github.com/GabrielCarpr/cqrs/errors"
     "net/http"
     cbedaaff "example/internal/support"
     dcdfbaac "example/users/commands"
@@ -40,15 +39,11 @@ grp.Handle("POST", "/register", func(c *gin.Context) {
     }
     res, err := b.Dispatch(c.Request.Context(), cmd, true)
     if err != nil {
-        if err, ok := err.(cqrsErrs.Error); ok {
-            c.JSON(err.Code, err)
-            return
-        }
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
+        server.Error(c, err)
         return
     }
 
-    c.JSON(http.StatusOK, res)
+    server.Accepted(c, res)
 })
 }(grp)
 
@@ -72,14 +67,7 @@ grp.Handle("GET", "/:ID", func (c *gin.Context) {
         c.JSON(http.StatusOK,result)
         return
     }
-    switch err := err.(type) {
-    case cqrsErrs.Error:
-        c.JSON(err.Code, err)
-        return
-    default:
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
-        return
-    }
+    server.Error(c, err)
 })
 
             
@@ -94,14 +82,7 @@ grp.Handle("GET", "/", func (c *gin.Context) {
         c.JSON(http.StatusOK,result)
         return
     }
-    switch err := err.(type) {
-    case cqrsErrs.Error:
-        c.JSON(err.Code, err)
-        return
-    default:
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
-        return
-    }
+    server.Error(c, err)
 })
 
             
@@ -112,15 +93,11 @@ grp.Handle("PUT", "/:ID", func(c *gin.Context) {
     }
     res, err := b.Dispatch(c.Request.Context(), cmd, true)
     if err != nil {
-        if err, ok := err.(cqrsErrs.Error); ok {
-            c.JSON(err.Code, err)
-            return
-        }
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
+        server.Error(c, err)
         return
     }
 
-    c.JSON(http.StatusOK, res)
+    server.Accepted(c, res)
 })
 }(grp)
 
@@ -140,14 +117,7 @@ grp.Handle("GET", "/:ID", func (c *gin.Context) {
         c.JSON(http.StatusOK,roleAdapter{result})
         return
     }
-    switch err := err.(type) {
-    case cqrsErrs.Error:
-        c.JSON(err.Code, err)
-        return
-    default:
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
-        return
-    }
+    server.Error(c, err)
 })
 
             
@@ -162,14 +132,7 @@ grp.Handle("GET", "/", func (c *gin.Context) {
         c.JSON(http.StatusOK,rolesAdapter{result})
         return
     }
-    switch err := err.(type) {
-    case cqrsErrs.Error:
-        c.JSON(err.Code, err)
-        return
-    default:
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
-        return
-    }
+    server.Error(c, err)
 })
 
             
@@ -180,15 +143,11 @@ grp.Handle("PUT", "/:ID", func(c *gin.Context) {
     }
     res, err := b.Dispatch(c.Request.Context(), cmd, true)
     if err != nil {
-        if err, ok := err.(cqrsErrs.Error); ok {
-            c.JSON(err.Code, err)
-            return
-        }
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
+        server.Error(c, err)
         return
     }
 
-    c.JSON(http.StatusOK, res)
+    server.Accepted(c, res)
 })
 
             
@@ -199,15 +158,11 @@ grp.Handle("POST", "/", func(c *gin.Context) {
     }
     res, err := b.Dispatch(c.Request.Context(), cmd, true)
     if err != nil {
-        if err, ok := err.(cqrsErrs.Error); ok {
-            c.JSON(err.Code, err)
-            return
-        }
-        c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
+        server.Error(c, err)
         return
     }
 
-    c.JSON(http.StatusOK, res)
+    server.Accepted(c, res)
 })
 }(grp)
 }(grp)
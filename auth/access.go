@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/GabrielCarpr/cqrs/bus"
 	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/GabrielCarpr/cqrs/log"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/google/uuid"
@@ -22,6 +24,19 @@ var (
 	BlankCredentials = Credentials{}
 )
 
+func init() {
+	log.RegisterContextField("credentials_id", credentialsID)
+	bus.RegisterResultOwner(credentialsID)
+}
+
+// credentialsID returns the ID of the context's credentials, if they're valid
+func credentialsID(ctx context.Context) string {
+	if creds := GetCredentials(ctx); creds.Valid() {
+		return creds.ID.String()
+	}
+	return ""
+}
+
 type authCtxKeyType string
 
 func (k authCtxKeyType) String() string {
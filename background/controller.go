@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/GabrielCarpr/cqrs/bus"
 	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/metrics"
 	"log"
 	"time"
 
@@ -18,7 +19,8 @@ type queueAction = func(context.Context, bus.Command) error
 // NewController returns a new controller.
 func NewController(r *Repository) *Controller {
 	c := &Controller{
-		repo: r,
+		repo:    r,
+		metrics: metrics.Nop,
 	}
 	c.init()
 	return c
@@ -33,6 +35,7 @@ type Controller struct {
 
 	workerID uuid.UUID
 	actions  []func() error
+	metrics  metrics.Metrics
 }
 
 // RegisterQueueAction attaches the QA callback
@@ -40,6 +43,11 @@ func (c *Controller) RegisterQueueAction(qa queueAction) {
 	c.queueTask = qa
 }
 
+// RegisterMetrics records the number of the worker's jobs in each status with the metrics
+func (c *Controller) RegisterMetrics(m metrics.Metrics) {
+	c.metrics = m
+}
+
 // init configures the controller.
 func (c *Controller) init() {
 	if c.workerID == uuid.Nil {
@@ -127,6 +135,8 @@ func (c *Controller) manageExecutions() error {
 		return err
 	}
 
+	c.recordJobs(jobs)
+
 	for ind := range jobs {
 		err := c.advanceJob(&jobs[ind])
 		if err != nil {
@@ -136,6 +146,17 @@ func (c *Controller) manageExecutions() error {
 	return nil
 }
 
+// recordJobs records the number of jobs in each status
+func (c *Controller) recordJobs(jobs []Job) {
+	counts := map[ExecutionStatus]int{NONE: 0, WAITING: 0, PROCESSING: 0, COMPLETE: 0}
+	for _, j := range jobs {
+		counts[j.NextExecutionStatus()]++
+	}
+	for status, count := range counts {
+		c.metrics.Gauge(metrics.Jobs, float64(count), metrics.Labels{"status": string(status)})
+	}
+}
+
 // advanceJob moves a job to its next status, and handles side effects
 func (c *Controller) advanceJob(j *Job) error {
 	current := j.NextExecutionStatus()
@@ -218,7 +239,8 @@ var jobID backgroundCtxKey = "JobID"
 
 // JobFinishingMiddleware hooks into the bus's command execution
 // stack and allows it to report to the controller about the jobs execution status when it passes through.
-// Should be inserted ABOVE recovery middleware so that panics don't stop job status being reported
+// Should be inserted ABOVE bus.CommandRecoveryMiddleware so that panics don't stop job status being
+// reported. Service.Register uses it after bus.Default's middleware, so it wraps recovery
 func (c *Controller) JobFinishingMiddleware(next bus.CommandHandler) bus.CommandHandler {
 	return bus.CmdMiddlewareFunc(func(ctx context.Context, cmd bus.Command) (res bus.CommandResponse, msgs []message.Message) {
 		j := ctx.Value(jobID)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/GabrielCarpr/cqrs/bus"
 
@@ -86,6 +87,7 @@ func (s *Service) Register(b *bus.Bus) error {
 		return err
 	})
 	s.b.Use(s.Controller().JobFinishingMiddleware)
+	s.Controller().RegisterMetrics(b.Metrics())
 
 	return nil
 }
@@ -102,6 +104,15 @@ func (s *Service) RegisterJob(j Job) error {
 	return repo.Store(j)
 }
 
+var _ bus.Scheduler = (*Service)(nil)
+
+// Schedule registers a one time job, queuing the command at the given time
+func (s *Service) Schedule(ctx context.Context, at time.Time, cmd bus.Command) error {
+	job := NewJob(cmd.Command(), cmd)
+	job.StartAt = at
+	return s.RegisterJob(job)
+}
+
 func (s *Service) Close() error {
 	s.cancel()
 	s.ctn.Delete()
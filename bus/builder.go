@@ -17,6 +17,7 @@ func NewCommandContext() *CommandContext {
 // CommandContext is a context that command routes are built in
 type CommandContext struct {
 	middlewares []CommandMiddleware
+	topic       string
 	commands    commandRoutes
 	contexts    []*CommandContext
 }
@@ -29,6 +30,8 @@ func (c CommandContext) Route(cmd Command) (CommandRoute, bool) {
 			Command:    r.Command,
 			Handler:    r.Handler,
 			Middleware: c.middlewares,
+			Topic:      c.topic,
+			Retry:      r.Policy,
 		}, true
 	}
 
@@ -36,6 +39,9 @@ func (c CommandContext) Route(cmd Command) (CommandRoute, bool) {
 		r, ok := ctx.Route(cmd)
 		if ok {
 			r.Middleware = append(r.Middleware, c.middlewares...)
+			if r.Topic == "" {
+				r.Topic = c.topic
+			}
 			return r, true
 		}
 	}
@@ -88,6 +94,11 @@ func (c *CommandContext) Use(middlewares ...CommandMiddleware) {
 	c.middlewares = append(c.middlewares, middlewares...)
 }
 
+// Topic sets the queue topic of the context's commands, unless a nested context sets its own
+func (c *CommandContext) Topic(topic string) {
+	c.topic = topic
+}
+
 func (c *CommandContext) Group(fn func(CmdBuilder)) {
 	subContext := NewCommandContext()
 	fn(subContext)
@@ -165,6 +176,9 @@ type CmdBuilder interface {
 
 	Use(middlewares ...CommandMiddleware)
 
+	// Topic sets the queue topic that asynchronous commands are published to
+	Topic(topic string)
+
 	With(middlewares ...CommandMiddleware) CmdReceiver
 
 	Group(func(CmdBuilder))
@@ -173,10 +187,17 @@ type CmdBuilder interface {
 type commandRoutingRecord struct {
 	Command Command
 	Handler CommandHandler
+	Policy  *RetryPolicy
 }
 
-func (r *commandRoutingRecord) Handled(h CommandHandler) {
+func (r *commandRoutingRecord) Handled(h CommandHandler) retryRecord {
 	r.Handler = h
+	return r
+}
+
+// Retry sets the retry policy the queue uses when the command fails asynchronously
+func (r *commandRoutingRecord) Retry(p RetryPolicy) {
+	r.Policy = &p
 }
 
 type commandRoutes map[string]*commandRoutingRecord
@@ -185,12 +206,23 @@ type CommandRoute struct {
 	Command    Command
 	Middleware []CommandMiddleware
 	Handler    CommandHandler
+
+	// Topic is the queue topic the command is published to, if it has one
+	Topic string
+
+	// Retry is the command's retry policy, if it has one
+	Retry *RetryPolicy
 }
 
 type commandRouting map[string]CommandRoute
 
 type commandRecord interface {
-	Handled(CommandHandler)
+	Handled(CommandHandler) retryRecord
+}
+
+// retryRecord allows a route to declare how the queue retries it
+type retryRecord interface {
+	Retry(RetryPolicy)
 }
 
 /*
@@ -217,6 +249,8 @@ func (c QueryContext) Route(q Query) (QueryRoute, bool) {
 			Query:      r.Query,
 			Handler:    r.Handler,
 			Middleware: c.middlewares,
+			Remote:     r.HandledRemotely,
+			Topic:      r.Topic,
 		}, true
 	}
 
@@ -267,6 +301,8 @@ func (c *QueryContext) Query(q Query) queryRecord {
 		panic(fmt.Sprint("Cannot register command twice: ", q.Query()))
 	}
 	c.queries[q.Query()] = r
+	gob.Register(q)
+	gob.Register(&q)
 	return r
 }
 
@@ -303,7 +339,7 @@ func (c QueryContext) SelfTest() error {
 
 func (c QueryContext) detectHandlerlessQueries() error {
 	for _, r := range c.queries {
-		if r.Handler == nil {
+		if r.Handler == nil && !r.HandledRemotely {
 			return fmt.Errorf("Command %s has no handler", r.Query.Query())
 		}
 	}
@@ -357,22 +393,38 @@ type QueryBuilder interface {
 type queryRoutingRecord struct {
 	Query   Query
 	Handler QueryHandler
+	Topic   string
+
+	// HandledRemotely is whether the query's handler is in another process
+	HandledRemotely bool
 }
 
 func (r *queryRoutingRecord) Handled(h QueryHandler) {
 	r.Handler = h
 }
 
+// Remote routes the query to a handler in another process, which consumes the queue topic
+func (r *queryRoutingRecord) Remote(topic string) {
+	r.HandledRemotely = true
+	r.Topic = topic
+}
+
 type QueryRoutes map[string]*queryRoutingRecord
 
 type QueryRoute struct {
 	Query      Query
 	Middleware []QueryMiddleware
 	Handler    QueryHandler
+
+	// Remote is whether the query is handled by another process, over the queue,
+	// and Topic the queue topic it's published to
+	Remote bool
+	Topic  string
 }
 
 type queryRouting map[string]QueryRoute
 
 type queryRecord interface {
 	Handled(QueryHandler)
+	Remote(topic string)
 }
@@ -6,22 +6,32 @@ import (
 	"os"
 	"os/signal"
 	"reflect"
+	"time"
 
 	"github.com/GabrielCarpr/cqrs/bus/message"
 	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/GabrielCarpr/cqrs/metrics"
 	"github.com/GabrielCarpr/cqrs/ports"
 
 	"github.com/sarulabs/di/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var Instance *Bus
 
+// busSubscription is the name of the bus's event store subscription
+const busSubscription = "bus"
+
 // Default returns a bus with recommended middlewares
 func Default(ctx context.Context, mods []Module, configs ...Config) *Bus {
 	b := New(ctx, mods, configs...)
 	b.Use(
 		CommandValidationGuard,
 		QueryValidationGuard,
+		CommandRecoveryMiddleware,
+		QueryRecoveryMiddleware,
+		EventRecoveryMiddleware,
 		CommandLoggingMiddleware,
 		QueryLoggingMiddleware,
 		CommandErrorMiddleware,
@@ -37,23 +47,22 @@ func New(ctx context.Context, bcs []Module, configs ...Config) *Bus {
 		return Instance
 	}
 
-	builder, _ := di.NewBuilder()
-	for _, bc := range bcs {
-		for _, def := range bc.Services() {
-			builder.Add(def.diDef())
-		}
-	}
-	c := builder.Build()
 	RegisterMessage(QueuedEvent{})
+	RegisterMessage(QueuedQuery{})
+	RegisterMessage(QueryReply{})
 
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, os.Kill)
 	b := &Bus{
-		routes:    NewMessageRouter(),
-		container: c,
-		queue:     nil,
-		ctx:       ctx,
-		ctxCancel: cancel,
-		plugins:   make([]Plugin, 0),
+		routes:        NewMessageRouter(),
+		queue:         nil,
+		queueConsumer: newConsumer(Concurrency{}),
+		storeConsumer: newConsumer(Concurrency{}),
+		remote:        newRemoteQueries(),
+		tracer:        trace.NewNoopTracerProvider().Tracer(tracerName),
+		metrics:       metrics.Nop,
+		ctx:           ctx,
+		ctxCancel:     cancel,
+		plugins:       make([]Plugin, 0),
 	}
 
 	for _, conf := range configs {
@@ -62,12 +71,32 @@ func New(ctx context.Context, bcs []Module, configs ...Config) *Bus {
 			panic(err)
 		}
 	}
+	if err := b.configureQueue(); err != nil {
+		panic(err)
+	}
+	if b.tracerProvider != nil && b.eventStore != nil {
+		b.eventStore = TraceEventStore(b.eventStore, b.tracerProvider)
+	}
+
+	builder, _ := di.NewBuilder()
+	for _, def := range b.defs {
+		builder.Add(def.diDef())
+	}
+	for _, bc := range bcs {
+		for _, def := range bc.Services() {
+			builder.Add(def.diDef())
+		}
+	}
+	b.container = builder.Build()
 
 	for _, bc := range bcs {
 		b.routes.ExtendEvents(bc.Events)
 		b.routes.ExtendCommands(bc.Commands)
 		b.routes.ExtendQueries(bc.Queries)
 	}
+	if err := b.configureRemote(); err != nil {
+		panic(err)
+	}
 
 	b.Use(
 		b.queryContainerMiddleware,
@@ -87,6 +116,10 @@ type Bus struct {
 	container  di.Container
 	queue      Queue
 	eventStore EventStore
+	outbox     Outbox
+	results    ResultStore
+	inbox      Inbox
+	defs       []Def
 	ctx        context.Context
 	ctxCancel  context.CancelFunc
 
@@ -97,6 +130,16 @@ type Bus struct {
 	eventMiddleware   []EventMiddleware
 
 	plugins []Plugin
+
+	queueConsumer *consumer
+	storeConsumer *consumer
+
+	remote *remoteQueries
+
+	tracerProvider trace.TracerProvider
+	tracer         trace.Tracer
+
+	metrics metrics.Metrics
 }
 
 // Close deletes all the container resources.
@@ -114,19 +157,29 @@ func (b *Bus) Close() {
 }
 
 // Run runs the bus in subscribe mode, to be ran as on a worker
-// node, or in the background on an API server
+// node, or in the background on an API server. Its concurrency is configured
+// with UseQueueConcurrency and UseEventStoreConcurrency
 func (b *Bus) Run() error {
 	ps := ports.Ports{}
 	if b.queue != nil {
+		route := b.dedupe(b.routeFromQueue)
 		ps = ps.PortFunc(func(c context.Context) error {
-			b.queue.Subscribe(c, b.routeFromQueue)
+			b.queue.Subscribe(c, func(ctx context.Context, msg message.Message) error {
+				return b.queueConsumer.run(c, func() error {
+					return b.consume(ctx, msg, func(ctx context.Context) error {
+						return route(ctx, msg)
+					})
+				})
+			})
 			return nil
 		})
 	}
 	if b.eventStore != nil && b.queue != nil {
 		ps = ps.PortFunc(func(c context.Context) error {
-			return b.eventStore.Subscribe(c, func(e Event) error {
-				return b.publish(context.Background(), e)
+			return b.eventStore.Subscribe(c, busSubscription, func(e Event) error {
+				return b.storeConsumer.run(c, func() error {
+					return b.publish(context.Background(), e)
+				})
 			})
 		})
 	}
@@ -202,27 +255,52 @@ func (b *Bus) Use(ms ...interface{}) {
 	}
 }
 
+// routeFromQueue runs a queued message. Failures, including a command's error
+// response, are returned to the queue with the route's retry policy
 func (b *Bus) routeFromQueue(ctx context.Context, msg message.Message) error {
 	var err error
 	var msgs []message.Message
+	var policy *RetryPolicy
 	switch v := msg.(type) {
 	case Command:
-		_, err = b.Dispatch(ctx, v, true)
+		if route, ok := b.routes.RouteCommand(v); ok {
+			policy = route.Retry
+		}
+		var res *CommandResponse
+		res, err = b.dispatch(ctx, v, true)
+		if err == nil && res.Error != nil {
+			err = res.Error
+		}
+		b.storeResult(ctx, v, res, err)
 		break
 	case QueuedEvent:
+		if route, ok := b.routes.EventHandlerRoute(v.Event, b.container.Get(v.Handler).(EventHandler)); ok {
+			policy = route.retry
+		}
 		msgs, err = b.handleEvent(ctx, v, false)
 		break
+	case QueuedQuery:
+		err = b.answerQuery(ctx, v)
+		break
+	case QueryReply:
+		err = b.receiveReply(ctx, v)
+		break
 	}
 	if err != nil {
-		return err
+		return withRetryPolicy(err, policy)
 	}
 	err = b.route(ctx, msgs...)
 	if err != nil {
-		return err
+		return withRetryPolicy(err, policy)
 	}
 	return nil
 }
 
+// Route routes messages returned by a handler, such as those relayed from an outbox
+func (b *Bus) Route(ctx context.Context, messages ...message.Message) error {
+	return b.route(ctx, messages...)
+}
+
 // Routes a group of events. Will always favour async. Designed
 // to be used with the return of events and commands
 func (b *Bus) route(ctx context.Context, messages ...message.Message) error {
@@ -243,9 +321,22 @@ func (b *Bus) route(ctx context.Context, messages ...message.Message) error {
 	return nil
 }
 
-// Dispatch runs a command, either synchronously or asynchronously
+// Dispatch runs a command, either synchronously or asynchronously. The command is
+// given its own message ID, caused by the context's message
 func (b *Bus) Dispatch(ctx context.Context, cmd Command, sync bool) (*CommandResponse, error) {
-	ctx, cmd, err := b.runCmdGuards(ctx, cmd)
+	return b.dispatch(Caused(ctx), cmd, sync)
+}
+
+// dispatch runs a command that already has its message ID, such as a queued command
+func (b *Bus) dispatch(ctx context.Context, cmd Command, sync bool) (res *CommandResponse, err error) {
+	ctx, span := b.tracer.Start(ctx, "dispatch "+cmd.Command(), trace.WithAttributes(
+		attribute.String("cqrs.message_id", MessageID(ctx)),
+		attribute.Bool("cqrs.sync", sync),
+	))
+	defer func() { endSpan(span, err) }()
+	ctx = withMessageFields(ctx, "command", cmd.Command(), "")
+
+	ctx, cmd, err = b.runCmdGuards(ctx, cmd)
 	if err != nil {
 		return &CommandResponse{Error: err}, err
 	}
@@ -255,14 +346,32 @@ func (b *Bus) Dispatch(ctx context.Context, cmd Command, sync bool) (*CommandRes
 		return &CommandResponse{}, NoCommandHandler{cmd}
 	}
 	handlerName := CommandHandlerName(route.Handler)
+	ctx = log.With(ctx, log.F{"handler": handlerName})
 
 	if !sync {
-		log.Info(ctx, "Publishing command", log.F{"command": cmd.Command()})
-		err = b.queue.Publish(ctx, cmd)
-		return nil, err
-	}
-
-	handler := Get(ctx, handlerName).(CommandHandler)
+		return b.dispatchAsync(ctx, cmd, route)
+	}
+
+	// The handler's messages are routed, or stored in the outbox, within the middleware
+	// stack, so that middleware can observe failures such as concurrency violations
+	routingFailed := false
+	handler := b.traceCommandHandler(handlerName, b.measureCommandHandler(handlerName, Get(ctx, handlerName).(CommandHandler)))
+	handler = func(next CommandHandler) CommandHandler {
+		return CmdMiddlewareFunc(func(ctx context.Context, c Command) (CommandResponse, []message.Message) {
+			response, messages := next.Execute(ctx, c)
+			var err error
+			if b.outbox != nil {
+				err = b.storeOutbox(ctx, response, messages...)
+			} else {
+				err = b.route(ctx, messages...)
+			}
+			if err != nil {
+				routingFailed = true
+				response.Error = err
+			}
+			return response, nil
+		})
+	}(handler)
 	for _, mw := range b.commandMiddleware {
 		handler = mw(handler)
 	}
@@ -272,13 +381,45 @@ func (b *Bus) Dispatch(ctx context.Context, cmd Command, sync bool) (*CommandRes
 
 	log.Info(ctx, "Routed command", log.F{"command": cmd.Command(), "handler": handlerName})
 
-	response, messages := handler.Execute(ctx, cmd)
-	err = b.route(ctx, messages...)
+	response, _ := handler.Execute(ctx, cmd)
+	if routingFailed {
+		return &response, response.Error
+	}
+
+	return &response, nil
+}
+
+// dispatchAsync publishes a command to the queue, returning a response with its
+// ticket, which is its message ID. The pending result is stored first, so it can't
+// overwrite the worker's, and its owner is carried to the worker
+func (b *Bus) dispatchAsync(ctx context.Context, cmd Command, route CommandRoute) (*CommandResponse, error) {
+	ticket := MessageID(ctx)
+	ctx = context.WithValue(ctx, resultOwnerKey, ResultOwner(ctx))
+	if b.results != nil {
+		err := b.results.Store(ctx, CommandResult{Ticket: ticket, Command: cmd.Command(), Status: CommandPending, Owner: ResultOwner(ctx), UpdatedAt: time.Now()})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info(ctx, "Publishing command", log.F{"command": cmd.Command(), "ticket": ticket})
+	err := b.enqueue(WithTopic(ctx, route.Topic), cmd)
 	if err != nil {
+		b.storeResult(ctx, cmd, nil, err)
 		return nil, err
 	}
+	return &CommandResponse{Ticket: ticket}, nil
+}
 
-	return &response, nil
+// DispatchAt queues a command to run at a later time
+func (b *Bus) DispatchAt(ctx context.Context, cmd Command, at time.Time) error {
+	_, err := b.Dispatch(WithDeliverAt(ctx, at), cmd, false)
+	return err
+}
+
+// Schedule implements Scheduler with DispatchAt, so sagas can use the queue for timeouts
+func (b *Bus) Schedule(ctx context.Context, at time.Time, cmd Command) error {
+	return b.DispatchAt(ctx, cmd, at)
 }
 
 func (b *Bus) runCmdGuards(ctx context.Context, cmd Command) (context.Context, Command, error) {
@@ -292,11 +433,30 @@ func (b *Bus) runCmdGuards(ctx context.Context, cmd Command) (context.Context, C
 	return ctx, cmd, err
 }
 
-// Publish distributes one or more events to the system
+// Publish distributes one or more events to the system. When using an event store,
+// the expected version of the stream is derived from the first event
 func (b *Bus) Publish(ctx context.Context, events ...Event) error {
+	return b.PublishExpecting(ctx, ExpectedVersionOf(events...), events...)
+}
+
+// PublishExpecting distributes one or more events to the system, appending them to
+// the event store only if the stream is at the expected version. Events without
+// their own message ID are given one, caused by the context's message
+func (b *Bus) PublishExpecting(ctx context.Context, v ExpectedVersion, events ...Event) (err error) {
+	ctx, span := b.tracer.Start(ctx, "publish", trace.WithAttributes(attribute.Int("cqrs.events", len(events))))
+	defer func() { endSpan(span, err) }()
+
+	for _, event := range events {
+		stampEvent(ctx, event)
+		traceEvent(ctx, event)
+	}
+
 	if b.eventStore != nil {
-		log.Info(ctx, "publishing events to store", log.F{"count": fmt.Sprint(len(events))})
-		err := b.eventStore.Append(ctx, Any, events...)
+		log.Info(ctx, "publishing events to store", log.F{"count": fmt.Sprint(len(events)), "expected": fmt.Sprint(v)})
+		err := b.eventStore.Append(ctx, v, events...)
+		if err == ErrConcurrencyViolation {
+			return err
+		}
 		if err != nil {
 			return log.Error(ctx, "failed publishing events to event store", log.F{"err": err.Error()})
 		}
@@ -307,19 +467,30 @@ func (b *Bus) Publish(ctx context.Context, events ...Event) error {
 }
 
 func (b *Bus) publish(ctx context.Context, events ...Event) error {
-	var queueables []QueuedEvent
 	for _, event := range events {
-		log.Info(ctx, "fanning out event", log.F{"event": event.Event()})
-		route := b.routes.RouteEvent(event)
-		for _, handler := range route.handlers {
-			queueables = append(queueables, QueuedEvent{
-				Event:   route.event,
-				Handler: EventHandlerName(handler.handler),
-			})
+		if err := b.fanOut(ctx, event); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
-	for _, queueable := range queueables {
+// fanOut queues an event for each of its handlers, continuing the trace it was published in
+func (b *Bus) fanOut(ctx context.Context, event Event) (err error) {
+	stampEvent(ctx, event)
+	ctx = continueTrace(ctx, event.HasMetadata()[traceParentKey.String()])
+	ctx, span := b.tracer.Start(ctx, "fan out "+event.Event(), trace.WithAttributes(
+		attribute.String("cqrs.message_id", event.HasMetadata()[MessageIDKey.String()]),
+	))
+	defer func() { endSpan(span, err) }()
+
+	log.Info(ctx, "fanning out event", log.F{"event": event.Event()})
+	route := b.routes.RouteEvent(event)
+	for _, handler := range route.handlers {
+		queueable := QueuedEvent{
+			Event:   route.event,
+			Handler: EventHandlerName(handler.handler),
+		}
 		messages, err := b.handleEvent(ctx, queueable, true)
 		if err != nil {
 			return err
@@ -333,14 +504,19 @@ func (b *Bus) publish(ctx context.Context, events ...Event) error {
 	return nil
 }
 
-// Query routes and handles a query
-func (b *Bus) Query(ctx context.Context, query Query, result interface{}) error {
+// Query routes and handles a query. Queries routed with Remote are
+// published to the queue, and their result awaited
+func (b *Bus) Query(ctx context.Context, query Query, result interface{}) (err error) {
 	rv := reflect.ValueOf(result)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return ErrInvalidQueryResult
 	}
 
-	ctx, query, err := b.runQueryGuards(ctx, query)
+	ctx, span := b.tracer.Start(ctx, "query "+query.Query())
+	defer func() { endSpan(span, err) }()
+	ctx = withMessageFields(ctx, "query", query.Query(), "")
+
+	ctx, query, err = b.runQueryGuards(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -349,9 +525,13 @@ func (b *Bus) Query(ctx context.Context, query Query, result interface{}) error
 	if !exists {
 		return NoQueryHandler{query}
 	}
-	handlerName := QueryHandlerName(route.Handler)
 
-	handler := Get(ctx, handlerName).(QueryHandler)
+	var handler QueryHandler = remoteQueryHandler{b, route}
+	if !route.Remote {
+		name := QueryHandlerName(route.Handler)
+		ctx = log.With(ctx, log.F{"handler": name})
+		handler = b.traceQueryHandler(name, b.measureQueryHandler(name, Get(ctx, name).(QueryHandler)))
+	}
 
 	for _, mw := range b.queryMiddleware {
 		handler = mw(handler)
@@ -376,18 +556,20 @@ func (b *Bus) runQueryGuards(ctx context.Context, q Query) (context.Context, Que
 
 // handleEvent handles a queued event
 func (b *Bus) handleEvent(ctx context.Context, e QueuedEvent, async bool) ([]message.Message, error) {
+	ctx = withMessageFields(ctx, "event", e.Event.Event(), e.Handler)
 	handler := b.container.Get(e.Handler).(EventHandler)
-	if async {
-		log.Info(ctx, "queuing event", log.F{"event": e.Event.Event(), "handler": reflect.TypeOf(e.Handler).String()})
-		err := b.queue.Publish(ctx, e)
-		return []message.Message{}, err
-	}
-	log.Info(ctx, "handling event", log.F{"event": e.Event.Event(), "handler": reflect.TypeOf(handler).String()})
-
 	route, ok := b.routes.EventHandlerRoute(e.Event, handler)
 	if !ok {
 		return []message.Message{}, log.Error(ctx, "handler does not handler event", log.F{"event": e.Event.Event(), "handler": reflect.TypeOf(handler).String()})
 	}
+
+	if async {
+		log.Info(ctx, "queuing event", log.F{"event": e.Event.Event(), "handler": e.Handler})
+		err := b.enqueue(WithTopic(Caused(handlingContext(ctx, e.Event)), route.topic), e)
+		return []message.Message{}, err
+	}
+	log.Info(ctx, "handling event", log.F{"event": e.Event.Event(), "handler": reflect.TypeOf(handler).String()})
+	handler = b.traceEventHandler(e.Handler, b.measureEventHandler(e.Handler, handler))
 	for _, mw := range b.eventMiddleware {
 		handler = mw(handler)
 	}
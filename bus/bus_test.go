@@ -0,0 +1,298 @@
+package bus_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	inboxMemory "github.com/GabrielCarpr/cqrs/bus/inbox/memory"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/GabrielCarpr/cqrs/eventstore/memory"
+	"github.com/google/uuid"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/require"
+)
+
+type renameCmd struct {
+	bus.CommandType
+
+	Version int64
+}
+
+func (renameCmd) Command() string {
+	return "rename"
+}
+
+func (renameCmd) Valid() error {
+	return nil
+}
+
+type renameHandler struct {
+	owner uuid.UUID
+}
+
+func (h renameHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	buffer := bus.NewEventBuffer(h.owner, "renameable")
+	buffer.ForceVersion(c.(renameCmd).Version)
+	buffer.Buffer(true, &TestEvent{Payload: "renamed"})
+	return bus.CommandResponse{ID: h.owner.String()}, buffer.Messages(ctx)
+}
+
+func TestDispatchReportsConcurrencyViolationAsConflict(t *testing.T) {
+	handler := renameHandler{owner: uuid.New()}
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(handler)
+		},
+		Defs: []bus.Def{{
+			Name: handler,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return handler, nil
+			},
+		}},
+	}
+	b := bus.Default(context.Background(), []bus.Module{module}, bus.UseEventStore(&memory.MemoryEventStore{}))
+	defer b.Close()
+
+	res, err := b.Dispatch(context.Background(), renameCmd{Version: 0}, true)
+	require.NoError(t, err)
+	require.Equal(t, handler.owner.String(), res.ID)
+
+	res, err = b.Dispatch(context.Background(), renameCmd{Version: 0}, true)
+	require.Equal(t, errors.Conflict, err)
+	require.Equal(t, errors.Conflict, res.Error)
+
+	_, err = b.Dispatch(context.Background(), renameCmd{Version: 1}, true)
+	require.NoError(t, err)
+}
+
+type failingCmd struct {
+	bus.CommandType
+}
+
+func (failingCmd) Command() string {
+	return "failing"
+}
+
+func (failingCmd) Valid() error {
+	return nil
+}
+
+type failingHandler struct{}
+
+func (failingHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	bus.Get(ctx, bus.OutboxTxName)
+	return bus.CommandResponse{Error: errors.InternalServerError}, []message.Message{&TestEvent{Payload: "failed"}}
+}
+
+type outbox struct {
+	txs []*outboxTx
+}
+
+func (o *outbox) Begin(context.Context) (bus.OutboxTx, error) {
+	tx := &outboxTx{}
+	o.txs = append(o.txs, tx)
+	return tx, nil
+}
+
+type outboxTx struct {
+	stored     []message.Message
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *outboxTx) Store(ctx context.Context, msgs ...message.Message) error {
+	tx.stored = append(tx.stored, msgs...)
+	return nil
+}
+
+func (tx *outboxTx) Commit() error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *outboxTx) Rollback() error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+	return nil
+}
+
+func TestDispatchStoresMessagesInOutbox(t *testing.T) {
+	handler := renameHandler{owner: uuid.New()}
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(handler)
+			b.Command(failingCmd{}).Handled(failingHandler{})
+		},
+		Defs: []bus.Def{{
+			Name: handler,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return handler, nil
+			},
+		}, {
+			Name: failingHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return failingHandler{}, nil
+			},
+		}},
+	}
+	o := &outbox{}
+	store := &memory.MemoryEventStore{}
+	b := bus.Default(context.Background(), []bus.Module{module}, bus.UseEventStore(store), bus.UseOutbox(o))
+	defer b.Close()
+
+	_, err := b.Dispatch(context.Background(), renameCmd{Version: 0}, true)
+	require.NoError(t, err)
+	require.Len(t, o.txs, 1)
+	require.Len(t, o.txs[0].stored, 1)
+	require.True(t, o.txs[0].committed)
+	require.False(t, o.txs[0].rolledBack)
+
+	res, err := b.Dispatch(context.Background(), failingCmd{}, true)
+	require.NoError(t, err)
+	require.Equal(t, errors.InternalServerError, res.Error)
+	require.Len(t, o.txs, 2)
+	require.Empty(t, o.txs[1].stored)
+	require.True(t, o.txs[1].rolledBack)
+
+	events := make(chan bus.Event)
+	go store.Stream(context.Background(), events, bus.Select{})
+	for range events {
+		t.Fatal("events should be stored in the outbox, not published")
+	}
+}
+
+type countingHandler struct {
+	calls *int32
+}
+
+func (h countingHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	atomic.AddInt32(h.calls, 1)
+	return bus.CommandResponse{Error: errors.InternalServerError}, nil
+}
+
+// runBus runs the bus, returning a function that stops it and waits for it to close
+func runBus(b *bus.Bus, cancel context.CancelFunc) func() {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Run()
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestQueuedCommandsRetryWithRoutePolicy(t *testing.T) {
+	var renames int32
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(countingHandler{&renames}).Retry(bus.RetryPolicy{MaxAttempts: 3})
+		},
+		Defs: []bus.Def{{
+			Name: countingHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return countingHandler{&renames}, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{MaxRetries: 5, InitialInterval: time.Millisecond})
+	b := bus.Default(ctx, []bus.Module{module}, bus.UseQueue(queue))
+	defer runBus(b, cancel)()
+
+	_, err := b.Dispatch(context.Background(), renameCmd{}, false)
+	require.NoError(t, err)
+	require.NoError(t, queue.Wait(time.Second))
+	require.Equal(t, int32(3), atomic.LoadInt32(&renames))
+
+	count, err := queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{Name: "rename"})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestDispatchAtDelaysCommands(t *testing.T) {
+	var renames int32
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(countingHandler{&renames}).Retry(bus.NeverRetry)
+		},
+		Defs: []bus.Def{{
+			Name: countingHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return countingHandler{&renames}, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{module}, bus.UseQueue(queue))
+	defer runBus(b, cancel)()
+
+	at := time.Now().Add(time.Millisecond * 50)
+	require.NoError(t, b.DispatchAt(context.Background(), renameCmd{}, at))
+	require.Zero(t, atomic.LoadInt32(&renames))
+	require.NoError(t, queue.Wait(time.Second))
+	require.Equal(t, int32(1), atomic.LoadInt32(&renames))
+	require.False(t, time.Now().Before(at))
+}
+
+func TestRelaySkipsEventsAlreadyStored(t *testing.T) {
+	store := &memory.MemoryEventStore{}
+	b := bus.New(context.Background(), []bus.Module{}, bus.UseEventStore(store))
+	defer b.Close()
+
+	owner := uuid.New()
+	buffer := bus.NewEventBuffer(owner, "renameable")
+	buffer.Buffer(true, &TestEvent{Payload: "renamed"})
+	relayed := buffer.Messages(context.Background())[0]
+	require.NoError(t, b.Relay(context.Background(), relayed))
+	require.NoError(t, b.Relay(context.Background(), relayed))
+
+	conflicting := bus.NewEventBuffer(owner, "renameable")
+	conflicting.Buffer(true, &TestEvent{Payload: "renamed elsewhere"})
+	err := b.Relay(context.Background(), conflicting.Messages(context.Background())[0])
+	require.ErrorIs(t, err, bus.ErrConcurrencyViolation)
+}
+
+type succeedingHandler struct {
+	calls *int32
+}
+
+func (h succeedingHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	atomic.AddInt32(h.calls, 1)
+	return bus.CommandResponse{}, nil
+}
+
+func TestRelayedCommandsKeepTheirMessageID(t *testing.T) {
+	var renames int32
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(succeedingHandler{&renames})
+		},
+		Defs: []bus.Def{{
+			Name: succeedingHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return succeedingHandler{&renames}, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{module}, bus.UseQueue(queue), bus.UseInbox(&inboxMemory.MemoryInbox{}, time.Hour))
+	defer runBus(b, cancel)()
+
+	stored := bus.StampMessage(context.Background(), renameCmd{})
+	require.NotEmpty(t, bus.MessageID(stored))
+	require.NoError(t, b.Relay(stored, renameCmd{}))
+	require.NoError(t, queue.Wait(time.Second))
+	require.NoError(t, b.Relay(stored, renameCmd{}))
+	require.NoError(t, queue.Wait(time.Second))
+	require.Equal(t, int32(1), atomic.LoadInt32(&renames))
+}
@@ -40,10 +40,12 @@ func (c CommandType) Auth(ctx context.Context) [][]string {
 }
 
 // CommandResponse originates from a command when it is executed
-// synchronously. If async, then the response cannot be provided.
+// synchronously. If async, the response only has a ticket, which the
+// command's result can be awaited with when the bus has a result store
 type CommandResponse struct {
-	Error error `json:"error"`
-	ID    string
+	Error  error `json:"error"`
+	ID     string
+	Ticket string `json:",omitempty"`
 }
 
 // CommandHandler is a handler for a specific command.
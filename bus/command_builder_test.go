@@ -284,3 +284,40 @@ func TestSelfTestCommandNoHandler(t *testing.T) {
 	err := r.SelfTest()
 	require.Error(t, err)
 }
+
+func TestRouteCmdTopic(t *testing.T) {
+	r := bus.NewCommandContext()
+	func(b bus.CmdBuilder) {
+		b.Topic("default")
+		b.Command(routingCmd{}).Handled(routingCmdHandler{})
+		b.Group(func(b bus.CmdBuilder) {
+			b.Topic("slow")
+			b.Command(routingCmd2{}).Handled(routingCmdHandler{})
+		})
+	}(r)
+
+	c, ok := r.Route(routingCmd{})
+	require.True(t, ok)
+	assert.Equal(t, "default", c.Topic)
+
+	c, ok = r.Route(routingCmd2{})
+	require.True(t, ok)
+	assert.Equal(t, "slow", c.Topic)
+}
+
+func TestRouteCmdRetry(t *testing.T) {
+	r := bus.NewCommandContext()
+	func(b bus.CmdBuilder) {
+		b.Command(routingCmd{}).Handled(routingCmdHandler{}).Retry(bus.NeverRetry)
+		b.Command(routingCmd2{}).Handled(routingCmdHandler{})
+	}(r)
+
+	c, ok := r.Route(routingCmd{})
+	require.True(t, ok)
+	require.NotNil(t, c.Retry)
+	assert.Equal(t, 1, c.Retry.MaxAttempts)
+
+	c, ok = r.Route(routingCmd2{})
+	require.True(t, ok)
+	assert.Nil(t, c.Retry)
+}
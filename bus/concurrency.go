@@ -0,0 +1,156 @@
+package bus
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Concurrency configures how Run consumes messages
+type Concurrency struct {
+	// Workers is the number of messages processed in parallel.
+	// Zero leaves the consumer's own default
+	Workers int
+
+	// MaxInFlight limits the number of messages being handled at once. Workers wait
+	// for a free slot before handling a message, so a busy bus stops taking messages
+	// from the queue rather than buffering them. Zero is unlimited
+	MaxInFlight int
+
+	// Prefetch is the number of messages fetched ahead of the workers.
+	// Zero leaves the consumer's own default
+	Prefetch int
+}
+
+// ConcurrentQueue is implemented by queues whose consumers can be configured
+// by the bus, with UseQueueConcurrency
+type ConcurrentQueue interface {
+	Queue
+
+	// SetConcurrency sets the number of workers and prefetched messages, with zero
+	// leaving the queue's default. It's called before any messages are published
+	SetConcurrency(workers int, prefetch int)
+}
+
+// UseQueueConcurrency configures how Run consumes the queue. Setting workers
+// or prefetch requires a queue that implements ConcurrentQueue
+func UseQueueConcurrency(c Concurrency) Config {
+	return func(b *Bus) error {
+		b.queueConsumer = newConsumer(c)
+		return nil
+	}
+}
+
+// UseEventStoreConcurrency configures how Run consumes the event store's subscription.
+// The subscription's events are published to the queue one at a time and in order,
+// by a single subscriber, so only MaxInFlight can be set. Handling is parallelised
+// by the queue's workers instead
+func UseEventStoreConcurrency(c Concurrency) Config {
+	return func(b *Bus) error {
+		if c.Workers > 1 || c.Prefetch > 0 {
+			return ErrEventStoreConcurrency
+		}
+		b.storeConsumer = newConsumer(c)
+		return nil
+	}
+}
+
+// ConsumerStats describes a consumer's in-flight work
+type ConsumerStats struct {
+	Workers     int
+	MaxInFlight int
+
+	// InFlight is the number of messages being handled
+	InFlight int64
+
+	// Waiting is the number of messages waiting for an in-flight slot
+	Waiting int64
+
+	// Processed and Failed count the messages handled since the bus started
+	Processed uint64
+	Failed    uint64
+}
+
+// Stats describes the bus's in-flight work, for sizing its workers
+type Stats struct {
+	Queue      ConsumerStats
+	EventStore ConsumerStats
+}
+
+// Stats returns the bus's in-flight work
+func (b *Bus) Stats() Stats {
+	return Stats{
+		Queue:      b.queueConsumer.stats(),
+		EventStore: b.storeConsumer.stats(),
+	}
+}
+
+// configureQueue applies the queue's concurrency, if it has been configured
+func (b *Bus) configureQueue() error {
+	c := b.queueConsumer.config
+	if b.queue == nil || (c.Workers == 0 && c.Prefetch == 0) {
+		return nil
+	}
+	q, ok := b.queue.(ConcurrentQueue)
+	if !ok {
+		return ErrQueueConcurrency
+	}
+	q.SetConcurrency(c.Workers, c.Prefetch)
+	return nil
+}
+
+// consumer tracks, and limits, the messages being handled by a consumer
+type consumer struct {
+	// Counters are first, so they're aligned for atomic operations
+	inFlight  int64
+	waiting   int64
+	processed uint64
+	failed    uint64
+
+	config Concurrency
+	slots  chan struct{}
+}
+
+func newConsumer(c Concurrency) *consumer {
+	consumer := &consumer{config: c}
+	if c.MaxInFlight > 0 {
+		consumer.slots = make(chan struct{}, c.MaxInFlight)
+	}
+	return consumer
+}
+
+// run handles a message once an in-flight slot is free
+func (c *consumer) run(ctx context.Context, fn func() error) error {
+	if c.slots != nil {
+		atomic.AddInt64(&c.waiting, 1)
+		select {
+		case c.slots <- struct{}{}:
+			atomic.AddInt64(&c.waiting, -1)
+		case <-ctx.Done():
+			atomic.AddInt64(&c.waiting, -1)
+			return ctx.Err()
+		}
+		defer func() { <-c.slots }()
+	}
+
+	atomic.AddInt64(&c.inFlight, 1)
+	defer atomic.AddInt64(&c.inFlight, -1)
+
+	err := fn()
+	if err != nil {
+		atomic.AddUint64(&c.failed, 1)
+	} else {
+		atomic.AddUint64(&c.processed, 1)
+	}
+	return err
+}
+
+func (c *consumer) stats() ConsumerStats {
+	return ConsumerStats{
+		Workers:     c.config.Workers,
+		MaxInFlight: c.config.MaxInFlight,
+		InFlight:    atomic.LoadInt64(&c.inFlight),
+		Waiting:     atomic.LoadInt64(&c.waiting),
+		Processed:   atomic.LoadUint64(&c.processed),
+		Failed:      atomic.LoadUint64(&c.failed),
+	}
+}
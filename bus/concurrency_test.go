@@ -0,0 +1,95 @@
+package bus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingHandler struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h blockingHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	h.started <- struct{}{}
+	<-h.release
+	return bus.CommandResponse{}, nil
+}
+
+func TestQueueConcurrencyLimitsInFlight(t *testing.T) {
+	handler := blockingHandler{started: make(chan struct{}, 4), release: make(chan struct{})}
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(handler)
+		},
+		Defs: []bus.Def{{
+			Name: handler,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return handler, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{module}, bus.UseQueue(queue), bus.UseQueueConcurrency(bus.Concurrency{
+		Workers:     4,
+		MaxInFlight: 2,
+	}))
+	defer runBus(b, cancel)()
+
+	for i := 0; i < 4; i++ {
+		_, err := b.Dispatch(context.Background(), renameCmd{}, false)
+		require.NoError(t, err)
+	}
+	<-handler.started
+	<-handler.started
+
+	assert.Eventually(t, func() bool {
+		return b.Stats().Queue.Waiting == 2
+	}, time.Second, time.Millisecond*10)
+	stats := b.Stats().Queue
+	assert.Equal(t, int64(2), stats.InFlight)
+	assert.Equal(t, 4, stats.Workers)
+	assert.Equal(t, 2, stats.MaxInFlight)
+
+	close(handler.release)
+	require.NoError(t, queue.Wait(time.Second))
+	stats = b.Stats().Queue
+	assert.Zero(t, stats.InFlight)
+	assert.Zero(t, stats.Waiting)
+	assert.Equal(t, uint64(4), stats.Processed)
+}
+
+type plainQueue struct {
+	bus.Queue
+}
+
+func (plainQueue) Close() {}
+
+func TestQueueConcurrencyRequiresConcurrentQueue(t *testing.T) {
+	assert.PanicsWithValue(t, bus.ErrQueueConcurrency, func() {
+		bus.New(context.Background(), nil, bus.UseQueue(plainQueue{}), bus.UseQueueConcurrency(bus.Concurrency{Workers: 2}))
+	})
+
+	b := bus.New(context.Background(), nil, bus.UseQueue(plainQueue{}), bus.UseQueueConcurrency(bus.Concurrency{MaxInFlight: 2}))
+	defer b.Close()
+	assert.Equal(t, 2, b.Stats().Queue.MaxInFlight)
+}
+
+func TestEventStoreConcurrencyRejectsWorkers(t *testing.T) {
+	assert.PanicsWithValue(t, bus.ErrEventStoreConcurrency, func() {
+		bus.New(context.Background(), nil, bus.UseEventStoreConcurrency(bus.Concurrency{Workers: 2}))
+	})
+
+	b := bus.New(context.Background(), nil, bus.UseEventStoreConcurrency(bus.Concurrency{MaxInFlight: 2}))
+	defer b.Close()
+	assert.Equal(t, 2, b.Stats().EventStore.MaxInFlight)
+}
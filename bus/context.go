@@ -0,0 +1,172 @@
+package bus
+
+import (
+	"context"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/google/uuid"
+)
+
+type contextKey string
+
+func (k contextKey) String() string {
+	return string(k)
+}
+
+var (
+	// MessageIDKey is the context key of the ID of the message being handled. It is
+	// assigned when the message is dispatched or published, so is stable across redeliveries
+	MessageIDKey = contextKey("message_id")
+
+	// CorrelationIDKey is the context key of the ID shared by every message in a causal
+	// chain, which is the first message's ID unless set with WithCorrelationID. It's
+	// propagated to the metadata of events, and sagas are correlated by it by default
+	CorrelationIDKey = contextKey("correlation_id")
+
+	// CausationIDKey is the context key of the ID of the message that caused the
+	// message being handled. The first message in a chain is its own cause
+	CausationIDKey = contextKey("causation_id")
+
+	// topicKey is the context key of the queue topic a message is published to.
+	// It isn't serialized, as it only applies to one publish
+	topicKey = contextKey("topic")
+
+	// deliverAtKey is the context key of the time a message is delivered at.
+	// Like the topic, it only applies to one publish
+	deliverAtKey = contextKey("deliver_at")
+
+	// partitionKeyKey is the context key of a published message's partition key.
+	// Like the topic, it only applies to one publish
+	partitionKeyKey = contextKey("partition_key")
+)
+
+func init() {
+	for _, key := range []contextKey{MessageIDKey, CorrelationIDKey, CausationIDKey} {
+		RegisterContextKey(key, "")
+		log.RegisterContextKey(key)
+	}
+	RegisterContextKey(log.FieldsKey, log.F{})
+}
+
+// withMessageFields returns a context whose lines are logged with the name of the
+// message being handled, and its handler if it's known, replacing those of the
+// message that caused it. Other fields added with log.With are kept
+func withMessageFields(ctx context.Context, kind, name, handler string) context.Context {
+	fields := log.F{"command": "", "query": "", "event": "", "handler": handler}
+	fields[kind] = name
+	return log.With(ctx, fields)
+}
+
+// WithMessageID returns a context carrying a message ID
+func WithMessageID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, MessageIDKey, id)
+}
+
+// MessageID returns the context's message ID, or an empty string
+func MessageID(ctx context.Context) string {
+	id, _ := ctx.Value(MessageIDKey).(string)
+	return id
+}
+
+// WithCorrelationID returns a context carrying a correlation ID
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, CorrelationIDKey, id)
+}
+
+// CorrelationID returns the context's correlation ID, or an empty string
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(CorrelationIDKey).(string)
+	return id
+}
+
+// WithCausationID returns a context carrying a causation ID
+func WithCausationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, CausationIDKey, id)
+}
+
+// CausationID returns the context's causation ID, or an empty string
+func CausationID(ctx context.Context) string {
+	id, _ := ctx.Value(CausationIDKey).(string)
+	return id
+}
+
+// Caused returns a context for a new message, caused by the context's message.
+// The new message gets its own ID, and keeps the context's correlation ID, or
+// starts a new causal chain if the context has no message
+func Caused(ctx context.Context) context.Context {
+	id := uuid.New().String()
+	cause := MessageID(ctx)
+	if cause == "" {
+		cause = id
+	}
+	correlation := CorrelationID(ctx)
+	if correlation == "" {
+		correlation = id
+	}
+	ctx = WithMessageID(ctx, id)
+	ctx = WithCausationID(ctx, cause)
+	return WithCorrelationID(ctx, correlation)
+}
+
+// handlingContext returns a context for handling an event, carrying its IDs
+func handlingContext(ctx context.Context, e Event) context.Context {
+	m := e.HasMetadata()
+	for _, key := range []contextKey{MessageIDKey, CorrelationIDKey, CausationIDKey} {
+		if id := m[key.String()]; id != "" {
+			ctx = context.WithValue(ctx, key, id)
+		}
+	}
+	return ctx
+}
+
+// stampEvent gives an event its own message ID in its metadata, caused by the
+// context's message, unless it already has one. Events without a correlation
+// ID take the context's
+func stampEvent(ctx context.Context, e Event) {
+	m := e.HasMetadata()
+	if id := m[MessageIDKey.String()]; id != "" && id != MessageID(ctx) {
+		return
+	}
+
+	caused := Caused(ctx)
+	correlation := m[CorrelationIDKey.String()]
+	if correlation == "" {
+		correlation = CorrelationID(caused)
+	}
+	e.WithMetadata(Metadata{
+		MessageIDKey.String():     MessageID(caused),
+		CausationIDKey.String():   CausationID(caused),
+		CorrelationIDKey.String(): correlation,
+	})
+}
+
+// WithTopic returns a context publishing messages to a queue topic
+func WithTopic(ctx context.Context, topic string) context.Context {
+	return context.WithValue(ctx, topicKey, topic)
+}
+
+// Topic returns the queue topic of the message being published, from
+// its route, or an empty string
+func Topic(ctx context.Context) string {
+	topic, _ := ctx.Value(topicKey).(string)
+	return topic
+}
+
+// WithDeliverAt returns a context publishing messages to be delivered at a later time
+func WithDeliverAt(ctx context.Context, at time.Time) context.Context {
+	return context.WithValue(ctx, deliverAtKey, at)
+}
+
+// DeliverAt returns the time the message being published should be delivered at,
+// or the zero time if it should be delivered immediately
+func DeliverAt(ctx context.Context) time.Time {
+	at, _ := ctx.Value(deliverAtKey).(time.Time)
+	return at
+}
+
+// WithPartitionKey returns a context publishing messages with a partition key,
+// overriding the messages' own
+func WithPartitionKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, partitionKeyKey, key)
+}
@@ -0,0 +1,189 @@
+package bus_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/google/uuid"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCausedStartsAndContinuesChains(t *testing.T) {
+	first := bus.Caused(context.Background())
+	assert.NotEmpty(t, bus.MessageID(first))
+	assert.Equal(t, bus.MessageID(first), bus.CausationID(first))
+	assert.Equal(t, bus.MessageID(first), bus.CorrelationID(first))
+
+	second := bus.Caused(first)
+	assert.NotEqual(t, bus.MessageID(first), bus.MessageID(second))
+	assert.Equal(t, bus.MessageID(first), bus.CausationID(second))
+	assert.Equal(t, bus.MessageID(first), bus.CorrelationID(second))
+
+	correlated := bus.Caused(bus.WithCorrelationID(context.Background(), "order-1"))
+	assert.Equal(t, "order-1", bus.CorrelationID(correlated))
+}
+
+func TestBufferedEventsKeepTheirIDs(t *testing.T) {
+	ctx := bus.Caused(context.Background())
+	buffer := bus.NewEventBuffer(uuid.New(), "test")
+	buffer.Buffer(true, &TestEvent{Payload: "lol"}, &TestEvent{Payload: "lol"})
+
+	events := buffer.Events(ctx)
+	first := events[0].HasMetadata()
+	assert.NotEqual(t, bus.MessageID(ctx), first[bus.MessageIDKey.String()])
+	assert.NotEqual(t, first[bus.MessageIDKey.String()], events[1].HasMetadata()[bus.MessageIDKey.String()])
+	assert.Equal(t, bus.MessageID(ctx), first[bus.CausationIDKey.String()])
+	assert.Equal(t, bus.CorrelationID(ctx), first[bus.CorrelationIDKey.String()])
+
+	assert.Equal(t, first[bus.MessageIDKey.String()], buffer.Events(ctx)[0].HasMetadata()[bus.MessageIDKey.String()])
+}
+
+type followCmd struct {
+	bus.CommandType
+}
+
+func (followCmd) Command() string {
+	return "follow"
+}
+
+func (followCmd) Valid() error {
+	return nil
+}
+
+// chain records the context each message of a causal chain was handled with
+type chain struct {
+	mx       sync.Mutex
+	contexts map[string]context.Context
+	event    bus.Metadata
+}
+
+func (c *chain) record(name string, ctx context.Context) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.contexts[name] = ctx
+}
+
+func (c *chain) get(name string) context.Context {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.contexts[name]
+}
+
+type chainStartHandler struct{ *chain }
+
+func (h chainStartHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	h.record("start", ctx)
+	buffer := bus.NewEventBuffer(uuid.New(), "chain")
+	buffer.Buffer(true, &TestEvent{Payload: "started"})
+	return bus.CommandResponse{}, buffer.Messages(ctx)
+}
+
+type chainEventHandler struct{ *chain }
+
+func (h chainEventHandler) Handle(ctx context.Context, e bus.Event) ([]message.Message, error) {
+	h.mx.Lock()
+	h.event = e.HasMetadata()
+	h.mx.Unlock()
+	h.record("event", ctx)
+	return []message.Message{followCmd{}}, nil
+}
+
+type chainFollowHandler struct{ *chain }
+
+func (h chainFollowHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	h.record("follow", ctx)
+	return bus.CommandResponse{}, nil
+}
+
+// chainModule handles a rename command, its event, and the follow command the event causes
+func chainModule(c *chain) bus.Module {
+	return bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(chainStartHandler{})
+			b.Command(followCmd{}).Handled(chainFollowHandler{})
+		},
+		EventsFunc: func(b bus.EventBuilder) {
+			b.Event(&TestEvent{}).Handled(chainEventHandler{})
+		},
+		Defs: []bus.Def{{
+			Name: chainStartHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return chainStartHandler{c}, nil
+			},
+		}, {
+			Name: chainEventHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return chainEventHandler{c}, nil
+			},
+		}, {
+			Name: chainFollowHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return chainFollowHandler{c}, nil
+			},
+		}},
+	}
+}
+
+func TestMessagesCarryTheirCausalChain(t *testing.T) {
+	c := &chain{contexts: make(map[string]context.Context)}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{chainModule(c)}, bus.UseQueue(queue))
+	defer runBus(b, cancel)()
+
+	_, err := b.Dispatch(context.Background(), renameCmd{}, true)
+	require.NoError(t, err)
+	require.NoError(t, queue.Wait(time.Second))
+
+	start, event, follow := c.get("start"), c.get("event"), c.get("follow")
+	require.NotNil(t, start)
+	require.NotNil(t, event)
+	require.NotNil(t, follow)
+
+	root := bus.MessageID(start)
+	assert.NotEmpty(t, root)
+	eventID := c.event[bus.MessageIDKey.String()]
+	assert.Equal(t, root, c.event[bus.CausationIDKey.String()])
+	assert.Equal(t, eventID, bus.CausationID(event))
+	assert.Equal(t, bus.MessageID(event), bus.CausationID(follow))
+
+	for _, ctx := range []context.Context{start, event, follow} {
+		assert.Equal(t, root, bus.CorrelationID(ctx))
+	}
+}
+
+func TestMessagesCarryLogFields(t *testing.T) {
+	c := &chain{contexts: make(map[string]context.Context)}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{chainModule(c)}, bus.UseQueue(queue))
+	defer runBus(b, cancel)()
+
+	_, err := b.Dispatch(log.With(context.Background(), log.F{"user_id": "u1"}), renameCmd{}, true)
+	require.NoError(t, err)
+	require.NoError(t, queue.Wait(time.Second))
+
+	assert.Equal(t, log.F{
+		"user_id": "u1",
+		"command": "rename",
+		"handler": bus.CommandHandlerName(chainStartHandler{}),
+	}, log.Fields(c.get("start")))
+	assert.Equal(t, log.F{
+		"user_id": "u1",
+		"event":   "event.test",
+		"handler": bus.EventHandlerName(chainEventHandler{}),
+	}, log.Fields(c.get("event")))
+	assert.Equal(t, log.F{
+		"user_id": "u1",
+		"command": "follow",
+		"handler": bus.CommandHandlerName(chainFollowHandler{}),
+	}, log.Fields(c.get("follow")))
+}
@@ -0,0 +1,102 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+)
+
+// DeadLetter is a queued message that failed all of its retries
+type DeadLetter struct {
+	// ID is the message's ID, which it keeps when replayed
+	ID string
+
+	// Message is the failed message, or nil if it can't be deserialized
+	Message message.Message
+
+	// Payload is the serialized message, set when it can't be deserialized, so it
+	// can still be inspected, replayed once fixed, or purged
+	Payload []byte
+
+	// Reason is the error the message last failed with
+	Reason string
+
+	// Topic is the topic the message was originally published to
+	Topic string
+
+	// Metadata is the message's serialized context
+	Metadata SerializedContext
+
+	// PartitionKey is the key the message is ordered by, if it has one
+	PartitionKey string
+
+	FailedAt time.Time
+}
+
+// Name returns the command or event name of the dead letter's message
+func (d DeadLetter) Name() string {
+	return MessageName(d.Message)
+}
+
+// DeadLetterFilter selects dead letters. The zero value selects all of them
+type DeadLetterFilter struct {
+	// Topic selects dead letters originally published to a topic
+	Topic string
+
+	// Name selects dead letters by command or event name
+	Name string
+
+	// Limit limits the number of dead letters listed
+	Limit int
+}
+
+// Matches returns whether a dead letter is selected by the filter, ignoring the limit
+func (f DeadLetterFilter) Matches(d DeadLetter) bool {
+	if f.Topic != "" && f.Topic != d.Topic {
+		return false
+	}
+	if f.Name != "" && f.Name != d.Name() {
+		return false
+	}
+	return true
+}
+
+// DeadLetters is implemented by queues that keep messages which failed all of
+// their retries, allowing them to be inspected, replayed and purged
+type DeadLetters interface {
+	// DeadLetters lists dead letters, oldest first
+	DeadLetters(context.Context, DeadLetterFilter) ([]DeadLetter, error)
+
+	// CountDeadLetters counts dead letters
+	CountDeadLetters(context.Context, DeadLetterFilter) (int, error)
+
+	// Replay publishes a dead letter back onto its original topic, removing it
+	Replay(ctx context.Context, id string) error
+
+	// ReplayMatching replays each selected dead letter, returning the number replayed
+	ReplayMatching(context.Context, DeadLetterFilter) (int, error)
+
+	// PurgeDeadLetters deletes the selected dead letters, returning the number deleted
+	PurgeDeadLetters(context.Context, DeadLetterFilter) (int, error)
+}
+
+// ErrDeadLetterNotFound indicates a dead letter doesn't exist
+var ErrDeadLetterNotFound = errors.New("cqrs.bus: dead letter not found")
+
+// MessageName returns the name of a command, query or queued event
+func MessageName(msg message.Message) string {
+	switch v := msg.(type) {
+	case Command:
+		return v.Command()
+	case Query:
+		return v.Query()
+	case QueuedEvent:
+		return v.Event.Event()
+	case Event:
+		return v.Event()
+	default:
+		return ""
+	}
+}
@@ -9,6 +9,14 @@ var (
 	// ErrInvalidQueryResult indicates a programming error where the query result
 	// wasn't passed as a pointer to be filled
 	ErrInvalidQueryResult = errors.New("Query result must be a pointer")
+
+	// ErrQueueConcurrency indicates workers or prefetch were configured for a
+	// queue that doesn't implement ConcurrentQueue
+	ErrQueueConcurrency = errors.New("cqrs.bus: queue does not support configuring concurrency")
+
+	// ErrEventStoreConcurrency indicates workers or prefetch were configured for
+	// the event store's subscription, which is handled by a single subscriber
+	ErrEventStoreConcurrency = errors.New("cqrs.bus: event store subscription does not support workers or prefetch")
 )
 
 // NoCommandHandler is an error returned when a command's handler cannot be found
@@ -194,11 +194,20 @@ func (e *EventBuffer) Events(ctx context.Context) []Event {
 	return e.applyMetadata(ctx, e.events...)
 }
 
+// applyMetadata copies the context's values to the events' metadata, and gives each
+// event its own message ID, caused by the context's message. IDs are only given once,
+// so are stable however many times the events are read
 func (e *EventBuffer) applyMetadata(ctx context.Context, events ...Event) []Event {
 	result := make([]Event, len(events))
 	for i, ev := range events {
 		m := Metadata(SerializeContext(ctx))
+		delete(m, MessageIDKey.String())
+		delete(m, CausationIDKey.String())
+		if ev.HasMetadata()[CorrelationIDKey.String()] != "" {
+			delete(m, CorrelationIDKey.String())
+		}
 		ev.WithMetadata(m)
+		stampEvent(ctx, ev)
 		result[i] = ev
 	}
 	return result
@@ -236,7 +245,20 @@ func (e *EventBuffer) ForceVersion(v int64) {
 	e.Version = v
 }
 
+// NamedEventHandler is an event handler which names itself, for handlers
+// that share a type and can't be told apart by it, such as sagas
+type NamedEventHandler interface {
+	EventHandler
+
+	HandlerName() string
+}
+
+// EventHandlerName returns the name of the event handler, used for
+// routing and DI
 func EventHandlerName(h EventHandler) string {
+	if named, ok := h.(NamedEventHandler); ok {
+		return named.HandlerName()
+	}
 	t := reflect.TypeOf(h)
 	return fmt.Sprint(t.PkgPath(), ".", t.Name())
 }
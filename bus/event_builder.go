@@ -17,7 +17,7 @@ type eventBuilderEvent interface {
 }
 
 type eventBuilderHandled interface {
-	Handled(...EventHandler)
+	Handled(...EventHandler) retryRecord
 }
 
 type eventBuilderHandler interface {
@@ -25,11 +25,13 @@ type eventBuilderHandler interface {
 }
 
 type eventBuilderListener interface {
-	Listens(...Event)
+	Listens(...Event) retryRecord
 }
 
 type eventBuilderMiddleware interface {
 	Use(...EventMiddleware)
+	// Topic sets the queue topic that events are published to for these handlers
+	Topic(string)
 	With(...EventMiddleware) eventBuilderRouteStarter
 	Group(func(EventBuilder))
 }
@@ -53,6 +55,8 @@ func (e eventRoute) Merge(r eventRoute) eventRoute {
 type eventHandlerRoute struct {
 	handler    EventHandler
 	middleware []EventMiddleware
+	topic      string
+	retry      *RetryPolicy
 }
 
 var _ EventBuilder = (*eventContext)(nil)
@@ -65,6 +69,8 @@ type eventContext struct {
 	events     []Event
 	handlers   []EventHandler
 	middleware []EventMiddleware
+	topic      string
+	retry      *RetryPolicy
 
 	contexts []*eventContext
 }
@@ -76,6 +82,7 @@ func (c *eventContext) Route(e Event) eventRoute {
 		for _, handler := range c.handlers {
 			r.handlers = append(r.handlers, eventHandlerRoute{
 				handler: handler,
+				retry:   c.retry,
 			})
 		}
 	}
@@ -86,6 +93,9 @@ func (c *eventContext) Route(e Event) eventRoute {
 
 	for i := range r.handlers {
 		r.handlers[i].middleware = append(r.handlers[i].middleware, c.middleware...)
+		if r.handlers[i].topic == "" {
+			r.handlers[i].topic = c.topic
+		}
 	}
 
 	return r
@@ -158,18 +168,30 @@ func (e *eventContext) Handler(handlers ...EventHandler) eventBuilderListener {
 	return c
 }
 
-func (e *eventContext) Handled(handlers ...EventHandler) {
+func (e *eventContext) Handled(handlers ...EventHandler) retryRecord {
 	e.handlers = append(e.handlers, handlers...)
+	return e
 }
 
-func (e *eventContext) Listens(events ...Event) {
+func (e *eventContext) Listens(events ...Event) retryRecord {
 	e.events = append(e.events, events...)
+	return e
+}
+
+// Retry sets the retry policy the queue uses when the context's handlers fail
+func (e *eventContext) Retry(p RetryPolicy) {
+	e.retry = &p
 }
 
 func (e *eventContext) Use(mw ...EventMiddleware) {
 	e.middleware = append(e.middleware, mw...)
 }
 
+// Topic sets the queue topic of the context's handlers, unless a nested context sets its own
+func (e *eventContext) Topic(topic string) {
+	e.topic = topic
+}
+
 func (e *eventContext) With(mw ...EventMiddleware) eventBuilderRouteStarter {
 	c := new(eventContext)
 	c.middleware = mw
@@ -184,6 +184,38 @@ func (s *EventBuilderSuite) TestGroupMiddleware() {
 	s.Len(route.handlers[0].middleware, 4)
 }
 
+func (s *EventBuilderSuite) TestGroupTopic() {
+	s.b.Topic("events")
+	s.b.Event(&testEvent{}).Handled(testEventHandler{})
+	s.b.Group(func(b EventBuilder) {
+		b.Topic("slow")
+		b.Handler(otherTestEventHandler{}).Listens(&testEvent{})
+	})
+
+	route, ok := s.c.HandlerRoute(&testEvent{}, testEventHandler{})
+	s.Require().True(ok)
+	s.Equal("events", route.topic)
+
+	route, ok = s.c.HandlerRoute(&testEvent{}, otherTestEventHandler{})
+	s.Require().True(ok)
+	s.Equal("slow", route.topic)
+}
+
+func (s *EventBuilderSuite) TestRetry() {
+	s.b.Event(&testEvent{}).Handled(testEventHandler{}).Retry(NeverRetry)
+	s.b.Group(func(b EventBuilder) {
+		b.Handler(otherTestEventHandler{}).Listens(&testEvent{})
+	})
+
+	route, ok := s.c.HandlerRoute(&testEvent{}, testEventHandler{})
+	s.Require().True(ok)
+	s.Equal(&NeverRetry, route.retry)
+
+	route, ok = s.c.HandlerRoute(&testEvent{}, otherTestEventHandler{})
+	s.Require().True(ok)
+	s.Nil(route.retry)
+}
+
 func (s *EventBuilderSuite) TestMultiEventLevels() {
 	s.b.Event(&testEvent{}).Handled(testEventHandler{})
 	s.b.Group(func(b EventBuilder) {
@@ -158,3 +158,13 @@ func TestApplyCtxToEvent(t *testing.T) {
 	e := buffer.Events(ctx)[0].(*TestEvent)
 	require.Equal(t, "hi", e.Metadata["stringKey"])
 }
+
+func TestExpectedVersionOf(t *testing.T) {
+	buffer := bus.NewEventBuffer(uuid.New(), "test")
+	buffer.ForceVersion(4)
+	buffer.Buffer(true, &TestEvent{Payload: "lol"}, &TestEvent{Payload: "lol"})
+
+	require.Equal(t, bus.ExpectedVersion(4), bus.ExpectedVersionOf(buffer.Events(context.Background())...))
+	require.Equal(t, bus.Any, bus.ExpectedVersionOf(&TestEvent{}))
+	require.Equal(t, bus.Any, bus.ExpectedVersionOf())
+}
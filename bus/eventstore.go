@@ -2,18 +2,35 @@ package bus
 
 import (
 	"context"
+	"errors"
 )
 
 type ExpectedVersion int64
 
 var Any ExpectedVersion = -1
 
+var (
+	// ErrConcurrencyViolation indicates an optimistic locking failure
+	ErrConcurrencyViolation = errors.New("cqrs.eventstore: concurrency violation")
+)
+
+// ExpectedVersionOf derives the version a stream is expected to be at
+// from the first event about to be appended to it. Events that haven't
+// been versioned by an EventBuffer expect Any
+func ExpectedVersionOf(events ...Event) ExpectedVersion {
+	if len(events) == 0 || events[0].Versioned() == 0 {
+		return Any
+	}
+	return ExpectedVersion(events[0].Versioned() - 1)
+}
+
 type Stream = chan<- Event
 
 type EventStore interface {
 	Appendable
 	Streamable
 	Subscribable
+	Checkpointable
 
 	Close() error
 }
@@ -26,8 +43,20 @@ type Streamable interface {
 	Stream(context.Context, Stream, Select) error
 }
 
+// Subscribable allows named subscriptions to the event log. Each subscription
+// receives every event in order, at its own pace, and subscribers sharing a
+// name compete for its events
 type Subscribable interface {
-	Subscribe(context.Context, func(Event) error) error
+	Subscribe(ctx context.Context, name string, fn func(Event) error) error
+}
+
+// Checkpointable allows management of named subscriptions' checkpoints
+type Checkpointable interface {
+	// ResetSubscription moves a subscription back to the start of the event log
+	ResetSubscription(ctx context.Context, name string) error
+
+	// SubscriptionLag returns the number of events a subscription is behind the head of the log
+	SubscriptionLag(ctx context.Context, name string) (int64, error)
 }
 
 type Select struct {
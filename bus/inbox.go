@@ -0,0 +1,141 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/log"
+)
+
+// InboxClaimTimeout is how long a handler's claim on a message lasts. A message
+// whose handler stopped, such as when its process crashed, is handled again once
+// its claim expires, so handlers taking longer may handle a redelivery twice
+const InboxClaimTimeout = time.Minute * 5
+
+// ErrInboxClaimed indicates another delivery of a message is being handled
+var ErrInboxClaimed = errors.New("cqrs.bus: message is claimed by another delivery")
+
+// Inbox records the queued messages each handler has processed, so
+// that redelivered messages are only handled once
+type Inbox interface {
+	// Claim claims a message for a handler until a time, before it's handled. It
+	// returns false if the handler has already processed the message, and
+	// ErrInboxClaimed if another delivery's claim hasn't expired
+	Claim(ctx context.Context, id string, handler string, until time.Time) (bool, error)
+
+	// Record records that a handler has processed a message it claimed
+	Record(ctx context.Context, id string, handler string) error
+
+	// Release releases a claim on a message its handler failed, so it can be
+	// handled again
+	Release(ctx context.Context, id string, handler string) error
+
+	// Purge removes messages processed, and claims expired, before a time
+	Purge(ctx context.Context, before time.Time) error
+}
+
+// UseInbox skips queued messages that their handler has already processed.
+// Processed messages are remembered for the retention window, which should
+// outlast the queue's redeliveries
+func UseInbox(i Inbox, retention time.Duration) Config {
+	return func(b *Bus) error {
+		b.inbox = i
+		b.plugins = append(b.plugins, &purger{name: "inbox", purge: i.Purge, retention: retention})
+		return nil
+	}
+}
+
+// dedupe wraps a queue subscriber, skipping messages the inbox has already
+// recorded. Messages are claimed before they're handled, so concurrent deliveries
+// aren't both handled, and released if they fail, so they're redelivered. A
+// delivery of a message claimed by another fails, so it's retried once the other
+// is done
+func (b *Bus) dedupe(next func(context.Context, message.Message) error) func(context.Context, message.Message) error {
+	if b.inbox == nil {
+		return next
+	}
+
+	return func(ctx context.Context, msg message.Message) error {
+		id := MessageID(ctx)
+		handler, ok := b.queuedHandlerName(msg)
+		if id == "" || !ok {
+			return next(ctx, msg)
+		}
+
+		claimed, err := b.inbox.Claim(ctx, id, handler, time.Now().Add(InboxClaimTimeout))
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			log.Info(ctx, "skipping processed message", log.F{"id": id, "handler": handler})
+			return nil
+		}
+
+		err = next(ctx, msg)
+		if err != nil {
+			if releaseErr := b.inbox.Release(ctx, id, handler); releaseErr != nil {
+				log.Error(ctx, "failed releasing inbox claim", log.F{"id": id, "error": releaseErr.Error()})
+			}
+			return err
+		}
+
+		// The message was handled, so failing to record it only leaves its claim to expire
+		if err := b.inbox.Record(ctx, id, handler); err != nil {
+			log.Error(ctx, "failed recording processed message", log.F{"id": id, "error": err.Error()})
+		}
+		return nil
+	}
+}
+
+// queuedHandlerName returns the name of the handler a queued message is for
+func (b *Bus) queuedHandlerName(msg message.Message) (string, bool) {
+	switch v := msg.(type) {
+	case Command:
+		route, ok := b.routes.RouteCommand(v)
+		if !ok {
+			return "", false
+		}
+		return CommandHandlerName(route.Handler), true
+	case QueuedEvent:
+		return v.Handler, true
+	default:
+		return "", false
+	}
+}
+
+var _ Plugin = (*purger)(nil)
+
+// purger periodically purges records older than the retention window
+type purger struct {
+	name      string
+	purge     func(ctx context.Context, before time.Time) error
+	retention time.Duration
+}
+
+func (p *purger) Register(*Bus) error {
+	return nil
+}
+
+func (p *purger) Close() error {
+	return nil
+}
+
+func (p *purger) Run(ctx context.Context) error {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		err := p.purge(ctx, time.Now().Add(-p.retention))
+		if err != nil {
+			log.Error(ctx, "failed purging "+p.name, log.F{"error": err.Error()})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// +build !unit
+
+package inbox_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/inbox/memory"
+	"github.com/GabrielCarpr/cqrs/bus/inbox/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+var TestConfig = sql.Config{
+	DBName: "cqrs",
+	DBHost: "db",
+	DBUser: "cqrs",
+	DBPass: "cqrs",
+}
+
+func TestMemoryInbox(t *testing.T) {
+	suite.Run(t, &InboxBlackboxTest{factory: func() bus.Inbox {
+		return &memory.MemoryInbox{}
+	}})
+}
+
+func TestSQLInbox(t *testing.T) {
+	suite.Run(t, &InboxBlackboxTest{
+		factory: func() bus.Inbox {
+			return sql.NewSQLInbox(TestConfig)
+		},
+		setupHook: func() {
+			sql.ResetSQLDB(TestConfig.DBDsn())
+		},
+	})
+}
+
+type InboxBlackboxTest struct {
+	suite.Suite
+
+	factory   func() bus.Inbox
+	setupHook func()
+
+	inbox bus.Inbox
+	id    string
+}
+
+func (s *InboxBlackboxTest) SetupTest() {
+	s.inbox = s.factory()
+	if s.setupHook != nil {
+		s.setupHook()
+	}
+	s.id = uuid.New().String()
+}
+
+func (s *InboxBlackboxTest) TestRecordsProcessedMessages() {
+	until := time.Now().Add(time.Minute)
+	claimed, err := s.inbox.Claim(context.Background(), s.id, "handler", until)
+	s.Require().NoError(err)
+	s.True(claimed)
+
+	s.Require().NoError(s.inbox.Record(context.Background(), s.id, "handler"))
+	s.Require().NoError(s.inbox.Record(context.Background(), s.id, "handler"))
+
+	claimed, err = s.inbox.Claim(context.Background(), s.id, "handler", until)
+	s.Require().NoError(err)
+	s.False(claimed)
+
+	claimed, err = s.inbox.Claim(context.Background(), s.id, "other", until)
+	s.Require().NoError(err)
+	s.True(claimed)
+}
+
+func (s *InboxBlackboxTest) TestClaimsOnce() {
+	until := time.Now().Add(time.Minute)
+	results := make(chan error, 10)
+	claims := int32(0)
+	for i := 0; i < 10; i++ {
+		go func() {
+			claimed, err := s.inbox.Claim(context.Background(), s.id, "handler", until)
+			if claimed {
+				atomic.AddInt32(&claims, 1)
+			}
+			results <- err
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		err := <-results
+		if err != nil {
+			s.ErrorIs(err, bus.ErrInboxClaimed)
+		}
+	}
+	s.Equal(int32(1), claims)
+}
+
+func (s *InboxBlackboxTest) TestReleasesAndExpiresClaims() {
+	claimed, err := s.inbox.Claim(context.Background(), s.id, "handler", time.Now().Add(time.Minute))
+	s.Require().NoError(err)
+	s.Require().True(claimed)
+	s.Require().NoError(s.inbox.Release(context.Background(), s.id, "handler"))
+
+	claimed, err = s.inbox.Claim(context.Background(), s.id, "handler", time.Now().Add(-time.Second))
+	s.Require().NoError(err)
+	s.Require().True(claimed)
+
+	claimed, err = s.inbox.Claim(context.Background(), s.id, "handler", time.Now().Add(time.Minute))
+	s.Require().NoError(err)
+	s.True(claimed, "an expired claim can be taken over")
+}
+
+func (s *InboxBlackboxTest) TestPurgesOldMessages() {
+	s.Require().NoError(s.inbox.Record(context.Background(), s.id, "handler"))
+
+	s.Require().NoError(s.inbox.Purge(context.Background(), time.Now().Add(-time.Hour)))
+	claimed, err := s.inbox.Claim(context.Background(), s.id, "handler", time.Now().Add(time.Minute))
+	s.Require().NoError(err)
+	s.False(claimed)
+
+	s.Require().NoError(s.inbox.Purge(context.Background(), time.Now().Add(time.Second)))
+	claimed, err = s.inbox.Claim(context.Background(), s.id, "handler", time.Now().Add(time.Minute))
+	s.Require().NoError(err)
+	s.True(claimed)
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+)
+
+var _ bus.Inbox = (*MemoryInbox)(nil)
+
+type inboxKey struct {
+	id      string
+	handler string
+}
+
+// inboxEntry is a handler's claim on a message, until at, or once it's
+// processed, the time it was processed at
+type inboxEntry struct {
+	at        time.Time
+	processed bool
+}
+
+// MemoryInbox records processed messages in memory
+type MemoryInbox struct {
+	entries map[inboxKey]inboxEntry
+
+	mx sync.Mutex
+}
+
+func (i *MemoryInbox) Claim(ctx context.Context, id string, handler string, until time.Time) (bool, error) {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	if i.entries == nil {
+		i.entries = make(map[inboxKey]inboxEntry)
+	}
+	key := inboxKey{id, handler}
+	entry, ok := i.entries[key]
+	if ok && entry.processed {
+		return false, nil
+	}
+	if ok && entry.at.After(time.Now()) {
+		return false, bus.ErrInboxClaimed
+	}
+	i.entries[key] = inboxEntry{at: until}
+	return true, nil
+}
+
+func (i *MemoryInbox) Record(ctx context.Context, id string, handler string) error {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	if i.entries == nil {
+		i.entries = make(map[inboxKey]inboxEntry)
+	}
+	i.entries[inboxKey{id, handler}] = inboxEntry{at: time.Now(), processed: true}
+	return nil
+}
+
+func (i *MemoryInbox) Release(ctx context.Context, id string, handler string) error {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	key := inboxKey{id, handler}
+	if entry, ok := i.entries[key]; ok && !entry.processed {
+		delete(i.entries, key)
+	}
+	return nil
+}
+
+func (i *MemoryInbox) Purge(ctx context.Context, before time.Time) error {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	for key, entry := range i.entries {
+		if entry.at.Before(before) {
+			delete(i.entries, key)
+		}
+	}
+	return nil
+}
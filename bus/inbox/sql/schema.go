@@ -0,0 +1,49 @@
+package sql
+
+import (
+	stdSQL "database/sql"
+	"log"
+	"strings"
+)
+
+// PostgreSQLSchema creates the inbox table of claimed and processed messages
+type PostgreSQLSchema struct {
+	Config Config
+}
+
+func (s PostgreSQLSchema) Make() error {
+	log.Print("Creating inbox")
+	db, err := stdSQL.Open("postgres", s.Config.DBDsn())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS inbox (
+		"message_id" VARCHAR(36) NOT NULL,
+		"handler" VARCHAR(255) NOT NULL,
+		"processed_at" TIMESTAMP,
+		PRIMARY KEY ("message_id", "handler")
+	);
+	ALTER TABLE inbox ADD COLUMN IF NOT EXISTS "claimed_until" TIMESTAMP;
+	ALTER TABLE inbox ALTER COLUMN "processed_at" DROP NOT NULL;`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS inbox_processed_at ON inbox ("processed_at")`)
+	return err
+}
+
+func ResetSQLDB(dsn string) {
+	log.Print("Resetting inbox")
+	db, err := stdSQL.Open("postgres", dsn)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM inbox")
+	if err != nil && !strings.Contains(err.Error(), "does not exist") {
+		panic(err)
+	}
+}
@@ -0,0 +1,91 @@
+package sql
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+
+	_ "github.com/lib/pq"
+)
+
+func makeDB(c Config) *stdSQL.DB {
+	db, err := stdSQL.Open("postgres", c.DBDsn())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+var _ bus.Inbox = (*SQLInbox)(nil)
+
+// NewSQLInbox returns an inbox, creating its table if required
+func NewSQLInbox(c Config) *SQLInbox {
+	db := makeDB(c)
+	schema := PostgreSQLSchema{c}
+	err := schema.Make()
+	if err != nil {
+		panic(err)
+	}
+	return &SQLInbox{db: db}
+}
+
+// SQLInbox records processed messages in PostgreSQL
+type SQLInbox struct {
+	db *stdSQL.DB
+}
+
+func (i *SQLInbox) Close() error {
+	return i.db.Close()
+}
+
+// Claim inserts the handler's claim on the message, or takes over an expired one,
+// so concurrent deliveries can't both claim it
+func (i *SQLInbox) Claim(ctx context.Context, id string, handler string, until time.Time) (bool, error) {
+	res, err := i.db.ExecContext(ctx, `INSERT INTO inbox (message_id, handler, claimed_until)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, handler) DO UPDATE SET claimed_until = EXCLUDED.claimed_until
+		WHERE inbox.processed_at IS NULL AND inbox.claimed_until < $4`, id, handler, until, time.Now())
+	if err != nil {
+		return false, err
+	}
+	claimed, err := res.RowsAffected()
+	if err != nil || claimed == 1 {
+		return claimed == 1, err
+	}
+
+	var processed bool
+	row := i.db.QueryRowContext(ctx, `SELECT processed_at IS NOT NULL FROM inbox
+		WHERE message_id = $1 AND handler = $2`, id, handler)
+	err = row.Scan(&processed)
+	if err == stdSQL.ErrNoRows || (err == nil && !processed) {
+		return false, bus.ErrInboxClaimed
+	}
+	return false, err
+}
+
+func (i *SQLInbox) Record(ctx context.Context, id string, handler string) error {
+	_, err := i.db.ExecContext(ctx, `INSERT INTO inbox (message_id, handler, processed_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, handler) DO UPDATE SET processed_at = EXCLUDED.processed_at`, id, handler, time.Now())
+	return err
+}
+
+func (i *SQLInbox) Release(ctx context.Context, id string, handler string) error {
+	_, err := i.db.ExecContext(ctx, `DELETE FROM inbox
+		WHERE message_id = $1 AND handler = $2 AND processed_at IS NULL`, id, handler)
+	return err
+}
+
+func (i *SQLInbox) Purge(ctx context.Context, before time.Time) error {
+	_, err := i.db.ExecContext(ctx, `DELETE FROM inbox
+		WHERE processed_at < $1 OR (processed_at IS NULL AND claimed_until < $1)`, before)
+	return err
+}
@@ -0,0 +1,148 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/stretchr/testify/suite"
+)
+
+// inbox is a minimal Inbox, as the memory inbox's package imports bus
+type inbox struct {
+	mx        sync.Mutex
+	claimed   map[string]bool
+	processed map[string]time.Time
+}
+
+func (i *inbox) Claim(ctx context.Context, id string, handler string, until time.Time) (bool, error) {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	if _, ok := i.processed[id+handler]; ok {
+		return false, nil
+	}
+	if i.claimed[id+handler] {
+		return false, ErrInboxClaimed
+	}
+	i.claimed[id+handler] = true
+	return true, nil
+}
+
+func (i *inbox) Record(ctx context.Context, id string, handler string) error {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	delete(i.claimed, id+handler)
+	i.processed[id+handler] = time.Now()
+	return nil
+}
+
+func (i *inbox) Release(ctx context.Context, id string, handler string) error {
+	i.mx.Lock()
+	defer i.mx.Unlock()
+
+	delete(i.claimed, id+handler)
+	return nil
+}
+
+func (i *inbox) Purge(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+func TestInbox(t *testing.T) {
+	suite.Run(t, new(InboxTest))
+}
+
+type InboxTest struct {
+	suite.Suite
+
+	bus     *Bus
+	mx      sync.Mutex
+	handled []message.Message
+	err     error
+	block   chan struct{}
+	handle  func(context.Context, message.Message) error
+}
+
+func (s *InboxTest) SetupTest() {
+	s.bus = &Bus{routes: NewMessageRouter(), inbox: &inbox{claimed: make(map[string]bool), processed: make(map[string]time.Time)}}
+	s.handled = nil
+	s.err = nil
+	s.block = nil
+	s.handle = s.bus.dedupe(func(ctx context.Context, msg message.Message) error {
+		if s.block != nil {
+			<-s.block
+		}
+		if s.err != nil {
+			return s.err
+		}
+		s.mx.Lock()
+		defer s.mx.Unlock()
+		s.handled = append(s.handled, msg)
+		return nil
+	})
+}
+
+func (s *InboxTest) TestSkipsRedeliveredMessages() {
+	ctx := WithMessageID(context.Background(), "1")
+	msg := QueuedEvent{Event: &testEvent{}, Handler: "handler"}
+
+	s.Require().NoError(s.handle(ctx, msg))
+	s.Require().NoError(s.handle(ctx, msg))
+	s.Len(s.handled, 1)
+
+	s.Require().NoError(s.handle(WithMessageID(context.Background(), "2"), msg))
+	s.Len(s.handled, 2)
+}
+
+func (s *InboxTest) TestDedupesPerHandler() {
+	ctx := WithMessageID(context.Background(), "1")
+
+	s.Require().NoError(s.handle(ctx, QueuedEvent{Event: &testEvent{}, Handler: "first"}))
+	s.Require().NoError(s.handle(ctx, QueuedEvent{Event: &testEvent{}, Handler: "second"}))
+	s.Len(s.handled, 2)
+}
+
+func (s *InboxTest) TestRetriesFailedMessages() {
+	ctx := WithMessageID(context.Background(), "1")
+	msg := QueuedEvent{Event: &testEvent{}, Handler: "handler"}
+
+	s.err = errors.New("failed")
+	s.Error(s.handle(ctx, msg))
+
+	s.err = nil
+	s.Require().NoError(s.handle(ctx, msg))
+	s.Len(s.handled, 1)
+}
+
+func (s *InboxTest) TestHandlesMessagesWithoutID() {
+	msg := QueuedEvent{Event: &testEvent{}, Handler: "handler"}
+
+	s.Require().NoError(s.handle(context.Background(), msg))
+	s.Require().NoError(s.handle(context.Background(), msg))
+	s.Len(s.handled, 2)
+}
+
+func (s *InboxTest) TestHandlesConcurrentRedeliveriesOnce() {
+	ctx := WithMessageID(context.Background(), "1")
+	msg := QueuedEvent{Event: &testEvent{}, Handler: "handler"}
+	s.block = make(chan struct{})
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- s.handle(ctx, msg)
+		}()
+	}
+	s.ErrorIs(<-errs, ErrInboxClaimed)
+	close(s.block)
+	s.NoError(<-errs)
+	s.Len(s.handled, 1)
+
+	s.Require().NoError(s.handle(ctx, msg))
+	s.Len(s.handled, 1)
+}
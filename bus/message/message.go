@@ -16,6 +16,10 @@ var (
 	// QueuedEvent is an event that has been fanned out to a handler and has been
 	// or is ready to be queued
 	QueuedEvent Type = "QueuedEvent"
+	// QueuedQuery is a query that has been queued for a handler in another process
+	QueuedQuery Type = "QueuedQuery"
+	// QueryReply is the result of a queued query, queued back to the process that asked it
+	QueryReply Type = "QueryReply"
 )
 
 // Message is a generic message that can be routed to an event or command handler
@@ -0,0 +1,162 @@
+package bus
+
+import (
+	"context"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/GabrielCarpr/cqrs/metrics"
+)
+
+// queuedAtKey is the context key of the time a message became due in the queue,
+// so consumers can measure how long it waited
+var queuedAtKey = contextKey("queued_at")
+
+func init() {
+	RegisterContextKey(queuedAtKey, "")
+}
+
+// MeasuredQueue is implemented by queues that can report how many messages are waiting
+type MeasuredQueue interface {
+	// Depth returns the number of messages published but not yet processed, including delayed messages
+	Depth(context.Context) (int, error)
+}
+
+// UseMetrics records handler counts, errors and durations, and queue wait times,
+// with the metrics. Queue depth, dead letters and the bus's event store subscription
+// lag are sampled each interval while the bus runs, if they're supported, unless
+// the interval is zero
+func UseMetrics(m metrics.Metrics, interval time.Duration) Config {
+	return func(b *Bus) error {
+		b.metrics = m
+		if interval > 0 {
+			b.plugins = append(b.plugins, &sampler{bus: b, interval: interval})
+		}
+		return nil
+	}
+}
+
+// Metrics returns the bus's metrics, so plugins can record their own
+func (b *Bus) Metrics() metrics.Metrics {
+	return b.metrics
+}
+
+// withQueuedAt returns a context recording when a queued message is due
+func withQueuedAt(ctx context.Context) context.Context {
+	at := time.Now()
+	if deliver := DeliverAt(ctx); deliver.After(at) {
+		at = deliver
+	}
+	return context.WithValue(ctx, queuedAtKey, at.Format(time.RFC3339Nano))
+}
+
+// observeQueueWait records how long a consumed message waited in the queue
+func (b *Bus) observeQueueWait(ctx context.Context, msg message.Message) {
+	queued, _ := ctx.Value(queuedAtKey).(string)
+	at, err := time.Parse(time.RFC3339Nano, queued)
+	if err != nil {
+		return
+	}
+	b.metrics.Observe(metrics.QueueWait, time.Since(at).Seconds(), metrics.Labels{"type": string(msg.MessageType())})
+}
+
+// observeHandler records a handler's result and duration
+func (b *Bus) observeHandler(kind, name, handler string, started time.Time, err error) {
+	labels := metrics.Labels{"type": kind, "name": name, "handler": handler}
+	b.metrics.Count(metrics.HandledTotal, labels)
+	if err != nil {
+		b.metrics.Count(metrics.HandlerErrorsTotal, labels)
+	}
+	b.metrics.Observe(metrics.HandlerDuration, time.Since(started).Seconds(), labels)
+}
+
+// measureCommandHandler records a command handler's metrics
+func (b *Bus) measureCommandHandler(name string, next CommandHandler) CommandHandler {
+	return CmdMiddlewareFunc(func(ctx context.Context, c Command) (CommandResponse, []message.Message) {
+		started := time.Now()
+		res, msgs := next.Execute(ctx, c)
+		b.observeHandler("command", c.Command(), name, started, res.Error)
+		return res, msgs
+	})
+}
+
+// measureQueryHandler records a query handler's metrics
+func (b *Bus) measureQueryHandler(name string, next QueryHandler) QueryHandler {
+	return QueryMiddlewareFunc(func(ctx context.Context, q Query, res interface{}) error {
+		started := time.Now()
+		err := next.Execute(ctx, q, res)
+		b.observeHandler("query", q.Query(), name, started, err)
+		return err
+	})
+}
+
+// measureEventHandler records an event handler's metrics
+func (b *Bus) measureEventHandler(name string, next EventHandler) EventHandler {
+	return EventHandlerFunc(func(ctx context.Context, e Event) ([]message.Message, error) {
+		started := time.Now()
+		msgs, err := next.Handle(ctx, e)
+		b.observeHandler("event", e.Event(), name, started, err)
+		return msgs, err
+	})
+}
+
+var _ Plugin = (*sampler)(nil)
+
+// sampler periodically records the gauges of the bus's queue and event store
+type sampler struct {
+	bus      *Bus
+	interval time.Duration
+}
+
+func (s *sampler) Register(*Bus) error {
+	return nil
+}
+
+func (s *sampler) Close() error {
+	return nil
+}
+
+func (s *sampler) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.sample(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample records each gauge the queue and event store support
+func (s *sampler) sample(ctx context.Context) {
+	m := s.bus.metrics
+	if q, ok := s.bus.queue.(MeasuredQueue); ok {
+		depth, err := q.Depth(ctx)
+		if err != nil {
+			log.Error(ctx, "failed sampling queue depth", log.F{"error": err.Error()})
+		} else {
+			m.Gauge(metrics.QueueDepth, float64(depth), metrics.Labels{})
+		}
+	}
+	if q, ok := s.bus.queue.(DeadLetters); ok {
+		count, err := q.CountDeadLetters(ctx, DeadLetterFilter{})
+		if err != nil {
+			log.Error(ctx, "failed sampling dead letters", log.F{"error": err.Error()})
+		} else {
+			m.Gauge(metrics.DeadLetters, float64(count), metrics.Labels{})
+		}
+	}
+	if s.bus.eventStore != nil {
+		lag, err := s.bus.eventStore.SubscriptionLag(ctx, busSubscription)
+		if err != nil {
+			log.Error(ctx, "failed sampling subscription lag", log.F{"error": err.Error()})
+		} else {
+			m.Gauge(metrics.SubscriptionLag, float64(lag), metrics.Labels{"subscription": busSubscription})
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package bus_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	"github.com/GabrielCarpr/cqrs/metrics"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder records measurements by metric name
+type recorder struct {
+	mx       sync.Mutex
+	counts   map[string][]metrics.Labels
+	observed map[string][]metrics.Labels
+	gauges   map[string]float64
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		counts:   make(map[string][]metrics.Labels),
+		observed: make(map[string][]metrics.Labels),
+		gauges:   make(map[string]float64),
+	}
+}
+
+func (r *recorder) Count(name string, labels metrics.Labels) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.counts[name] = append(r.counts[name], labels)
+}
+
+func (r *recorder) Observe(name string, value float64, labels metrics.Labels) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.observed[name] = append(r.observed[name], labels)
+}
+
+func (r *recorder) Gauge(name string, value float64, labels metrics.Labels) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.gauges[name] = value
+}
+
+func (r *recorder) count(name string) []metrics.Labels {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.counts[name]
+}
+
+func (r *recorder) observations(name string) []metrics.Labels {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.observed[name]
+}
+
+func (r *recorder) gauge(name string) (float64, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	v, ok := r.gauges[name]
+	return v, ok
+}
+
+func TestRecordsHandlerAndQueueMetrics(t *testing.T) {
+	m := newRecorder()
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(renameHandler{})
+		},
+		Defs: []bus.Def{{
+			Name: renameHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return renameHandler{}, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{module}, bus.UseQueue(queue), bus.UseMetrics(m, time.Millisecond*10))
+	defer runBus(b, cancel)()
+
+	_, err := b.Dispatch(context.Background(), renameCmd{}, false)
+	require.NoError(t, err)
+	require.NoError(t, queue.Wait(time.Second))
+
+	labels := metrics.Labels{"type": "command", "name": "rename", "handler": bus.CommandHandlerName(renameHandler{})}
+	assert.Equal(t, []metrics.Labels{labels}, m.count(metrics.HandledTotal))
+	assert.Empty(t, m.count(metrics.HandlerErrorsTotal))
+	assert.Equal(t, []metrics.Labels{labels}, m.observations(metrics.HandlerDuration))
+	assert.Len(t, m.observations(metrics.QueueWait), 1)
+
+	assert.Eventually(t, func() bool {
+		depth, ok := m.gauge(metrics.QueueDepth)
+		letters, lettersOK := m.gauge(metrics.DeadLetters)
+		return ok && lettersOK && depth == 0 && letters == 0
+	}, time.Second, time.Millisecond*10)
+}
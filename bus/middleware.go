@@ -2,16 +2,19 @@ package bus
 
 import (
 	"context"
+	stdErrors "errors"
+	"fmt"
 	"reflect"
+	"runtime/debug"
 
 	"github.com/GabrielCarpr/cqrs/bus/message"
 	"github.com/GabrielCarpr/cqrs/errors"
 	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/GabrielCarpr/cqrs/validate"
 )
 
 /*
 * TODO: Add new middleware
-* - Panic recovery
 * - Auth/access control guard
 
 /*
@@ -24,9 +27,15 @@ import (
 // Will always run before a command is queued
 type CommandGuard = func(context.Context, Command) (context.Context, Command, error)
 
-// CommandValidationGuard checks a command is valid before being executed, and returns an error if not
+// CommandValidationGuard checks a command is valid before being executed, and returns an error if not.
+// The rules in the command's cqrs tags are checked first, returning an errors.ValidationError with
+// each invalid field, then, if its fields are valid, its Valid method, for rules across fields.
+// An invalid tag returns errors.InternalServerError
 func CommandValidationGuard(ctx context.Context, c Command) (context.Context, Command, error) {
-	err := c.Valid()
+	err := validateTags(ctx, c)
+	if err == nil {
+		err = c.Valid()
+	}
 	if err != nil {
 		return ctx, c, err
 	}
@@ -38,15 +47,30 @@ func CommandValidationGuard(ctx context.Context, c Command) (context.Context, Co
 // routed to a handler. Intended for use with validation and access control.
 type QueryGuard = func(context.Context, Query) (context.Context, Query, error)
 
-// QueryValidationGuard ensures a query is valid before being routed to a handler
+// QueryValidationGuard ensures a query is valid before being routed to a handler,
+// checking the rules in its cqrs tags then its Valid method, like CommandValidationGuard
 func QueryValidationGuard(ctx context.Context, q Query) (context.Context, Query, error) {
-	err := q.Valid()
+	err := validateTags(ctx, q)
+	if err == nil {
+		err = q.Valid()
+	}
 	if err != nil {
 		return ctx, q, err
 	}
 	return ctx, q, nil
 }
 
+// validateTags checks the rules in a message's cqrs tags, hiding invalid tags,
+// which are a bug in the message, behind errors.InternalServerError
+func validateTags(ctx context.Context, msg interface{}) error {
+	err := validate.Struct(msg)
+	if stdErrors.Is(err, validate.ErrInvalidTag) {
+		log.Error(ctx, err, log.F{})
+		return errors.InternalServerError
+	}
+	return err
+}
+
 /*
  * Command Middleware
  * TODO: Add tests
@@ -80,14 +104,39 @@ func CommandLoggingMiddleware(next CommandHandler) CommandHandler {
 	})
 }
 
-// CommandErrorMiddleware stops internal errors from being exposed to ports
+// CommandRecoveryMiddleware recovers from panics in the handler, and the middleware
+// it wraps, logging the stack and responding with an internal server error. Middleware
+// that must run however the command finishes, such as background's JobFinishingMiddleware,
+// should wrap it
+func CommandRecoveryMiddleware(next CommandHandler) CommandHandler {
+	return CmdMiddlewareFunc(func(ctx context.Context, c Command) (res CommandResponse, msgs []message.Message) {
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(ctx, r)
+				res, msgs = CommandResponse{Error: errors.InternalServerError}, nil
+			}
+		}()
+
+		return next.Execute(ctx, c)
+	})
+}
+
+// CommandErrorMiddleware stops internal errors from being exposed to ports,
+// and reports concurrency violations as conflicts. Wrapped port-interface
+// errors are unwrapped, so only the public error reaches ports
 func CommandErrorMiddleware(next CommandHandler) CommandHandler {
 	return CmdMiddlewareFunc(func(ctx context.Context, c Command) (CommandResponse, []message.Message) {
 		res, msgs := next.Execute(ctx, c)
 		if res.Error == nil {
 			return res, msgs
 		}
-		if _, ok := res.Error.(errors.Error); ok {
+		if public, ok := errors.Public(res.Error); ok {
+			res.Error = public
+			return res, msgs
+		}
+		if stdErrors.Is(res.Error, ErrConcurrencyViolation) {
+			log.Warn(ctx, "command conflicted", log.F{"command": c.Command(), "error": res.Error.Error()})
+			res.Error = errors.Conflict
 			return res, msgs
 		}
 
@@ -130,15 +179,31 @@ func QueryLoggingMiddleware(next QueryHandler) QueryHandler {
 	})
 }
 
-// QueryErrorMiddleware blocks internal errors from escaping query interfaces
+// QueryRecoveryMiddleware recovers from panics in the handler, and the middleware
+// it wraps, logging the stack and returning an internal server error
+func QueryRecoveryMiddleware(next QueryHandler) QueryHandler {
+	return QueryMiddlewareFunc(func(ctx context.Context, q Query, res interface{}) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(ctx, r)
+				err = errors.InternalServerError
+			}
+		}()
+
+		return next.Execute(ctx, q, res)
+	})
+}
+
+// QueryErrorMiddleware blocks internal errors from escaping query interfaces,
+// unwrapping wrapped port-interface errors
 func QueryErrorMiddleware(next QueryHandler) QueryHandler {
 	return QueryMiddlewareFunc(func(ctx context.Context, q Query, res interface{}) error {
 		err := next.Execute(ctx, q, res)
 		if err == nil {
 			return err
 		}
-		if err, ok := err.(errors.Error); ok {
-			return err
+		if public, ok := errors.Public(err); ok {
+			return public
 		}
 
 		log.Error(ctx, err, log.F{})
@@ -177,3 +242,24 @@ func EventLoggingMiddleware(next EventHandler) EventHandler {
 		return msgs, err
 	})
 }
+
+// EventRecoveryMiddleware recovers from panics in the handler, and the middleware it
+// wraps, logging the stack and returning an internal server error, so the queue
+// retries the event like any other failure
+func EventRecoveryMiddleware(next EventHandler) EventHandler {
+	return EventHandlerFunc(func(ctx context.Context, e Event) (msgs []message.Message, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logPanic(ctx, r)
+				msgs, err = nil, errors.InternalServerError
+			}
+		}()
+
+		return next.Handle(ctx, e)
+	})
+}
+
+// logPanic logs a recovered panic, with the stack of the goroutine that panicked
+func logPanic(ctx context.Context, r interface{}) {
+	log.Error(ctx, fmt.Errorf("Panicked: %v\n%s", r, debug.Stack()), log.F{})
+}
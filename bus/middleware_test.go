@@ -0,0 +1,182 @@
+package bus_test
+
+import (
+	"context"
+	stdErrors "errors"
+	"fmt"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type panicCmd struct {
+	bus.CommandType
+}
+
+func (panicCmd) Command() string {
+	return "panic"
+}
+
+func (panicCmd) Valid() error {
+	return nil
+}
+
+type panicQuery struct {
+	bus.QueryType
+}
+
+func (panicQuery) Query() string {
+	return "panic"
+}
+
+func (panicQuery) Valid() error {
+	return nil
+}
+
+type panicHandler struct{}
+
+func (panicHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	panic("command handler panicked")
+}
+
+type panicQueryHandler struct{}
+
+func (panicQueryHandler) Execute(ctx context.Context, q bus.Query, res interface{}) error {
+	panic("query handler panicked")
+}
+
+func TestDefaultRecoversFromHandlerPanics(t *testing.T) {
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(panicCmd{}).Handled(panicHandler{})
+		},
+		QueriesFunc: func(b bus.QueryBuilder) {
+			b.Query(panicQuery{}).Handled(panicQueryHandler{})
+		},
+		Defs: []bus.Def{{
+			Name: panicHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return panicHandler{}, nil
+			},
+		}, {
+			Name: panicQueryHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return panicQueryHandler{}, nil
+			},
+		}},
+	}
+	b := bus.Default(context.Background(), []bus.Module{module})
+	defer b.Close()
+
+	var finished *bus.CommandResponse
+	b.Use(func(next bus.CommandHandler) bus.CommandHandler {
+		return bus.CmdMiddlewareFunc(func(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+			res, msgs := next.Execute(ctx, c)
+			finished = &res
+			return res, msgs
+		})
+	})
+
+	res, err := b.Dispatch(context.Background(), panicCmd{}, true)
+	require.NoError(t, err)
+	assert.Equal(t, errors.InternalServerError, res.Error)
+	require.NotNil(t, finished, "middleware above recovery didn't finish")
+	assert.Equal(t, errors.InternalServerError, finished.Error)
+
+	var result struct{}
+	err = b.Query(context.Background(), panicQuery{}, &result)
+	assert.Equal(t, errors.InternalServerError, err)
+}
+
+func TestEventRecoveryMiddleware(t *testing.T) {
+	handler := bus.EventRecoveryMiddleware(bus.EventHandlerFunc(func(ctx context.Context, e bus.Event) ([]message.Message, error) {
+		panic("event handler panicked")
+	}))
+
+	msgs, err := handler.Handle(context.Background(), &TestEvent{})
+	assert.Nil(t, msgs)
+	assert.Equal(t, errors.InternalServerError, err)
+}
+
+type signUpCmd struct {
+	bus.CommandType
+
+	Email    string `cqrs:"email,validate=required,email"`
+	Password string `cqrs:"password,validate=required,min=8"`
+	Confirm  string `cqrs:"confirm"`
+}
+
+func (signUpCmd) Command() string {
+	return "sign_up"
+}
+
+func (c signUpCmd) Valid() error {
+	if c.Password != c.Confirm {
+		return errors.Error{Code: 400, Message: "Passwords don't match"}
+	}
+	return nil
+}
+
+func TestCommandValidationGuardChecksTagsThenValid(t *testing.T) {
+	_, _, err := bus.CommandValidationGuard(context.Background(), signUpCmd{Email: "nope", Password: "short"})
+	require.IsType(t, errors.ValidationError{}, err)
+	assert.Equal(t, map[string][]string{
+		"email":    {"must be an email address"},
+		"password": {"must have at least 8 characters"},
+	}, err.(errors.ValidationError).Fields)
+
+	_, _, err = bus.CommandValidationGuard(context.Background(), signUpCmd{Email: "a@example.com", Password: "password1"})
+	assert.Equal(t, errors.Error{Code: 400, Message: "Passwords don't match"}, err)
+
+	_, _, err = bus.CommandValidationGuard(context.Background(), signUpCmd{Email: "a@example.com", Password: "password1", Confirm: "password1"})
+	assert.NoError(t, err)
+}
+
+type typoCmd struct {
+	bus.CommandType
+
+	Email string `cqrs:"email,validate=requird"`
+}
+
+func (typoCmd) Command() string {
+	return "typo"
+}
+
+func (typoCmd) Valid() error {
+	return nil
+}
+
+func TestCommandValidationGuardHidesUnknownRules(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		_, _, err := bus.CommandValidationGuard(context.Background(), typoCmd{})
+		assert.Equal(t, errors.InternalServerError, err)
+	}
+}
+
+func TestErrorMiddlewaresUnwrapPublicErrors(t *testing.T) {
+	taken := errors.Conflict.WithReason("user.email_taken").Wrap(stdErrors.New("duplicate key"))
+	wrapped := fmt.Errorf("saving user: %w", taken)
+
+	cmdHandler := bus.CommandErrorMiddleware(bus.CmdMiddlewareFunc(func(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+		return bus.CommandResponse{Error: wrapped}, nil
+	}))
+	res, _ := cmdHandler.Execute(context.Background(), panicCmd{})
+	assert.Equal(t, taken, res.Error)
+
+	queryHandler := bus.QueryErrorMiddleware(bus.QueryMiddlewareFunc(func(ctx context.Context, q bus.Query, res interface{}) error {
+		return fmt.Errorf("finding user: %w", errors.NotFound)
+	}))
+	err := queryHandler.Execute(context.Background(), panicQuery{}, nil)
+	assert.Equal(t, errors.NotFound, err)
+
+	queryHandler = bus.QueryErrorMiddleware(bus.QueryMiddlewareFunc(func(ctx context.Context, q bus.Query, res interface{}) error {
+		return fmt.Errorf("finding user: %w", stdErrors.New("connection refused"))
+	}))
+	err = queryHandler.Execute(context.Background(), panicQuery{}, nil)
+	assert.Equal(t, errors.InternalServerError, err)
+}
@@ -0,0 +1,134 @@
+package bus
+
+import (
+	"context"
+	"errors"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/sarulabs/di/v2"
+	"golang.org/x/sync/errgroup"
+)
+
+// OutboxTxName is the name of the request scoped outbox transaction service.
+// Command handlers write their state changes with it, so they commit atomically
+// with the messages they return
+const OutboxTxName = "cqrs.outbox.tx"
+
+// Outbox stores the messages returned by command handlers in the same transaction
+// as the handler's state changes. A relay then routes them, at least once
+type Outbox interface {
+	// Begin starts a command's transaction
+	Begin(context.Context) (OutboxTx, error)
+}
+
+// OutboxTx is one command's outbox transaction
+type OutboxTx interface {
+	// Store adds messages to the outbox, along with the context they were returned in.
+	// Each message is stored with the context returned by StampMessage, and relayed
+	// with Bus.Relay
+	Store(context.Context, ...message.Message) error
+
+	// Commit commits the transaction
+	Commit() error
+
+	// Rollback aborts the transaction, if it hasn't been committed
+	Rollback() error
+}
+
+// UseOutbox stores commands' messages in an outbox, instead of routing them
+// directly. The outbox transaction is available to handlers with Get(ctx, OutboxTxName),
+// and is rolled back if the handler fails
+func UseOutbox(o Outbox) Config {
+	return func(b *Bus) error {
+		b.outbox = o
+		b.defs = append(b.defs, Def{
+			Name:  OutboxTxName,
+			Scope: di.Request,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return o.Begin(context.Background())
+			},
+			Close: func(obj interface{}) error {
+				return obj.(OutboxTx).Rollback()
+			},
+		})
+		return nil
+	}
+}
+
+// storeOutbox stores a command's messages in its outbox transaction, and commits
+// it. Failed commands are rolled back when the request container is deleted
+func (b *Bus) storeOutbox(ctx context.Context, response CommandResponse, msgs ...message.Message) error {
+	if response.Error != nil {
+		return nil
+	}
+	tx := Get(ctx, OutboxTxName).(OutboxTx)
+	err := tx.Store(ctx, msgs...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// StampMessage gives a message being stored in an outbox its message ID, caused by
+// the context's message, returning the context to store it with. Commands carry
+// their ID in the context, and events in their metadata, so a message relayed more
+// than once keeps its ID
+func StampMessage(ctx context.Context, msg message.Message) context.Context {
+	switch v := msg.(type) {
+	case Command:
+		return Caused(ctx)
+	case Event:
+		stampEvent(ctx, v)
+	}
+	return ctx
+}
+
+// Relay routes a message from an outbox, with the context it was stored with. A
+// relay may route a message more than once, so commands keep their message ID, for
+// an inbox to skip them, and an event already in the event store is skipped
+func (b *Bus) Relay(ctx context.Context, msg message.Message) error {
+	switch v := msg.(type) {
+	case Command:
+		_, err := b.dispatch(ctx, v, false)
+		return err
+	case Event:
+		err := b.Publish(ctx, v)
+		if !errors.Is(err, ErrConcurrencyViolation) {
+			return err
+		}
+		stored, storedErr := b.eventStored(ctx, v)
+		if storedErr != nil || !stored {
+			return err
+		}
+		log.Warn(ctx, "Skipping relayed event already in the event store", log.F{"event": v.Event()})
+		return nil
+	default:
+		return b.route(ctx, msg)
+	}
+}
+
+// eventStored returns whether the event store has an event, by its message ID
+func (b *Bus) eventStored(ctx context.Context, e Event) (bool, error) {
+	id := e.HasMetadata()[MessageIDKey.String()]
+	if b.eventStore == nil || id == "" {
+		return false, nil
+	}
+
+	stream := make(chan Event)
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		return b.eventStore.Stream(ctx, stream, Select{
+			StreamID: StreamID{Type: e.FromAggregate(), ID: e.Owned()},
+			From:     e.Versioned(),
+		})
+	})
+
+	stored := false
+	for event := range stream {
+		if event.HasMetadata()[MessageIDKey.String()] == id {
+			stored = true
+		}
+	}
+	return stored, group.Wait()
+}
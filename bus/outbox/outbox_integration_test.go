@@ -0,0 +1,130 @@
+// +build !unit
+
+package outbox_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/outbox/sql"
+	"github.com/GabrielCarpr/cqrs/eventstore/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type testEvent struct {
+	bus.EventType
+
+	Result string
+}
+
+func (testEvent) Event() string {
+	return "outbox.test"
+}
+
+var TestConfig = sql.Config{
+	DBName:        "cqrs",
+	DBHost:        "db",
+	DBUser:        "cqrs",
+	DBPass:        "cqrs",
+	RelayInterval: time.Millisecond * 10,
+}
+
+func TestSQLOutboxIntegrationTest(t *testing.T) {
+	suite.Run(t, new(OutboxIntegrationTest))
+}
+
+type OutboxIntegrationTest struct {
+	suite.Suite
+
+	outbox *sql.SQLOutbox
+	store  *memory.MemoryEventStore
+	bus    *bus.Bus
+}
+
+func (s *OutboxIntegrationTest) SetupTest() {
+	s.outbox = sql.NewSQLOutbox(TestConfig)
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	s.store = &memory.MemoryEventStore{}
+	s.bus = bus.New(context.Background(), []bus.Module{}, bus.UseEventStore(s.store), bus.UseOutbox(s.outbox))
+	bus.RegisterMessage(&testEvent{})
+}
+
+func (s *OutboxIntegrationTest) TearDownTest() {
+	s.bus.Close()
+	s.outbox.Close()
+}
+
+func (s *OutboxIntegrationTest) event(result string) *testEvent {
+	e := &testEvent{Result: result}
+	e.OwnedBy(uuid.New().String())
+	e.ForAggregate("test")
+	return e
+}
+
+func (s *OutboxIntegrationTest) relayed() []bus.Event {
+	events := make(chan bus.Event)
+	go s.store.Stream(context.Background(), events, bus.Select{})
+	result := make([]bus.Event, 0)
+	for e := range events {
+		result = append(result, e)
+	}
+	return result
+}
+
+func (s *OutboxIntegrationTest) TestRelaysCommittedMessages() {
+	committed, err := s.outbox.Begin(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(committed.Store(context.Background(), s.event("committed")))
+	s.Require().NoError(committed.Commit())
+
+	rolledBack, err := s.outbox.Begin(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(rolledBack.Store(context.Background(), s.event("rolled back")))
+	s.Require().NoError(rolledBack.Rollback())
+
+	relay := s.outbox.Relay()
+	s.Require().NoError(relay.Register(s.bus))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+
+	s.Eventually(func() bool {
+		return len(s.relayed()) > 0
+	}, time.Second, time.Millisecond*10)
+	cancel()
+
+	events := s.relayed()
+	s.Require().Len(events, 1)
+	s.Equal("committed", events[0].(*testEvent).Result)
+}
+
+func (s *OutboxIntegrationTest) TestMovesUnrelayableMessagesAside() {
+	_, err := s.outbox.DB().Exec(`INSERT INTO outbox (payload, metadata) VALUES ($1, '{}')`, []byte("garbage"))
+	s.Require().NoError(err)
+	committed, err := s.outbox.Begin(context.Background())
+	s.Require().NoError(err)
+	s.Require().NoError(committed.Store(context.Background(), s.event("behind")))
+	s.Require().NoError(committed.Commit())
+
+	relay := s.outbox.Relay()
+	s.Require().NoError(relay.Register(s.bus))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go relay.Run(ctx)
+
+	s.Eventually(func() bool {
+		return len(s.relayed()) > 0
+	}, time.Second*5, time.Millisecond*10)
+	cancel()
+
+	var attempts int
+	var lastError string
+	err = s.outbox.DB().QueryRow(`SELECT attempts, last_error FROM outbox_failures`).Scan(&attempts, &lastError)
+	s.Require().NoError(err)
+	s.Equal(5, attempts)
+	s.NotEmpty(lastError)
+	s.Equal("behind", s.relayed()[0].(*testEvent).Result)
+}
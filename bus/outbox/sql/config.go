@@ -0,0 +1,32 @@
+package sql
+
+import (
+	"fmt"
+	"time"
+)
+
+type Config struct {
+	DBName string
+	DBHost string
+	DBUser string
+	DBPass string
+
+	// RelayInterval is how often the relay polls for messages when the outbox is
+	// empty, and waits after failing to relay one
+	RelayInterval time.Duration
+
+	// MaxAttempts is how many times the relay tries to route a message before moving
+	// it to the outbox_failures table, so it doesn't hold up the messages behind it.
+	// Defaults to 5
+	MaxAttempts int
+}
+
+func (c Config) DBDsn() string {
+	return fmt.Sprintf(
+		"user=%s password=%s dbname=%s host=%s sslmode=disable",
+		c.DBUser,
+		c.DBPass,
+		c.DBName,
+		c.DBHost,
+	)
+}
@@ -0,0 +1,57 @@
+package sql
+
+import (
+	stdSQL "database/sql"
+	"log"
+	"strings"
+)
+
+// PostgreSQLSchema creates the outbox table, and the outbox_failures table of
+// messages that couldn't be relayed
+type PostgreSQLSchema struct {
+	Config Config
+}
+
+func (s PostgreSQLSchema) Make() error {
+	log.Print("Creating outbox")
+	db, err := stdSQL.Open("postgres", s.Config.DBDsn())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS outbox (
+		"offset" BIGSERIAL PRIMARY KEY,
+		"payload" BYTEA NOT NULL,
+		"metadata" JSON NOT NULL,
+		"created_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS "attempts" INT NOT NULL DEFAULT 0;
+	ALTER TABLE outbox ADD COLUMN IF NOT EXISTS "last_error" TEXT;
+	CREATE TABLE IF NOT EXISTS outbox_failures (
+		"offset" BIGINT PRIMARY KEY,
+		"payload" BYTEA NOT NULL,
+		"metadata" JSON NOT NULL,
+		"created_at" TIMESTAMP NOT NULL,
+		"attempts" INT NOT NULL,
+		"last_error" TEXT,
+		"failed_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);`)
+	return err
+}
+
+func ResetSQLDB(dsn string) {
+	log.Print("Resetting outbox")
+	db, err := stdSQL.Open("postgres", dsn)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	for _, table := range []string{"outbox", "outbox_failures"} {
+		_, err = db.Exec("DELETE FROM " + table)
+		if err != nil && !strings.Contains(err.Error(), "does not exist") {
+			panic(err)
+		}
+	}
+}
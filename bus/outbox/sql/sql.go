@@ -0,0 +1,233 @@
+package sql
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/log"
+
+	_ "github.com/lib/pq"
+)
+
+func makeDB(c Config) *stdSQL.DB {
+	db, err := stdSQL.Open("postgres", c.DBDsn())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+var _ bus.Outbox = (*SQLOutbox)(nil)
+
+// NewSQLOutbox returns an outbox, creating its table if required
+func NewSQLOutbox(c Config) *SQLOutbox {
+	db := makeDB(c)
+	schema := PostgreSQLSchema{c}
+	err := schema.Make()
+	if err != nil {
+		panic(err)
+	}
+	if c.RelayInterval == 0 {
+		c.RelayInterval = time.Second
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = 5
+	}
+	return &SQLOutbox{db: db, interval: c.RelayInterval, maxAttempts: c.MaxAttempts}
+}
+
+// SQLOutbox stores commands' messages in PostgreSQL, in the command's transaction
+type SQLOutbox struct {
+	db          *stdSQL.DB
+	interval    time.Duration
+	maxAttempts int
+}
+
+// DB returns the outbox's database, which command handlers' transactions are opened on
+func (o *SQLOutbox) DB() *stdSQL.DB {
+	return o.db
+}
+
+func (o *SQLOutbox) Begin(ctx context.Context) (bus.OutboxTx, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx}, nil
+}
+
+// Relay returns the bus plugin that routes the outbox's messages
+func (o *SQLOutbox) Relay() *Relay {
+	return &Relay{outbox: o}
+}
+
+func (o *SQLOutbox) Close() error {
+	return o.db.Close()
+}
+
+var _ bus.OutboxTx = (*Tx)(nil)
+
+// Tx is a command's transaction. Handlers write their state changes with it
+type Tx struct {
+	*stdSQL.Tx
+}
+
+// Transaction returns the command's transaction from the request scoped container
+func Transaction(ctx context.Context) *Tx {
+	return bus.Get(ctx, bus.OutboxTxName).(*Tx)
+}
+
+func (tx *Tx) Store(ctx context.Context, msgs ...message.Message) error {
+	for _, msg := range msgs {
+		msgCtx := bus.StampMessage(ctx, msg)
+		metadata, err := json.Marshal(bus.SerializeContext(msgCtx))
+		if err != nil {
+			return err
+		}
+		payload, err := bus.SerializeMessage(msg, bus.Gob)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO outbox (payload, metadata) VALUES ($1, $2)`, payload, metadata)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback aborts the transaction, ignoring transactions already committed
+func (tx *Tx) Rollback() error {
+	err := tx.Tx.Rollback()
+	if err == stdSQL.ErrTxDone {
+		return nil
+	}
+	return err
+}
+
+var _ bus.Plugin = (*Relay)(nil)
+
+// Relay routes messages from the outbox with Bus.Relay, deleting them once routed.
+// A message may be routed more than once if the relay fails before deleting it,
+// so it keeps the message ID it was stored with. A message that fails MaxAttempts
+// times, such as an event conflicting with another in the event store, is moved
+// to the outbox_failures table
+type Relay struct {
+	outbox *SQLOutbox
+	b      *bus.Bus
+}
+
+func (r *Relay) Register(b *bus.Bus) error {
+	r.b = b
+	return nil
+}
+
+func (r *Relay) Close() error {
+	return nil
+}
+
+// Run relays messages until the context is cancelled
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		relayed, err := r.relay(ctx)
+		if err != nil {
+			log.Error(ctx, "failed relaying outbox message", log.F{"error": err.Error()})
+		}
+		if relayed && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.outbox.interval):
+		}
+	}
+}
+
+// relay routes the oldest message in the outbox, returning whether there was one
+func (r *Relay) relay(ctx context.Context) (bool, error) {
+	tx, err := r.outbox.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var offset int64
+	var attempts int
+	var payload, metadata []byte
+	row := tx.QueryRowContext(ctx, `SELECT "offset", attempts, payload, metadata FROM outbox
+		ORDER BY "offset" ASC
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED`)
+	err = row.Scan(&offset, &attempts, &payload, &metadata)
+	if err == stdSQL.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = r.route(ctx, payload, metadata)
+	if err != nil {
+		return true, r.fail(ctx, tx, offset, attempts+1, err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM outbox WHERE "offset" = $1`, offset)
+	if err != nil {
+		return true, err
+	}
+	return true, tx.Commit()
+}
+
+// route routes a stored message, with a context derived from the relay's
+func (r *Relay) route(ctx context.Context, payload, metadata []byte) error {
+	msg, err := bus.DeserializeMessage(payload)
+	if err != nil {
+		return err
+	}
+	var serialized bus.SerializedContext
+	err = json.Unmarshal(metadata, &serialized)
+	if err != nil {
+		return err
+	}
+
+	return r.b.Relay(bus.DeserializeContext(ctx, serialized), msg)
+}
+
+// fail records a failed attempt to relay a message, moving it to outbox_failures
+// once it's out of attempts. It returns the relay's error, or the error recording it
+func (r *Relay) fail(ctx context.Context, tx *stdSQL.Tx, offset int64, attempts int, relayErr error) error {
+	var err error
+	if attempts >= r.outbox.maxAttempts {
+		log.Error(ctx, "moving outbox message to outbox_failures", log.F{"offset": fmt.Sprint(offset), "error": relayErr.Error()})
+		_, err = tx.ExecContext(ctx, `INSERT INTO outbox_failures
+			("offset", payload, metadata, created_at, attempts, last_error)
+			SELECT "offset", payload, metadata, created_at, $2, $3 FROM outbox WHERE "offset" = $1`,
+			offset, attempts, relayErr.Error())
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM outbox WHERE "offset" = $1`, offset)
+		}
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE outbox SET attempts = $2, last_error = $3 WHERE "offset" = $1`,
+			offset, attempts, relayErr.Error())
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return err
+	}
+	return relayErr
+}
@@ -283,3 +283,20 @@ func TestSelfTestQueryNoHandler(t *testing.T) {
 	err := r.SelfTest()
 	require.Error(t, err)
 }
+
+func TestRouteRemoteQuery(t *testing.T) {
+	r := bus.NewQueryContext()
+
+	func(b bus.QueryBuilder) {
+		b.Group(func(b bus.QueryBuilder) {
+			b.Query(routingQuery{}).Remote("other-service")
+		})
+	}(r)
+
+	c, ok := r.Route(routingQuery{})
+	require.True(t, ok)
+	assert.True(t, c.Remote)
+	assert.Equal(t, "other-service", c.Topic)
+	assert.Nil(t, c.Handler)
+	assert.NoError(t, r.SelfTest())
+}
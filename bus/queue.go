@@ -2,13 +2,15 @@ package bus
 
 import (
 	"context"
+
 	"github.com/GabrielCarpr/cqrs/bus/message"
 )
 
 // Queue allows the bus to queue messages for asynchronous execution
 type Queue interface {
 	// Publish publishes a message to the queue
-	// blocking until the message has been published
+	// blocking until the message has been published.
+	// Messages are delivered at the context's DeliverAt time, if it's set
 	Publish(context.Context, ...message.Message) error
 
 	// Subscribe registers a callback for inbound messages
@@ -18,3 +20,47 @@ type Queue interface {
 	// Close closes the queue down
 	Close()
 }
+
+// TopicQueue is implemented by queues that only consume the topics they're
+// configured with, so the bus can consume topics of its own, such as its
+// remote query reply topic
+type TopicQueue interface {
+	Queue
+
+	// Consume subscribes to a topic, as well as the configured topics. It's
+	// called before Subscribe
+	Consume(topic string)
+}
+
+// Partitioned is implemented by commands and events that are processed
+// in order with the other messages sharing their partition key
+type Partitioned interface {
+	PartitionKey() string
+}
+
+// PartitionKey returns the key a queued message is ordered by. Queues process messages
+// with the same key in order, and messages with different keys in parallel.
+//
+// The key is the context's, set with WithPartitionKey, then the message's own if it
+// implements Partitioned. Queued events default to their aggregate, so each aggregate's
+// events are handled in order. Other messages have no key, and may be processed in any order
+func PartitionKey(ctx context.Context, msg message.Message) string {
+	if key, ok := ctx.Value(partitionKeyKey).(string); ok {
+		return key
+	}
+
+	switch v := msg.(type) {
+	case Partitioned:
+		return v.PartitionKey()
+	case QueuedEvent:
+		if p, ok := v.Event.(Partitioned); ok {
+			return p.PartitionKey()
+		}
+		if v.Event.Owned() == "" {
+			return ""
+		}
+		return v.Event.FromAggregate() + "/" + v.Event.Owned()
+	default:
+		return ""
+	}
+}
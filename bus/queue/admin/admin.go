@@ -0,0 +1,105 @@
+// Package admin provides a command line interface for administering queues
+package admin
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+)
+
+// ErrUsage indicates the admin command was called incorrectly
+var ErrUsage = errors.New("usage: deadletters [list|count|replay|purge] [-topic topic] [-name name] [-limit n] [-all] [id]")
+
+// DeadLetters runs a dead letter subcommand against a queue, writing its output to out.
+//
+//	list               lists dead letters, with their reason and metadata
+//	count              prints the number of dead letters
+//	replay <id>|-all   replays a dead letter, or all selected dead letters
+//	purge              deletes the selected dead letters
+//
+// Dead letters are selected with the -topic, -name and -limit flags
+func DeadLetters(ctx context.Context, q bus.DeadLetters, out io.Writer, args ...string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+
+	var filter bus.DeadLetterFilter
+	var all bool
+	flags := flag.NewFlagSet("deadletters "+args[0], flag.ContinueOnError)
+	flags.SetOutput(out)
+	flags.StringVar(&filter.Topic, "topic", "", "Select dead letters originally published to a topic")
+	flags.StringVar(&filter.Name, "name", "", "Select dead letters by command or event name")
+	flags.IntVar(&filter.Limit, "limit", 0, "Limit the number of dead letters")
+	flags.BoolVar(&all, "all", false, "Replay all selected dead letters")
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return list(ctx, q, out, filter)
+	case "count":
+		count, err := q.CountDeadLetters(ctx, filter)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, count)
+		return nil
+	case "replay":
+		if all {
+			n, err := q.ReplayMatching(ctx, filter)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "replayed %d dead letters\n", n)
+			return nil
+		}
+		if flags.NArg() != 1 {
+			return ErrUsage
+		}
+		err := q.Replay(ctx, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "replayed %s\n", flags.Arg(0))
+		return nil
+	case "purge":
+		n, err := q.PurgeDeadLetters(ctx, filter)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "purged %d dead letters\n", n)
+		return nil
+	default:
+		return ErrUsage
+	}
+}
+
+func list(ctx context.Context, q bus.DeadLetters, out io.Writer, filter bus.DeadLetterFilter) error {
+	letters, err := q.DeadLetters(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTOPIC\tFAILED AT\tREASON")
+	for _, d := range letters {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", d.ID, d.Name(), d.Topic, d.FailedAt.Format(time.RFC3339), d.Reason)
+		if d.Message == nil {
+			fmt.Fprintf(w, "\tpayload: undecodable (%d bytes)\n", len(d.Payload))
+		} else {
+			fmt.Fprintf(w, "\tpayload: %+v\n", d.Message)
+		}
+		for key, val := range d.Metadata {
+			fmt.Fprintf(w, "\t%s: %s\n", key, val)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,143 @@
+package admin_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/bus/queue/admin"
+	"github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	"github.com/stretchr/testify/suite"
+)
+
+type testCmd struct {
+	bus.CommandType
+
+	Result string
+}
+
+func (testCmd) Command() string {
+	return "testcmd"
+}
+
+func (testCmd) Valid() error {
+	return nil
+}
+
+func TestAdmin(t *testing.T) {
+	bus.RegisterMessage(testCmd{})
+	suite.Run(t, new(AdminTest))
+}
+
+type AdminTest struct {
+	suite.Suite
+
+	queue  *memory.MemoryQueue
+	failed chan bool
+	cancel context.CancelFunc
+}
+
+func (s *AdminTest) SetupTest() {
+	s.queue = memory.NewMemoryQueue(memory.Config{MaxRetries: 1, InitialInterval: time.Millisecond})
+	s.failed = make(chan bool, 1)
+	s.failed <- true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+		select {
+		case fail := <-s.failed:
+			s.failed <- fail
+			if fail {
+				return errors.New("failed " + msg.(testCmd).Result)
+			}
+		default:
+		}
+		return nil
+	})
+
+	s.Require().NoError(s.queue.Publish(bus.WithMessageID(context.Background(), "1"), testCmd{Result: "first"}))
+	s.Require().NoError(s.queue.Publish(bus.WithMessageID(context.Background(), "2"), testCmd{Result: "second"}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+}
+
+func (s *AdminTest) TearDownTest() {
+	s.cancel()
+	s.queue.Close()
+}
+
+func (s *AdminTest) run(args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	err := admin.DeadLetters(context.Background(), s.queue, out, args...)
+	return out.String(), err
+}
+
+func (s *AdminTest) TestLists() {
+	out, err := s.run("list", "-name", "testcmd")
+	s.Require().NoError(err)
+
+	s.Contains(out, "failed first")
+	s.Contains(out, "failed second")
+	s.Contains(out, "message_id: 2")
+}
+
+func (s *AdminTest) TestCounts() {
+	out, err := s.run("count")
+	s.Require().NoError(err)
+	s.Equal("2\n", out)
+
+	out, err = s.run("count", "-name", "other")
+	s.Require().NoError(err)
+	s.Equal("0\n", out)
+}
+
+func (s *AdminTest) TestReplays() {
+	<-s.failed
+	s.failed <- false
+
+	out, err := s.run("replay", "1")
+	s.Require().NoError(err)
+	s.Equal("replayed 1\n", out)
+	s.Require().NoError(s.queue.Wait(time.Second))
+
+	out, err = s.run("replay", "-all")
+	s.Require().NoError(err)
+	s.Equal("replayed 1 dead letters\n", out)
+	s.Require().NoError(s.queue.Wait(time.Second))
+
+	count, err := s.queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	s.Require().NoError(err)
+	s.Equal(0, count)
+}
+
+func (s *AdminTest) TestReplayMissing() {
+	_, err := s.run("replay", "3")
+	s.Equal(bus.ErrDeadLetterNotFound, err)
+}
+
+func (s *AdminTest) TestPurges() {
+	out, err := s.run("purge", "-limit", "1")
+	s.Require().NoError(err)
+	s.Equal("purged 1 dead letters\n", out)
+
+	out, err = s.run("list")
+	s.Require().NoError(err)
+	s.False(strings.Contains(out, "failed first"))
+	s.Contains(out, "failed second")
+}
+
+func (s *AdminTest) TestUsage() {
+	_, err := s.run()
+	s.Equal(admin.ErrUsage, err)
+
+	_, err = s.run("unknown")
+	s.Equal(admin.ErrUsage, err)
+
+	_, err = s.run("replay")
+	s.Equal(admin.ErrUsage, err)
+}
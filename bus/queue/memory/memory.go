@@ -0,0 +1,495 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrClosed indicates a message was published to a closed queue
+	ErrClosed = errors.New("cqrs.queue: queue is closed")
+)
+
+// Config configures a MemoryQueue. Zero values use the same
+// defaults as the SQL queue
+type Config struct {
+	// Workers is the number of messages processed concurrently. Messages with a
+	// partition key are always processed by the same worker, so are processed in order
+	Workers int
+
+	// Buffer is the number of messages that can be pending before Publish blocks
+	Buffer int
+
+	// MaxRetries is how many times a failed message is retried before it is poisoned,
+	// unless its route declares a retry policy. Like bus.DefaultRetryPolicy, client
+	// errors aren't retried
+	MaxRetries int
+
+	// InitialInterval is the delay before the first retry
+	InitialInterval time.Duration
+
+	// Multiplier increases the delay between each retry
+	Multiplier float64
+}
+
+func (c Config) withDefaults() Config {
+	if c.Workers == 0 {
+		c.Workers = 1
+	}
+	if c.Buffer == 0 {
+		c.Buffer = 1024
+	}
+	if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.InitialInterval == 0 {
+		c.InitialInterval = time.Second * 2
+	}
+	if c.Multiplier == 0 {
+		c.Multiplier = 2
+	}
+	return c
+}
+
+// retryPolicy is the policy for messages whose route doesn't declare one
+func (c Config) retryPolicy() bus.RetryPolicy {
+	return bus.RetryPolicy{
+		MaxAttempts:     c.MaxRetries + 1,
+		InitialInterval: c.InitialInterval,
+		Multiplier:      c.Multiplier,
+		NonRetryable:    bus.IsClientError,
+	}
+}
+
+// envelope is a published message. Messages are serialized like the SQL queue's,
+// so messages that can't be sent over a real queue fail in tests too
+type envelope struct {
+	id       string
+	topic    string
+	payload  []byte
+	metadata bus.SerializedContext
+
+	// partition is the message's partition key, if it has one
+	partition string
+
+	// deliverAt delays the message until it's due, if set
+	deliverAt time.Time
+}
+
+var _ bus.ConcurrentQueue = (*MemoryQueue)(nil)
+var _ bus.DeadLetters = (*MemoryQueue)(nil)
+var _ bus.MeasuredQueue = (*MemoryQueue)(nil)
+
+// NewMemoryQueue returns a queue backed by a channel, for tests and
+// single process deployments. Messages are lost when the process exits
+func NewMemoryQueue(c Config) *MemoryQueue {
+	c = c.withDefaults()
+	q := &MemoryQueue{closing: make(chan struct{})}
+	q.configure(c)
+	q.drained = sync.NewCond(&q.mx)
+	return q
+}
+
+func (q *MemoryQueue) configure(c Config) {
+	q.config = c
+	q.messages = make(chan envelope, c.Buffer)
+	q.partitions = make([]chan envelope, c.Workers)
+	for i := range q.partitions {
+		q.partitions[i] = make(chan envelope, c.Buffer)
+	}
+}
+
+// SetConcurrency implements bus.ConcurrentQueue, setting the number of workers,
+// and the number of messages buffered before Publish blocks. Once the queue has
+// been published to or subscribed, its messages are already on their workers'
+// channels, so the change is refused
+func (q *MemoryQueue) SetConcurrency(workers int, prefetch int) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if q.started {
+		log.Warn(context.Background(), "Queue is in use, not changing its concurrency", log.F{
+			"workers":  fmt.Sprint(workers),
+			"prefetch": fmt.Sprint(prefetch),
+		})
+		return
+	}
+	c := q.config
+	if workers > 0 {
+		c.Workers = workers
+	}
+	if prefetch > 0 {
+		c.Buffer = prefetch
+	}
+	q.configure(c)
+}
+
+// MemoryQueue is an in process queue. Messages and context are carried between
+// publisher and subscriber the same way as the SQL queue, so messages must be
+// registered with gob, and only registered context keys survive
+type MemoryQueue struct {
+	config   Config
+	messages chan envelope
+	closing  chan struct{}
+	once     sync.Once
+
+	// partitions hold each worker's partitioned messages, while
+	// messages without a partition key are shared between workers
+	partitions []chan envelope
+
+	mx       sync.Mutex
+	drained  *sync.Cond
+	pending  int
+	poisoned []bus.DeadLetter
+
+	// started is set once the queue is published to or subscribed,
+	// after which its channels can't be replaced
+	started bool
+}
+
+func (q *MemoryQueue) Publish(ctx context.Context, msgs ...message.Message) error {
+	for _, msg := range msgs {
+		id := bus.MessageID(ctx)
+		if id == "" {
+			id = uuid.New().String()
+		}
+		payload, err := bus.SerializeMessage(msg, bus.Gob)
+		if err != nil {
+			return err
+		}
+		err = q.publish(ctx, envelope{
+			id:        id,
+			topic:     bus.Topic(ctx),
+			payload:   payload,
+			metadata:  bus.SerializeContext(ctx),
+			partition: bus.PartitionKey(ctx, msg),
+			deliverAt: bus.DeliverAt(ctx),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *MemoryQueue) publish(ctx context.Context, e envelope) error {
+	select {
+	case <-q.closing:
+		return ErrClosed
+	default:
+	}
+
+	q.mx.Lock()
+	q.pending++
+	q.started = true
+	q.mx.Unlock()
+
+	if delay := time.Until(e.deliverAt); delay > 0 {
+		go q.deliverAfter(e, delay)
+		return nil
+	}
+
+	select {
+	case q.channel(e) <- e:
+		return nil
+	case <-q.closing:
+		q.done()
+		return ErrClosed
+	case <-ctx.Done():
+		q.done()
+		return ctx.Err()
+	}
+}
+
+// deliverAfter queues a delayed message once it's due, unless the queue closes first
+func (q *MemoryQueue) deliverAfter(e envelope, delay time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-q.closing:
+		q.done()
+		return
+	}
+
+	select {
+	case q.channel(e) <- e:
+	case <-q.closing:
+		q.done()
+	}
+}
+
+// channel returns the channel of the worker that processes a message
+func (q *MemoryQueue) channel(e envelope) chan envelope {
+	if e.partition == "" {
+		return q.messages
+	}
+	h := fnv.New32a()
+	h.Write([]byte(e.partition))
+	return q.partitions[h.Sum32()%uint32(len(q.partitions))]
+}
+
+// Subscribe processes messages with the configured number of workers,
+// blocking until the context is cancelled or the queue is closed
+func (q *MemoryQueue) Subscribe(ctx context.Context, fn func(context.Context, message.Message) error) {
+	q.mx.Lock()
+	q.started = true
+	q.mx.Unlock()
+
+	var workers sync.WaitGroup
+	for _, partition := range q.partitions {
+		workers.Add(1)
+		go func(partition chan envelope) {
+			defer workers.Done()
+			q.work(ctx, partition, fn)
+		}(partition)
+	}
+	workers.Wait()
+}
+
+func (q *MemoryQueue) work(ctx context.Context, partition chan envelope, fn func(context.Context, message.Message) error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.closing:
+			return
+		case e := <-partition:
+			q.deliver(ctx, fn, e)
+			q.done()
+		case e := <-q.messages:
+			q.deliver(ctx, fn, e)
+			q.done()
+		}
+	}
+}
+
+// deliver runs a message, retrying with its route's retry policy, and poisons it once the policy gives up
+func (q *MemoryQueue) deliver(ctx context.Context, fn func(context.Context, message.Message) error, e envelope) {
+	started := time.Now()
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = q.process(fn, e)
+		if err == nil {
+			return
+		}
+
+		delay, retry := bus.RetryPolicyOf(err, q.config.retryPolicy()).Next(attempt, time.Since(started), err)
+		if !retry {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+
+	d := bus.DeadLetter{
+		ID:           e.id,
+		Reason:       err.Error(),
+		Topic:        e.topic,
+		Metadata:     e.metadata,
+		PartitionKey: e.partition,
+		FailedAt:     time.Now(),
+	}
+	if d.Message, err = bus.DeserializeMessage(e.payload); err != nil {
+		d.Message, d.Payload = nil, e.payload
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	q.poisoned = append(q.poisoned, d)
+}
+
+func (q *MemoryQueue) process(fn func(context.Context, message.Message) error, e envelope) (err error) {
+	ctx := context.Background()
+	msg, err := bus.DeserializeMessage(e.payload)
+	if err != nil {
+		return log.Error(ctx, fmt.Errorf("Failed receiving message: %w", err), log.F{"id": e.id})
+	}
+	if event, ok := msg.(bus.QueuedEvent); ok {
+		ctx = bus.DeserializeContext(ctx, bus.SerializedContext(event.Event.HasMetadata()))
+	}
+	ctx = bus.DeserializeContext(ctx, e.metadata)
+	ctx = bus.WithMessageID(ctx, e.id)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = log.Error(ctx, fmt.Errorf("Panicked running message: %v", r), log.F{})
+		}
+	}()
+
+	err = fn(ctx, msg)
+	if err != nil {
+		return log.Error(ctx, fmt.Errorf("Failed running message: %w", err), log.F{"id": bus.MessageID(ctx)})
+	}
+	return nil
+}
+
+// done marks a published message as finished
+func (q *MemoryQueue) done() {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.pending--
+	if q.pending == 0 {
+		q.drained.Broadcast()
+	}
+}
+
+// Wait blocks until every published message, including those published
+// while processing and those delayed, has been processed or poisoned.
+// Returns an error if the timeout passes first
+func (q *MemoryQueue) Wait(timeout time.Duration) error {
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	go func() {
+		q.mx.Lock()
+		defer q.mx.Unlock()
+		for q.pending > 0 {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			q.drained.Wait()
+		}
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		close(stop)
+		q.mx.Lock()
+		defer q.mx.Unlock()
+		// Wake the waiter, so it sees it's stopped
+		q.drained.Broadcast()
+		return fmt.Errorf("cqrs.queue: %d messages still pending after %s", q.pending, timeout)
+	}
+}
+
+// Depth implements bus.MeasuredQueue, returning the number of pending messages,
+// including those being processed and those delayed
+func (q *MemoryQueue) Depth(ctx context.Context) (int, error) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return q.pending, nil
+}
+
+// DeadLetters lists the messages that failed all of their retries
+func (q *MemoryQueue) DeadLetters(ctx context.Context, f bus.DeadLetterFilter) ([]bus.DeadLetter, error) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	result := make([]bus.DeadLetter, 0)
+	for _, d := range q.poisoned {
+		if f.Limit > 0 && len(result) == f.Limit {
+			break
+		}
+		if f.Matches(d) {
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+func (q *MemoryQueue) CountDeadLetters(ctx context.Context, f bus.DeadLetterFilter) (int, error) {
+	f.Limit = 0
+	letters, err := q.DeadLetters(ctx, f)
+	return len(letters), err
+}
+
+func (q *MemoryQueue) Replay(ctx context.Context, id string) error {
+	removed := q.remove(func(d bus.DeadLetter) bool {
+		return d.ID == id
+	}, 1)
+	if len(removed) == 0 {
+		return bus.ErrDeadLetterNotFound
+	}
+	err := q.replay(ctx, removed[0])
+	if err != nil {
+		q.restore(removed)
+	}
+	return err
+}
+
+func (q *MemoryQueue) ReplayMatching(ctx context.Context, f bus.DeadLetterFilter) (int, error) {
+	removed := q.remove(f.Matches, f.Limit)
+	for i, d := range removed {
+		err := q.replay(ctx, d)
+		if err != nil {
+			q.restore(removed[i:])
+			return i, err
+		}
+	}
+	return len(removed), nil
+}
+
+func (q *MemoryQueue) PurgeDeadLetters(ctx context.Context, f bus.DeadLetterFilter) (int, error) {
+	return len(q.remove(f.Matches, f.Limit)), nil
+}
+
+func (q *MemoryQueue) replay(ctx context.Context, d bus.DeadLetter) error {
+	payload := d.Payload
+	if d.Message != nil {
+		var err error
+		payload, err = bus.SerializeMessage(d.Message, bus.Gob)
+		if err != nil {
+			return err
+		}
+	}
+	return q.publish(ctx, envelope{id: d.ID, topic: d.Topic, payload: payload, metadata: d.Metadata, partition: d.PartitionKey})
+}
+
+// remove removes up to limit matching dead letters, or all of them if limit is 0
+func (q *MemoryQueue) remove(match func(bus.DeadLetter) bool, limit int) []bus.DeadLetter {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	removed := make([]bus.DeadLetter, 0)
+	kept := make([]bus.DeadLetter, 0, len(q.poisoned))
+	for _, d := range q.poisoned {
+		if match(d) && (limit == 0 || len(removed) < limit) {
+			removed = append(removed, d)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	q.poisoned = kept
+	return removed
+}
+
+// restore puts back dead letters that were removed but not replayed, keeping
+// dead letters in the order they failed
+func (q *MemoryQueue) restore(letters []bus.DeadLetter) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.poisoned = append(q.poisoned, letters...)
+	sort.SliceStable(q.poisoned, func(i, j int) bool {
+		return q.poisoned[i].FailedAt.Before(q.poisoned[j].FailedAt)
+	})
+}
+
+// Close stops the queue's subscribers. Pending messages are dropped
+func (q *MemoryQueue) Close() {
+	q.once.Do(func() {
+		close(q.closing)
+	})
+}
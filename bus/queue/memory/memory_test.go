@@ -0,0 +1,362 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	cqrsErrs "github.com/GabrielCarpr/cqrs/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+type testCmd struct {
+	bus.CommandType
+
+	Result string
+}
+
+func (testCmd) Command() string {
+	return "testcmd"
+}
+
+func (testCmd) Valid() error {
+	return nil
+}
+
+type testEvent struct {
+	bus.EventType
+
+	Sequence int
+}
+
+func (testEvent) Event() string {
+	return "testevent"
+}
+
+func TestMemoryQueue(t *testing.T) {
+	bus.RegisterMessage(testCmd{})
+	bus.RegisterMessage(bus.QueuedEvent{})
+	bus.RegisterMessage(&testEvent{})
+	suite.Run(t, new(MemoryQueueTest))
+}
+
+type MemoryQueueTest struct {
+	suite.Suite
+
+	queue  *memory.MemoryQueue
+	cancel context.CancelFunc
+}
+
+func (s *MemoryQueueTest) SetupTest() {
+	s.queue = memory.NewMemoryQueue(memory.Config{
+		Workers:         4,
+		MaxRetries:      2,
+		InitialInterval: time.Millisecond,
+	})
+}
+
+func (s *MemoryQueueTest) TearDownTest() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.queue.Close()
+}
+
+func (s *MemoryQueueTest) subscribe(fn func(context.Context, message.Message) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	go s.queue.Subscribe(ctx, fn)
+}
+
+func (s *MemoryQueueTest) TestPublishesAndSubscribes() {
+	var mx sync.Mutex
+	results := make(map[string]string)
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		mx.Lock()
+		defer mx.Unlock()
+		results[msg.(testCmd).Result] = bus.MessageID(ctx)
+		return nil
+	})
+
+	s.Require().NoError(s.queue.Publish(bus.WithMessageID(context.Background(), "1"), testCmd{Result: "first"}))
+	s.Require().NoError(s.queue.Publish(bus.WithMessageID(context.Background(), "2"), testCmd{Result: "second"}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+
+	s.Equal(map[string]string{"first": "1", "second": "2"}, results)
+}
+
+func (s *MemoryQueueTest) TestWaitsForMessagesPublishedWhileProcessing() {
+	var processed int32
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		atomic.AddInt32(&processed, 1)
+		if msg.(testCmd).Result == "first" {
+			time.Sleep(time.Millisecond * 10)
+			return s.queue.Publish(ctx, testCmd{Result: "second"})
+		}
+		return nil
+	})
+
+	s.Require().NoError(s.queue.Publish(context.Background(), testCmd{Result: "first"}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+	s.Equal(int32(2), atomic.LoadInt32(&processed))
+}
+
+func (s *MemoryQueueTest) TestKeepsConcurrencyOncePublished() {
+	ctx := bus.WithPartitionKey(context.Background(), "a")
+	s.Require().NoError(s.queue.Publish(ctx, testCmd{Result: "first"}))
+	s.queue.SetConcurrency(1, 1)
+
+	received := make(chan string, 2)
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		received <- msg.(testCmd).Result
+		return nil
+	})
+	s.Require().NoError(s.queue.Publish(ctx, testCmd{Result: "second"}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+
+	s.Equal("first", <-received)
+	s.Equal("second", <-received)
+}
+
+func (s *MemoryQueueTest) TestDelaysMessages() {
+	received := make(chan string, 2)
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		received <- msg.(testCmd).Result
+		return nil
+	})
+
+	published := time.Now()
+	s.Require().NoError(s.queue.Publish(bus.WithDeliverAt(context.Background(), published.Add(time.Millisecond*50)), testCmd{Result: "delayed"}))
+	s.Require().NoError(s.queue.Publish(context.Background(), testCmd{Result: "immediate"}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+
+	s.GreaterOrEqual(int64(time.Since(published)), int64(time.Millisecond*50))
+	s.Equal("immediate", <-received)
+	s.Equal("delayed", <-received)
+}
+
+func (s *MemoryQueueTest) TestProcessesPartitionsInOrder() {
+	var mx sync.Mutex
+	received := make(map[string][]int)
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		e := msg.(bus.QueuedEvent).Event
+		time.Sleep(time.Microsecond * time.Duration(e.(*testEvent).Sequence%3*100))
+		mx.Lock()
+		defer mx.Unlock()
+		received[e.Owned()] = append(received[e.Owned()], e.(*testEvent).Sequence)
+		return nil
+	})
+
+	owners := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 20; i++ {
+		for _, owner := range owners {
+			e := &testEvent{Sequence: i}
+			e.OwnedBy(owner)
+			s.Require().NoError(s.queue.Publish(context.Background(), bus.QueuedEvent{Event: e}))
+		}
+	}
+	s.Require().NoError(s.queue.Wait(time.Second * 5))
+
+	for _, owner := range owners {
+		s.Require().Len(received[owner], 20)
+		for i, sequence := range received[owner] {
+			s.Equal(i, sequence, "aggregate %s processed out of order", owner)
+		}
+	}
+}
+
+func (s *MemoryQueueTest) TestRetriesFailedMessages() {
+	var attempts int32
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	s.Require().NoError(s.queue.Publish(context.Background(), testCmd{}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+	s.Equal(int32(3), atomic.LoadInt32(&attempts))
+	count, err := s.queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	s.Require().NoError(err)
+	s.Zero(count)
+}
+
+func (s *MemoryQueueTest) TestPoisonsMessagesAfterRetries() {
+	var attempts int32
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		atomic.AddInt32(&attempts, 1)
+		panic("failed")
+	})
+
+	s.Require().NoError(s.queue.Publish(bus.WithMessageID(context.Background(), "1"), testCmd{Result: "poison"}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+	s.Equal(int32(3), atomic.LoadInt32(&attempts))
+
+	poisoned, err := s.queue.DeadLetters(context.Background(), bus.DeadLetterFilter{})
+	s.Require().NoError(err)
+	s.Require().Len(poisoned, 1)
+	s.Equal("1", poisoned[0].ID)
+	s.Equal("testcmd", poisoned[0].Name())
+	s.Equal(testCmd{Result: "poison"}, poisoned[0].Message)
+	s.Equal("1", poisoned[0].Metadata[bus.MessageIDKey.String()])
+	s.Contains(poisoned[0].Reason, "failed")
+}
+
+func (s *MemoryQueueTest) TestReplaysDeadLetters() {
+	var fail int32 = 1
+	var mx sync.Mutex
+	handled := make([]string, 0)
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		if atomic.LoadInt32(&fail) == 1 {
+			return errors.New("failed")
+		}
+		mx.Lock()
+		defer mx.Unlock()
+		handled = append(handled, bus.MessageID(ctx))
+		return nil
+	})
+
+	for _, id := range []string{"1", "2", "3"} {
+		s.Require().NoError(s.queue.Publish(bus.WithMessageID(context.Background(), id), testCmd{}))
+	}
+	s.Require().NoError(s.queue.Wait(time.Second))
+	atomic.StoreInt32(&fail, 0)
+
+	s.Require().NoError(s.queue.Replay(context.Background(), "2"))
+	s.Require().NoError(s.queue.Wait(time.Second))
+	s.Equal([]string{"2"}, handled)
+	s.Equal(bus.ErrDeadLetterNotFound, s.queue.Replay(context.Background(), "2"))
+
+	replayed, err := s.queue.ReplayMatching(context.Background(), bus.DeadLetterFilter{Name: "testcmd", Limit: 1})
+	s.Require().NoError(err)
+	s.Equal(1, replayed)
+	s.Require().NoError(s.queue.Wait(time.Second))
+	s.Len(handled, 2)
+
+	count, err := s.queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	s.Require().NoError(err)
+	s.Equal(1, count)
+}
+
+func (s *MemoryQueueTest) TestClientErrorsAreNotRetried() {
+	var invocations int32
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		atomic.AddInt32(&invocations, 1)
+		return cqrsErrs.NotFound
+	})
+	s.Require().NoError(s.queue.Publish(context.Background(), testCmd{}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+
+	s.Equal(int32(1), atomic.LoadInt32(&invocations))
+	count, err := s.queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	s.Require().NoError(err)
+	s.Equal(1, count)
+}
+
+type unregisteredCmd struct {
+	bus.CommandType
+}
+
+func (unregisteredCmd) Command() string {
+	return "unregistered"
+}
+
+func (unregisteredCmd) Valid() error {
+	return nil
+}
+
+func (s *MemoryQueueTest) TestSerializesMessages() {
+	received := make(chan testCmd, 1)
+	sent := testCmd{Result: "copied"}
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		received <- msg.(testCmd)
+		return nil
+	})
+
+	s.Require().NoError(s.queue.Publish(context.Background(), sent))
+	s.Equal(sent, <-received)
+
+	err := s.queue.Publish(context.Background(), unregisteredCmd{})
+	s.Require().Error(err)
+	s.Contains(err.Error(), "not registered")
+}
+
+func (s *MemoryQueueTest) TestWaitTimeoutStopsWaiting() {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		close(started)
+		<-release
+		return nil
+	})
+	s.Require().NoError(s.queue.Publish(context.Background(), testCmd{}))
+	<-started
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		s.Error(s.queue.Wait(time.Millisecond))
+	}
+	// Eventually checks its condition in a goroutine of its own, so poll instead
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	s.LessOrEqual(runtime.NumGoroutine(), before, "Wait leaked its waiters")
+	close(release)
+}
+
+func (s *MemoryQueueTest) TestFailedReplaysKeepDeadLetters() {
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		return errors.New("failed")
+	})
+	for _, id := range []string{"1", "2"} {
+		s.Require().NoError(s.queue.Publish(bus.WithMessageID(context.Background(), id), testCmd{}))
+	}
+	s.Require().NoError(s.queue.Wait(time.Second))
+	s.queue.Close()
+
+	s.Equal(memory.ErrClosed, s.queue.Replay(context.Background(), "1"))
+	replayed, err := s.queue.ReplayMatching(context.Background(), bus.DeadLetterFilter{})
+	s.Equal(memory.ErrClosed, err)
+	s.Equal(0, replayed)
+
+	count, err := s.queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	s.Require().NoError(err)
+	s.Equal(2, count)
+}
+
+func (s *MemoryQueueTest) TestPurgesDeadLetters() {
+	s.subscribe(func(ctx context.Context, msg message.Message) error {
+		return errors.New("failed")
+	})
+	s.Require().NoError(s.queue.Publish(bus.WithTopic(context.Background(), "slow"), testCmd{}))
+	s.Require().NoError(s.queue.Publish(context.Background(), testCmd{}))
+	s.Require().NoError(s.queue.Wait(time.Second))
+
+	purged, err := s.queue.PurgeDeadLetters(context.Background(), bus.DeadLetterFilter{Topic: "slow"})
+	s.Require().NoError(err)
+	s.Equal(1, purged)
+
+	remaining, err := s.queue.DeadLetters(context.Background(), bus.DeadLetterFilter{})
+	s.Require().NoError(err)
+	s.Require().Len(remaining, 1)
+	s.Equal("", remaining[0].Topic)
+}
+
+func (s *MemoryQueueTest) TestWaitTimesOut() {
+	s.Require().NoError(s.queue.Publish(context.Background(), testCmd{}))
+	s.Error(s.queue.Wait(time.Millisecond * 10))
+}
+
+func (s *MemoryQueueTest) TestPublishAfterClose() {
+	s.queue.Close()
+	s.Equal(memory.ErrClosed, s.queue.Publish(context.Background(), testCmd{}))
+}
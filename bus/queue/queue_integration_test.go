@@ -3,11 +3,15 @@
 package queue_test
 
 import (
+	stdSQL "database/sql"
 	"encoding/gob"
+	"errors"
 	"github.com/GabrielCarpr/cqrs/bus"
 	"github.com/GabrielCarpr/cqrs/bus/message"
 	"github.com/GabrielCarpr/cqrs/bus/queue/sql"
 	"github.com/GabrielCarpr/cqrs/log"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"context"
@@ -105,3 +109,374 @@ func (s QueueIntegrationTest) TestPublishesAndSubscribes() {
 	s.Equal("test", result)
 	s.NotEqual(idResult, uuid.Nil)
 }
+
+func TestSQLQueueTopics(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	gob.Register(testCmd{})
+	c := TestConfig
+	c.Topics = map[string]sql.TopicConfig{"slow": {Workers: 2}}
+	queue := sql.NewSQLQueue(c)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan string, 4)
+	go queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+		results <- msg.(testCmd).Result
+		return nil
+	})
+
+	err := queue.Publish(bus.WithTopic(context.Background(), "slow"), testCmd{Result: "slow"}, testCmd{Result: "slow"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = queue.Publish(context.Background(), testCmd{Result: "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		select {
+		case r := <-results:
+			received[r]++
+		case <-time.After(time.Second * 5):
+			t.Fatal("Timed out")
+		}
+	}
+	if received["slow"] != 2 || received["default"] != 1 {
+		t.Errorf("unexpected messages received: %v", received)
+	}
+}
+
+func TestSQLQueueDeadLetters(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	defer sql.ResetSQLDB(TestConfig.DBDsn())
+	gob.Register(testCmd{})
+	queue := sql.NewSQLQueue(TestConfig)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan string, 1)
+	go queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+		if msg.(testCmd).Result == "fail" {
+			return errors.New("failed")
+		}
+		results <- bus.MessageID(ctx)
+		return nil
+	})
+
+	err := queue.Publish(bus.WithMessageID(context.Background(), uuid.New().String()), testCmd{Result: "fail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var letters []bus.DeadLetter
+	for deadline := time.Now().Add(time.Second * 30); len(letters) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out")
+		}
+		time.Sleep(time.Millisecond * 500)
+		letters, err = queue.DeadLetters(context.Background(), bus.DeadLetterFilter{Name: "testcmd"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if letters[0].Reason != "failed" || letters[0].Topic != sql.DefaultTopic {
+		t.Errorf("unexpected dead letter: %+v", letters[0])
+	}
+
+	err = queue.Replay(context.Background(), "missing")
+	if err != bus.ErrDeadLetterNotFound {
+		t.Errorf("expected ErrDeadLetterNotFound, got %v", err)
+	}
+
+	n, err := queue.PurgeDeadLetters(context.Background(), bus.DeadLetterFilter{Topic: "other"})
+	if err != nil || n != 0 {
+		t.Errorf("purged %d dead letters from another topic: %v", n, err)
+	}
+
+	count, err := queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	if err != nil || count != 1 {
+		t.Errorf("expected 1 dead letter, got %d: %v", count, err)
+	}
+}
+
+func TestSQLQueueRetriesWithoutRedelivering(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	defer sql.ResetSQLDB(TestConfig.DBDsn())
+	gob.Register(testCmd{})
+	c := TestConfig
+	c.Retry = &bus.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond * 200}
+	queue := sql.NewSQLQueue(c)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var invocations int32
+	go queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+		atomic.AddInt32(&invocations, 1)
+		return errors.New("failed")
+	})
+
+	err := queue.Publish(context.Background(), testCmd{Result: "fail"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(time.Second * 10); ; {
+		count, err := queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+		if err == nil && count == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a dead letter, got %d: %v", count, err)
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	time.Sleep(time.Second)
+
+	if n := atomic.LoadInt32(&invocations); n != 3 {
+		t.Errorf("expected the handler to run 3 times, ran %d times", n)
+	}
+	count, err := queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	if err != nil || count != 1 {
+		t.Errorf("expected 1 dead letter, got %d: %v", count, err)
+	}
+}
+
+func TestSQLQueueKeepsOrderWhileRetrying(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	defer sql.ResetSQLDB(TestConfig.DBDsn())
+	gob.Register(testCmd{})
+	c := TestConfig
+	c.Retry = &bus.RetryPolicy{MaxAttempts: 3, InitialInterval: time.Millisecond * 200}
+	c.Topics = map[string]sql.TopicConfig{sql.DefaultTopic: {Workers: 2}}
+	queue := sql.NewSQLQueue(c)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var failures int32
+	results := make(chan string, 6)
+	go queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+		result := msg.(testCmd).Result
+		if result == "1" && atomic.AddInt32(&failures, 1) < 3 {
+			return errors.New("failed")
+		}
+		results <- result
+		return nil
+	})
+
+	keyed := bus.WithPartitionKey(context.Background(), "user-1")
+	err := queue.Publish(keyed, testCmd{Result: "1"}, testCmd{Result: "2"}, testCmd{Result: "3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make([]string, 0)
+	for len(received) < 3 {
+		select {
+		case r := <-results:
+			received = append(received, r)
+		case <-time.After(time.Second * 10):
+			t.Fatalf("Timed out, received %v", received)
+		}
+	}
+	select {
+	case r := <-results:
+		t.Errorf("message %s was handled twice", r)
+	case <-time.After(time.Second):
+	}
+	if received[0] != "1" || received[1] != "2" || received[2] != "3" {
+		t.Errorf("expected messages in order, received %v", received)
+	}
+}
+
+func TestSQLQueueUndecodableDeadLetters(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	defer sql.ResetSQLDB(TestConfig.DBDsn())
+	queue := sql.NewSQLQueue(TestConfig)
+	defer queue.Close()
+
+	db, err := stdSQL.Open("postgres", TestConfig.DBDsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	schema := sql.PostgreSQLSchema{}
+	for _, query := range schema.SchemaInitializingQueries(sql.FailureTopic) {
+		if _, err := db.Exec(query); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = db.Exec(`INSERT INTO `+schema.MessagesTable(sql.FailureTopic)+` (uuid, payload, metadata)
+		VALUES ($1, $2, '{"reason_poisoned": "Failed receiving message"}')`, uuid.New().String(), []byte("garbage"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	letters, err := queue.DeadLetters(context.Background(), bus.DeadLetterFilter{})
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %v: %v", letters, err)
+	}
+	if letters[0].Message != nil || string(letters[0].Payload) != "garbage" {
+		t.Errorf("unexpected dead letter: %+v", letters[0])
+	}
+
+	count, err := queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	if err != nil || count != 1 {
+		t.Errorf("expected 1 dead letter, got %d: %v", count, err)
+	}
+	n, err := queue.PurgeDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	if err != nil || n != 1 {
+		t.Errorf("expected 1 dead letter purged, got %d: %v", n, err)
+	}
+}
+
+func TestSQLQueueDelays(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	defer sql.ResetSQLDB(TestConfig.DBDsn())
+	gob.Register(testCmd{})
+	c := TestConfig
+	c.ScheduleInterval = time.Millisecond * 100
+	queue := sql.NewSQLQueue(c)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := make(chan string, 2)
+	go queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+		results <- msg.(testCmd).Result
+		return nil
+	})
+
+	published := time.Now()
+	err := queue.Publish(bus.WithDeliverAt(context.Background(), published.Add(time.Second)), testCmd{Result: "delayed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = queue.Publish(context.Background(), testCmd{Result: "immediate"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"immediate", "delayed"} {
+		select {
+		case r := <-results:
+			if r != expected {
+				t.Errorf("expected %s, received %s", expected, r)
+			}
+		case <-time.After(time.Second * 10):
+			t.Fatal("Timed out")
+		}
+	}
+	if time.Since(published) < time.Second {
+		t.Error("delayed message was delivered early")
+	}
+}
+
+func TestSQLQueueDepth(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	defer sql.ResetSQLDB(TestConfig.DBDsn())
+	gob.Register(testCmd{})
+	queue := sql.NewSQLQueue(TestConfig)
+	defer queue.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	release := make(chan struct{})
+	go queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+		<-release
+		return nil
+	})
+
+	err := queue.Publish(bus.WithDeliverAt(context.Background(), time.Now().Add(time.Hour)), testCmd{Result: "delayed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = queue.Publish(context.Background(), testCmd{Result: "blocked"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(time.Second * 10); ; {
+		depth, err := queue.Depth(context.Background())
+		if err == nil && depth == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a depth of 2, got %d: %v", depth, err)
+		}
+		time.Sleep(time.Millisecond * 100)
+	}
+	close(release)
+}
+
+func TestSQLQueueChangesWorkers(t *testing.T) {
+	sql.ResetSQLDB(TestConfig.DBDsn())
+	defer sql.ResetSQLDB(TestConfig.DBDsn())
+	gob.Register(testCmd{})
+	db, err := stdSQL.Open("postgres", TestConfig.DBDsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	consume := func(workers int, results ...string) []string {
+		c := TestConfig
+		c.Topics = map[string]sql.TopicConfig{sql.DefaultTopic: {Workers: workers}}
+		queue := sql.NewSQLQueue(c)
+		defer queue.Close()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		received := make(chan string, 20)
+		go queue.Subscribe(ctx, func(ctx context.Context, msg message.Message) error {
+			received <- msg.(testCmd).Result
+			return nil
+		})
+
+		for _, result := range results {
+			if err := queue.Publish(context.Background(), testCmd{Result: result}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		handled := make(map[string]bool)
+		for len(handled) < len(results) {
+			select {
+			case r := <-received:
+				handled[r] = true
+			case <-time.After(time.Second * 10):
+				t.Fatalf("Timed out, handled %v", handled)
+			}
+		}
+
+		groups := make([]string, 0)
+		rows, err := db.Query(`SELECT consumer_group FROM watermill_offsets_messages ORDER BY consumer_group`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var group string
+			if err := rows.Scan(&group); err != nil {
+				t.Fatal(err)
+			}
+			groups = append(groups, group)
+		}
+		return groups
+	}
+
+	groups := consume(3, "1", "2", "3", "4", "5", "6")
+	for _, group := range groups {
+		if !strings.HasSuffix(group, "-of-3") {
+			t.Errorf("unexpected consumer group %s", group)
+		}
+	}
+
+	groups = consume(2, "7", "8", "9", "10")
+	if len(groups) != 2 || groups[0] != "worker-0-of-2" || groups[1] != "worker-1-of-2" {
+		t.Errorf("expected only the 2 workers' consumer groups, got %v", groups)
+	}
+}
@@ -1,12 +1,35 @@
 package sql
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+)
 
 type Config struct {
 	DBName string
 	DBHost string
 	DBUser string
 	DBPass string
+
+	// Topic chooses the topic each message is published to.
+	// Defaults to ByRoute(SingleTopic)
+	Topic TopicFunc
+
+	// Topics configures the subscription to each topic. Publishing to a topic that
+	// isn't configured returns ErrUnknownTopic, as nothing would consume it, so every
+	// topic the Topic func chooses must be configured. DefaultTopic is always
+	// subscribed to, with one worker unless configured otherwise
+	Topics map[string]TopicConfig
+
+	// Retry is the retry policy for messages whose route doesn't declare one.
+	// Defaults to bus.DefaultRetryPolicy
+	Retry *bus.RetryPolicy
+
+	// ScheduleInterval is how often delayed messages are checked, and
+	// moved onto their topic once they're due. Defaults to 1 second
+	ScheduleInterval time.Duration
 }
 
 func (c Config) DBDsn() string {
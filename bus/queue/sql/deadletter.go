@@ -0,0 +1,222 @@
+package sql
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/ThreeDotsLabs/watermill-sql/pkg/sql"
+	wmMessage "github.com/ThreeDotsLabs/watermill/message"
+	"github.com/ThreeDotsLabs/watermill/message/router/middleware"
+)
+
+var _ bus.DeadLetters = (*SQLQueue)(nil)
+
+// poisonMetadata is the metadata added to messages when they're moved to FailureTopic
+var poisonMetadata = []string{
+	middleware.ReasonForPoisonedKey,
+	middleware.PoisonedTopicKey,
+	middleware.PoisonedHandlerKey,
+	middleware.PoisonedSubscriberKey,
+}
+
+// failure is a row of the failures topic
+type failure struct {
+	offset     int64
+	message    *wmMessage.Message
+	deadLetter bus.DeadLetter
+}
+
+type querier interface {
+	QueryContext(context.Context, string, ...interface{}) (*stdSQL.Rows, error)
+}
+
+// filterFailures returns the condition selecting the failures matched by a filter,
+// and its arguments
+func filterFailures(f bus.DeadLetterFilter) (string, []interface{}) {
+	return `($1 = '' OR metadata->>'` + middleware.PoisonedTopicKey + `' = $1)
+		AND ($2 = '' OR metadata->>'` + nameMetadata + `' = $2)`, []interface{}{f.Topic, f.Name}
+}
+
+// failures selects the messages in the failures topic matching a condition, oldest
+// first. A message that can't be deserialized is still selected, with its payload
+func (q *SQLQueue) failures(ctx context.Context, db querier, where string, args []interface{}, limit int, lock string) ([]failure, error) {
+	query := `SELECT "offset", uuid, created_at, payload, metadata
+		FROM ` + PostgreSQLSchema{}.MessagesTable(FailureTopic) + `
+		WHERE ` + where + `
+		ORDER BY "offset" ASC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := db.QueryContext(ctx, query+" "+lock, args...)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return []failure{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]failure, 0)
+	for rows.Next() {
+		var offset int64
+		var id string
+		var at time.Time
+		var payload, metadata []byte
+		err = rows.Scan(&offset, &id, &at, &payload, &metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		msg := wmMessage.NewMessage(id, payload)
+		if err := json.Unmarshal(metadata, &msg.Metadata); err != nil {
+			log.Warn(ctx, "failed decoding dead letter metadata", log.F{"id": id, "error": err.Error()})
+		}
+
+		serialized := make(bus.SerializedContext)
+		for key, val := range msg.Metadata {
+			serialized[key] = val
+		}
+		for _, key := range append(poisonMetadata, partitionMetadata, nameMetadata) {
+			delete(serialized, key)
+		}
+
+		d := bus.DeadLetter{
+			ID:           id,
+			Reason:       msg.Metadata.Get(middleware.ReasonForPoisonedKey),
+			Topic:        msg.Metadata.Get(middleware.PoisonedTopicKey),
+			Metadata:     serialized,
+			PartitionKey: msg.Metadata.Get(partitionMetadata),
+			FailedAt:     at,
+		}
+		if d.Message, err = bus.DeserializeMessage(payload); err != nil {
+			d.Message, d.Payload = nil, payload
+		}
+		result = append(result, failure{offset: offset, message: msg, deadLetter: d})
+	}
+	return result, rows.Err()
+}
+
+// DeadLetters lists the messages in the failures topic
+func (q *SQLQueue) DeadLetters(ctx context.Context, f bus.DeadLetterFilter) ([]bus.DeadLetter, error) {
+	where, args := filterFailures(f)
+	failures, err := q.failures(ctx, q.db, where, args, f.Limit, "")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]bus.DeadLetter, len(failures))
+	for i, failure := range failures {
+		result[i] = failure.deadLetter
+	}
+	return result, nil
+}
+
+func (q *SQLQueue) CountDeadLetters(ctx context.Context, f bus.DeadLetterFilter) (int, error) {
+	where, args := filterFailures(f)
+	var count int
+	err := q.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+PostgreSQLSchema{}.MessagesTable(FailureTopic)+`
+		WHERE `+where, args...).Scan(&count)
+	if err != nil && strings.Contains(err.Error(), "does not exist") {
+		return 0, nil
+	}
+	return count, err
+}
+
+func (q *SQLQueue) Replay(ctx context.Context, id string) error {
+	replayed, err := q.inTx(ctx, func(tx *stdSQL.Tx) (int, error) {
+		failures, err := q.failures(ctx, tx, "uuid = $1", []interface{}{id}, 1, "FOR UPDATE")
+		if err != nil || len(failures) == 0 {
+			return 0, err
+		}
+		return 1, q.replay(ctx, tx, failures[0])
+	})
+	if err == nil && replayed == 0 {
+		return bus.ErrDeadLetterNotFound
+	}
+	return err
+}
+
+func (q *SQLQueue) ReplayMatching(ctx context.Context, f bus.DeadLetterFilter) (int, error) {
+	return q.inTx(ctx, func(tx *stdSQL.Tx) (int, error) {
+		where, args := filterFailures(f)
+		failures, err := q.failures(ctx, tx, where, args, f.Limit, "FOR UPDATE")
+		if err != nil {
+			return 0, err
+		}
+		for _, failure := range failures {
+			err = q.replay(ctx, tx, failure)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return len(failures), nil
+	})
+}
+
+func (q *SQLQueue) PurgeDeadLetters(ctx context.Context, f bus.DeadLetterFilter) (int, error) {
+	return q.inTx(ctx, func(tx *stdSQL.Tx) (int, error) {
+		where, args := filterFailures(f)
+		failures, err := q.failures(ctx, tx, where, args, f.Limit, "FOR UPDATE")
+		if err != nil {
+			return 0, err
+		}
+		for _, failure := range failures {
+			err = q.deleteFailure(ctx, tx, failure)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return len(failures), nil
+	})
+}
+
+// replay publishes a failure back onto its original topic, keeping its ID, and deletes it
+func (q *SQLQueue) replay(ctx context.Context, tx *stdSQL.Tx, f failure) error {
+	publisher, err := sql.NewPublisher(tx, sql.PublisherConfig{SchemaAdapter: PostgreSQLSchema{}}, q.logger)
+	if err != nil {
+		return err
+	}
+
+	msg := wmMessage.NewMessage(f.message.UUID, f.message.Payload)
+	for key, val := range f.message.Metadata {
+		msg.Metadata.Set(key, val)
+	}
+	for _, key := range poisonMetadata {
+		delete(msg.Metadata, key)
+	}
+
+	topic := f.deadLetter.Topic
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	err = publisher.Publish(topic, msg)
+	if err != nil {
+		return err
+	}
+	return q.deleteFailure(ctx, tx, f)
+}
+
+func (q *SQLQueue) deleteFailure(ctx context.Context, tx *stdSQL.Tx, f failure) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM `+PostgreSQLSchema{}.MessagesTable(FailureTopic)+`
+		WHERE "offset" = $1`, f.offset)
+	return err
+}
+
+func (q *SQLQueue) inTx(ctx context.Context, fn func(*stdSQL.Tx) (int, error)) (int, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, err := fn(tx)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
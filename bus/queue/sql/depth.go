@@ -0,0 +1,54 @@
+package sql
+
+import (
+	"context"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/ThreeDotsLabs/watermill-sql/pkg/sql"
+)
+
+var _ bus.MeasuredQueue = (*SQLQueue)(nil)
+
+// Depth implements bus.MeasuredQueue, returning the number of messages in the subscribed
+// topics that their workers haven't acknowledged, and the scheduled messages
+func (q *SQLQueue) Depth(ctx context.Context) (int, error) {
+	var scheduled int
+	err := q.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+scheduledTable).Scan(&scheduled)
+	if err != nil {
+		return 0, err
+	}
+
+	depth := scheduled
+	for topic, conf := range q.topics {
+		if conf.PublishOnly {
+			continue
+		}
+		for worker := 0; worker < conf.Workers; worker++ {
+			waiting, err := q.partitionDepth(ctx, topic, worker, conf.Workers)
+			if err != nil {
+				return 0, err
+			}
+			depth += waiting
+		}
+	}
+	return depth, nil
+}
+
+// partitionDepth returns the number of messages in a worker's partition it hasn't
+// acknowledged. Workers only acknowledge their own partition's messages, so each
+// partition is counted from its own worker's offset
+func (q *SQLQueue) partitionDepth(ctx context.Context, topic string, worker, workers int) (int, error) {
+	condition := "TRUE"
+	if workers > 1 {
+		condition = partitionCondition(worker, workers)
+	}
+
+	var waiting int
+	err := q.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+PostgreSQLSchema{}.MessagesTable(topic)+`
+		WHERE "offset" > COALESCE((SELECT offset_acked FROM `+sql.DefaultPostgreSQLOffsetsAdapter{}.MessagesOffsetsTable(topic)+`
+			WHERE consumer_group = $1), 0)
+		AND `+condition,
+		consumerGroup(worker, workers),
+	).Scan(&waiting)
+	return waiting, err
+}
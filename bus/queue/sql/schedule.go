@@ -0,0 +1,150 @@
+package sql
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/ThreeDotsLabs/watermill-sql/pkg/sql"
+	wmMessage "github.com/ThreeDotsLabs/watermill/message"
+)
+
+// scheduledTable holds messages published with a delivery time until they're due.
+// watermill's subscribers consume topics in offset order, so delayed messages
+// can't wait in the topic itself
+const scheduledTable = "scheduled_messages"
+
+// schedule stores a message to be moved onto its topic at a later time
+func (q *SQLQueue) schedule(ctx context.Context, topic string, at time.Time, msg *wmMessage.Message) error {
+	metadata, err := json.Marshal(msg.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.db.ExecContext(ctx, `INSERT INTO `+scheduledTable+`
+		(uuid, topic, payload, metadata, deliver_after) VALUES ($1, $2, $3, $4, $5)`,
+		msg.UUID, topic, msg.Payload, metadata, at)
+	return err
+}
+
+// runSchedule moves due messages onto their topics until the context is cancelled
+func (q *SQLQueue) runSchedule(ctx context.Context) {
+	ticker := time.NewTicker(q.scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			moved, err := q.moveDue(ctx)
+			if err != nil {
+				log.Error(ctx, "failed moving scheduled messages", log.F{"error": err.Error()})
+			}
+			if err != nil || !moved {
+				break
+			}
+		}
+	}
+}
+
+// moveDue publishes a batch of due messages onto their topics, and deletes them,
+// in one transaction. Returns whether any messages were moved
+func (q *SQLQueue) moveDue(ctx context.Context) (bool, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT "offset", uuid, topic, payload, metadata FROM `+scheduledTable+`
+		WHERE deliver_after <= NOW()
+		ORDER BY deliver_after ASC, "offset" ASC
+		LIMIT 100
+		FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		return false, err
+	}
+
+	type scheduled struct {
+		offset int64
+		topic  string
+		msg    *wmMessage.Message
+	}
+	due := make([]scheduled, 0)
+	for rows.Next() {
+		var s scheduled
+		var id string
+		var payload, metadata []byte
+		err = rows.Scan(&s.offset, &id, &s.topic, &payload, &metadata)
+		if err != nil {
+			rows.Close()
+			return false, err
+		}
+		s.msg = wmMessage.NewMessage(id, payload)
+		err = json.Unmarshal(metadata, &s.msg.Metadata)
+		if err != nil {
+			rows.Close()
+			return false, err
+		}
+		due = append(due, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil || len(due) == 0 {
+		return false, err
+	}
+
+	publisher, err := sql.NewPublisher(tx, sql.PublisherConfig{SchemaAdapter: PostgreSQLSchema{}}, q.logger)
+	if err != nil {
+		return false, err
+	}
+	for _, s := range due {
+		err = q.initializeTopic(s.topic)
+		if err != nil {
+			return false, err
+		}
+		err = publisher.Publish(s.topic, s.msg)
+		if err != nil {
+			return false, err
+		}
+		_, err = tx.ExecContext(ctx, `DELETE FROM `+scheduledTable+` WHERE "offset" = $1`, s.offset)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return true, tx.Commit()
+}
+
+// initializeTopic creates a topic's table, as publishers in a transaction can't
+func (q *SQLQueue) initializeTopic(topic string) error {
+	for _, query := range (PostgreSQLSchema{}).SchemaInitializingQueries(topic) {
+		_, err := q.db.Exec(query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func initializeSchedule(db *stdSQL.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + scheduledTable + ` (
+		"offset" BIGSERIAL PRIMARY KEY,
+		"uuid" VARCHAR(36) NOT NULL,
+		"topic" VARCHAR(255) NOT NULL,
+		"payload" BYTEA NOT NULL,
+		"metadata" JSON NOT NULL,
+		"deliver_after" TIMESTAMPTZ NOT NULL
+	);`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS scheduled_messages_deliver_after
+		ON ` + scheduledTable + ` (deliver_after)`)
+	return err
+}
@@ -28,6 +28,32 @@ func (s PostgreSQLSchema) SchemaInitializingQueries(topic string) []string {
 	return []string{createMessagesTable}
 }
 
+// partitionedSchema selects only the messages in one of a topic's workers' partition
+type partitionedSchema struct {
+	PostgreSQLSchema
+
+	worker  int
+	workers int
+}
+
+func (s partitionedSchema) SelectQuery(topic string, consumerGroup string, offsetsAdapter wmSql.OffsetsAdapter) (string, []interface{}) {
+	if s.workers < 2 {
+		return s.PostgreSQLSchema.SelectQuery(topic, consumerGroup, offsetsAdapter)
+	}
+
+	nextOffsetQuery, nextOffsetArgs := offsetsAdapter.NextOffsetQuery(topic, consumerGroup)
+	selectQuery := `
+		SELECT "offset", uuid, payload, metadata FROM ` + s.MessagesTable(topic) + `
+		WHERE
+			"offset" > (` + nextOffsetQuery + `)
+			AND ` + partitionCondition(s.worker, s.workers) + `
+		ORDER BY
+			"offset" ASC
+		LIMIT 1`
+
+	return selectQuery, nextOffsetArgs
+}
+
 func ResetSQLDB(dsn string) {
 	log.Print("Resetting SQL queue database")
 	db, err := stdSQL.Open("postgres", dsn)
@@ -35,8 +61,26 @@ func ResetSQLDB(dsn string) {
 		panic(err)
 	}
 
-	_, err = db.Exec("DELETE FROM watermill_messages")
-	if err != nil && !strings.Contains(err.Error(), "does not exist") {
+	rows, err := db.Query(`SELECT table_name FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name LIKE 'watermill\_%'`)
+	if err != nil {
 		panic(err)
 	}
+	tables := make([]string, 0)
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			panic(err)
+		}
+		tables = append(tables, table)
+	}
+	rows.Close()
+	tables = append(tables, scheduledTable)
+
+	for _, table := range tables {
+		_, err = db.Exec(`DELETE FROM "` + table + `"`)
+		if err != nil && !strings.Contains(err.Error(), "does not exist") {
+			panic(err)
+		}
+	}
 }
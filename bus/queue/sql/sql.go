@@ -10,7 +10,7 @@ import (
 	"github.com/GabrielCarpr/cqrs/bus"
 	"github.com/GabrielCarpr/cqrs/log"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"github.com/GabrielCarpr/cqrs/bus/message"
 
@@ -48,13 +48,100 @@ func NewSQLQueue(c Config) *SQLQueue {
 	if err != nil {
 		panic(err)
 	}
-	return &SQLQueue{db, logger, publisher}
+	if c.Topic == nil {
+		c.Topic = ByRoute(SingleTopic)
+	}
+	topics := map[string]TopicConfig{DefaultTopic: {Workers: 1}}
+	for topic, conf := range c.Topics {
+		if conf.Workers < 1 {
+			conf.Workers = 1
+		}
+		topics[topic] = conf
+	}
+	retry := bus.DefaultRetryPolicy
+	if c.Retry != nil {
+		retry = *c.Retry
+	}
+	if c.ScheduleInterval == 0 {
+		c.ScheduleInterval = time.Second
+	}
+	err = initializeSchedule(db)
+	if err != nil {
+		panic(err)
+	}
+	return &SQLQueue{
+		configured:       c.Topics,
+		db:               db,
+		logger:           logger,
+		publisher:        publisher,
+		topic:            c.Topic,
+		topics:           topics,
+		retry:            retry,
+		scheduleInterval: c.ScheduleInterval,
+	}
 }
 
 type SQLQueue struct {
 	db        *stdSQL.DB
 	logger    watermill.LoggerAdapter
 	publisher wmMessage.Publisher
+	topic     TopicFunc
+	topics    map[string]TopicConfig
+	retry     bus.RetryPolicy
+
+	scheduleInterval time.Duration
+
+	// configured are the topics configured with Config.Topics
+	configured map[string]TopicConfig
+}
+
+var _ bus.ConcurrentQueue = (*SQLQueue)(nil)
+
+// SetConcurrency implements bus.ConcurrentQueue, setting the workers of DefaultTopic
+// unless it's configured with Config.Topics. Messages are fetched one at a time, so
+// prefetch is ignored
+func (q *SQLQueue) SetConcurrency(workers int, prefetch int) {
+	if _, ok := q.configured[DefaultTopic]; ok || workers < 1 {
+		return
+	}
+	q.topics[DefaultTopic] = TopicConfig{Workers: workers}
+}
+
+var _ bus.TopicQueue = (*SQLQueue)(nil)
+
+// Consume implements bus.TopicQueue, subscribing to a topic with one worker,
+// unless it's configured with Config.Topics
+func (q *SQLQueue) Consume(topic string) {
+	if _, ok := q.configured[topic]; ok {
+		return
+	}
+	q.topics[topic] = TopicConfig{Workers: 1}
+}
+
+// retryMiddleware retries a failed message with its route's retry policy. The
+// message isn't acked or nacked until it succeeds or is poisoned, so its worker's
+// subscriber doesn't fetch the next message meanwhile, keeping messages in order
+func (q *SQLQueue) retryMiddleware(h wmMessage.HandlerFunc) wmMessage.HandlerFunc {
+	return func(msg *wmMessage.Message) ([]*wmMessage.Message, error) {
+		started := time.Now()
+		for attempt := 1; ; attempt++ {
+			msgs, err := h(msg)
+			if err == nil {
+				return msgs, nil
+			}
+
+			delay, retry := bus.RetryPolicyOf(err, q.retry).Next(attempt, time.Since(started), err)
+			if !retry {
+				return nil, err
+			}
+			q.logger.Info("Retrying message", watermill.LogFields{"uuid": msg.UUID, "attempt": attempt, "delay": delay})
+			select {
+			case <-msg.Context().Done():
+				return nil, err
+			case <-time.After(delay):
+			}
+		}
+	}
 }
 
 func (q *SQLQueue) Close() {
@@ -68,8 +155,16 @@ func (q *SQLQueue) fromMessage(ctx context.Context, msg message.Message) (*wmMes
 		return nil, err
 	}
 
-	result := wmMessage.NewMessage(watermill.NewUUID(), payload)
+	id := bus.MessageID(ctx)
+	if id == "" {
+		id = watermill.NewUUID()
+	}
+	result := wmMessage.NewMessage(id, payload)
 	result.Metadata = wmMessage.Metadata(bus.SerializeContext(ctx))
+	result.Metadata.Set(nameMetadata, bus.MessageName(msg))
+	if key := bus.PartitionKey(ctx, msg); key != "" {
+		result.Metadata.Set(partitionMetadata, key)
+	}
 	return result, nil
 }
 
@@ -87,57 +182,116 @@ func (q *SQLQueue) toMessage(msg *wmMessage.Message) (context.Context, message.M
 	return bus.DeserializeContext(ctx, metadata), result, err
 }
 
+// Subscribe subscribes to each configured topic, blocking. Each of a topic's workers
+// has its own consumer group, and only reads the messages in its partition.
+// Delayed messages are moved onto their topic while subscribed
 func (q *SQLQueue) Subscribe(topCtx context.Context, fn func(context.Context, message.Message) error) {
 	router, err := wmMessage.NewRouter(wmMessage.RouterConfig{}, q.logger)
 	if err != nil {
 		panic(err)
 	}
-	poison, err := middleware.PoisonQueue(q.publisher, "failures")
+	poison, err := middleware.PoisonQueue(q.publisher, FailureTopic)
 	if err != nil {
 		panic(err)
 	}
 	router.AddMiddleware(
 		poison,
-
-		middleware.Retry{
-			MaxRetries:      3,
-			InitialInterval: time.Second * 2,
-			Logger:          q.logger,
-			Multiplier:      2,
-		}.Middleware,
+		q.retryMiddleware,
 	)
 
-	subscriber, err := sql.NewSubscriber(
-		q.db,
-		sql.SubscriberConfig{
-			SchemaAdapter:    PostgreSQLSchema{},
-			OffsetsAdapter:   sql.DefaultPostgreSQLOffsetsAdapter{},
-			InitializeSchema: true,
-		},
-		q.logger,
-	)
-	if err != nil {
-		panic(err)
+	for topic, conf := range q.topics {
+		if conf.PublishOnly {
+			continue
+		}
+		subscribers, err := q.subscribers(topic, conf.Workers)
+		if err != nil {
+			panic(err)
+		}
+		for worker, subscriber := range subscribers {
+			router.AddNoPublisherHandler(
+				fmt.Sprintf("%s-%d", topic, worker),
+				topic,
+				subscriber,
+				func(msg *wmMessage.Message) error {
+					return q.process(fn, msg)
+				},
+			)
+		}
 	}
 
-	router.AddNoPublisherHandler(
-		"handle",
-		"messages",
-		subscriber,
-		func(msg *wmMessage.Message) error {
-			return q.process(fn, msg)
-		},
-	)
-
+	go q.runSchedule(topCtx)
 	if err := router.Run(topCtx); err != nil {
 		panic(err)
 	}
 }
 
+// subscribers returns a subscriber for each of a topic's workers, which selects the
+// messages in the worker's partition with the worker's consumer group
+func (q *SQLQueue) subscribers(topic string, workers int) ([]*sql.Subscriber, error) {
+	subscribers := make([]*sql.Subscriber, workers)
+	groups := make([]string, workers)
+	for worker := range subscribers {
+		groups[worker] = consumerGroup(worker, workers)
+		subscriber, err := sql.NewSubscriber(
+			q.db,
+			sql.SubscriberConfig{
+				ConsumerGroup:    groups[worker],
+				SchemaAdapter:    partitionedSchema{worker: worker, workers: workers},
+				OffsetsAdapter:   sql.DefaultPostgreSQLOffsetsAdapter{},
+				InitializeSchema: true,
+			},
+			q.logger,
+		)
+		if err != nil {
+			return nil, err
+		}
+		subscribers[worker] = subscriber
+	}
+
+	err := subscribers[0].SubscribeInitialize(topic)
+	if err != nil {
+		return nil, err
+	}
+	return subscribers, q.replaceGroups(topic, groups)
+}
+
+// replaceGroups replaces a topic's consumer groups with the current workers' groups.
+// Missing groups start from the oldest offset of the existing groups, as a message
+// after it may not have been processed, and the groups of another worker count are
+// deleted, so they don't start from stale offsets if that count is used again
+func (q *SQLQueue) replaceGroups(topic string, groups []string) error {
+	tx, err := q.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	table := sql.DefaultPostgreSQLOffsetsAdapter{}.MessagesOffsetsTable(topic)
+	_, err = tx.Exec(`LOCK TABLE ` + table + ` IN EXCLUSIVE MODE`)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		_, err = tx.Exec(`INSERT INTO `+table+` (consumer_group, offset_acked, offset_consumed)
+			SELECT $1, MIN(COALESCE(offset_acked, 0)), MIN(COALESCE(offset_acked, 0)) FROM `+table+`
+			HAVING COUNT(*) > 0
+			ON CONFLICT (consumer_group) DO NOTHING`, group)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM `+table+` WHERE consumer_group <> ALL($1)`, pq.Array(groups))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// process runs a message, returning its error to the router, which acks or nacks it
+// once it has been retried or poisoned
 func (q *SQLQueue) process(fn func(context.Context, message.Message) error, msg *wmMessage.Message) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			msg.Nack()
 			err = log.Error(context.Background(), fmt.Errorf("Panicked running message: %v", r), log.F{})
 		}
 	}()
@@ -146,31 +300,40 @@ func (q *SQLQueue) process(fn func(context.Context, message.Message) error, msg
 
 	log.Info(ctx, "Received message", log.F{"ID": msg.UUID})
 	if err != nil {
-		msg.Nack()
 		return log.Error(ctx, fmt.Errorf("Failed receiving message: %w", err), log.F{"id": msg.UUID})
 	}
 
 	err = fn(ctx, input)
 	if err != nil {
-		msg.Nack()
 		return log.Error(ctx, fmt.Errorf("Failed running message: %w", err), log.F{"id": msg.UUID})
 	}
 
 	log.Info(ctx, "Message processed", log.F{"id": msg.UUID})
-	msg.Ack()
 	return nil
 }
 
 func (q *SQLQueue) Publish(ctx context.Context, msgs ...message.Message) error {
 	for _, msg := range msgs {
+		topic := q.topic(ctx, msg)
+		if err := q.checkTopic(topic); err != nil {
+			return err
+		}
 		deliver, err := q.fromMessage(ctx, msg)
 		if err != nil {
 			return err
 		}
-		deliver.Metadata = wmMessage.Metadata(bus.SerializeContext(ctx))
 
-		log.Info(ctx, "publishing message", log.F{"ID": deliver.UUID})
-		err = q.publisher.Publish("messages", deliver)
+		if at := bus.DeliverAt(ctx); at.After(time.Now()) {
+			log.Info(ctx, "scheduling message", log.F{"ID": deliver.UUID, "topic": topic, "at": at.String()})
+			err = q.schedule(ctx, topic, at, deliver)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Info(ctx, "publishing message", log.F{"ID": deliver.UUID, "topic": topic})
+		err = q.publisher.Publish(topic, deliver)
 		if err != nil {
 			return err
 		}
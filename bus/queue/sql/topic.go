@@ -0,0 +1,115 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+)
+
+const (
+	// DefaultTopic is the topic messages are published to without a topic of their own
+	DefaultTopic = "messages"
+
+	// FailureTopic is the topic messages are moved to once they've exhausted their retries
+	FailureTopic = "failures"
+
+	// partitionMetadata is the message metadata key workers are partitioned by
+	partitionMetadata = "partition_key"
+
+	// nameMetadata is the message metadata key of the message's command or event name,
+	// which dead letters are filtered by
+	nameMetadata = "message_name"
+)
+
+// ErrUnknownTopic indicates a message was published to a topic that isn't configured
+var ErrUnknownTopic = errors.New("cqrs.queue: topic isn't configured")
+
+// TopicFunc chooses the topic a message is published to
+type TopicFunc = func(context.Context, message.Message) string
+
+// SingleTopic publishes every message to DefaultTopic
+func SingleTopic(ctx context.Context, msg message.Message) string {
+	return DefaultTopic
+}
+
+// ByMessageType publishes commands and events to the "commands" and "events" topics
+func ByMessageType(ctx context.Context, msg message.Message) string {
+	switch msg.(type) {
+	case bus.Command:
+		return "commands"
+	case bus.QueuedEvent:
+		return "events"
+	default:
+		return DefaultTopic
+	}
+}
+
+// ByName publishes commands and events to a topic of their own name
+func ByName(ctx context.Context, msg message.Message) string {
+	switch v := msg.(type) {
+	case bus.Command:
+		return v.Command()
+	case bus.QueuedEvent:
+		return v.Event.Event()
+	default:
+		return DefaultTopic
+	}
+}
+
+// ByRoute publishes messages to the topic set on their route with the builders'
+// Topic option, using fallback for messages without one
+func ByRoute(fallback TopicFunc) TopicFunc {
+	return func(ctx context.Context, msg message.Message) string {
+		if topic := bus.Topic(ctx); topic != "" {
+			return topic
+		}
+		return fallback(ctx, msg)
+	}
+}
+
+// TopicConfig configures the subscription to a topic
+type TopicConfig struct {
+	// Workers is the number of messages processed concurrently. Messages are partitioned
+	// between workers by their bus.PartitionKey, so messages with the same key are
+	// processed in order. Each worker reads only its own partition.
+	//
+	// Changing the number of workers re-partitions keys, so messages with the same key
+	// aren't ordered while the old workers' messages are still being processed, and
+	// the new workers start from the oldest message any old worker hadn't processed,
+	// so some are processed again. Every process consuming a topic must use the same
+	// number of workers
+	Workers int
+
+	// PublishOnly allows publishing to a topic without subscribing to it, for
+	// topics consumed by another process
+	PublishOnly bool
+}
+
+// checkTopic returns ErrUnknownTopic unless a topic is configured
+func (q *SQLQueue) checkTopic(topic string) error {
+	if _, ok := q.topics[topic]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTopic, topic)
+	}
+	return nil
+}
+
+// partitionCondition is the SQL condition selecting the messages one of a topic's
+// workers processes. Messages are partitioned by a hash of their partition key, and
+// those without one are spread between workers by their UUID
+func partitionCondition(worker, workers int) string {
+	return fmt.Sprintf(`('x' || substr(md5(COALESCE(metadata->>'%s', uuid)), 1, 7))::bit(28)::int %% %d = %d`,
+		partitionMetadata, workers, worker)
+}
+
+// consumerGroup returns the consumer group of one of a topic's workers. A single
+// worker uses the default group, and each worker count has groups of its own, as
+// changing it re-partitions messages between workers
+func consumerGroup(worker, workers int) string {
+	if workers == 1 {
+		return ""
+	}
+	return fmt.Sprintf("worker-%d-of-%d", worker, workers)
+}
@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/ThreeDotsLabs/watermill-sql/pkg/sql"
+	"github.com/stretchr/testify/assert"
+)
+
+type topicCmd struct {
+	bus.CommandType
+}
+
+func (topicCmd) Command() string {
+	return "topic.cmd"
+}
+
+func (topicCmd) Valid() error {
+	return nil
+}
+
+type topicEvent struct {
+	bus.EventType
+}
+
+func (topicEvent) Event() string {
+	return "topic.event"
+}
+
+func TestTopicFuncs(t *testing.T) {
+	ctx := context.Background()
+	event := bus.QueuedEvent{Event: &topicEvent{}, Handler: "handler"}
+
+	assert.Equal(t, DefaultTopic, SingleTopic(ctx, topicCmd{}))
+	assert.Equal(t, "commands", ByMessageType(ctx, topicCmd{}))
+	assert.Equal(t, "events", ByMessageType(ctx, event))
+	assert.Equal(t, "topic.cmd", ByName(ctx, topicCmd{}))
+	assert.Equal(t, "topic.event", ByName(ctx, event))
+
+	byRoute := ByRoute(ByMessageType)
+	assert.Equal(t, "commands", byRoute(ctx, topicCmd{}))
+	assert.Equal(t, "slow", byRoute(bus.WithTopic(ctx, "slow"), topicCmd{}))
+}
+
+func TestWorkersSelectTheirPartition(t *testing.T) {
+	offsets := sql.DefaultPostgreSQLOffsetsAdapter{}
+
+	single, _ := partitionedSchema{worker: 0, workers: 1}.SelectQuery("topic", "", offsets)
+	assert.NotContains(t, single, "md5")
+	assert.Equal(t, "", consumerGroup(0, 1))
+
+	query, args := partitionedSchema{worker: 2, workers: 4}.SelectQuery("topic", consumerGroup(2, 4), offsets)
+	assert.Contains(t, query, partitionCondition(2, 4))
+	assert.Contains(t, query, "% 4 = 2")
+	assert.Equal(t, []interface{}{"worker-2-of-4"}, args)
+	assert.NotEqual(t, consumerGroup(1, 2), consumerGroup(1, 4))
+}
+
+func TestPublishRefusesUnknownTopics(t *testing.T) {
+	q := &SQLQueue{
+		topic:  ByName,
+		topics: map[string]TopicConfig{DefaultTopic: {Workers: 1}, "billing": {PublishOnly: true}},
+	}
+
+	err := q.Publish(context.Background(), topicCmd{})
+	assert.True(t, errors.Is(err, ErrUnknownTopic))
+	assert.NoError(t, q.checkTopic("billing"))
+}
+
+func TestConsumeAddsTopics(t *testing.T) {
+	q := &SQLQueue{
+		topic:      ByRoute(SingleTopic),
+		topics:     map[string]TopicConfig{DefaultTopic: {Workers: 1}, "replies.a": {Workers: 2}},
+		configured: map[string]TopicConfig{"replies.a": {Workers: 2}},
+	}
+
+	q.Consume("replies.b")
+	q.Consume("replies.a")
+	assert.Equal(t, TopicConfig{Workers: 1}, q.topics["replies.b"])
+	assert.Equal(t, TopicConfig{Workers: 2}, q.topics["replies.a"])
+	assert.NoError(t, q.checkTopic("replies.b"))
+}
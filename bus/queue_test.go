@@ -0,0 +1,40 @@
+package bus_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/stretchr/testify/assert"
+)
+
+type partitionedCmd struct {
+	bus.CommandType
+
+	Account string
+}
+
+func (partitionedCmd) Command() string {
+	return "partitioned"
+}
+
+func (partitionedCmd) Valid() error {
+	return nil
+}
+
+func (c partitionedCmd) PartitionKey() string {
+	return c.Account
+}
+
+func TestPartitionKey(t *testing.T) {
+	ctx := context.Background()
+	event := &TestEvent{}
+	event.OwnedBy("1")
+	event.ForAggregate("user")
+
+	assert.Equal(t, "user/1", bus.PartitionKey(ctx, bus.QueuedEvent{Event: event, Handler: "handler"}))
+	assert.Equal(t, "", bus.PartitionKey(ctx, bus.QueuedEvent{Event: &TestEvent{}}))
+	assert.Equal(t, "account", bus.PartitionKey(ctx, partitionedCmd{Account: "account"}))
+	assert.Equal(t, "", bus.PartitionKey(ctx, renameCmd{}))
+	assert.Equal(t, "override", bus.PartitionKey(bus.WithPartitionKey(ctx, "override"), partitionedCmd{Account: "account"}))
+}
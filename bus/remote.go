@@ -0,0 +1,303 @@
+package bus
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	stdErrors "errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/GabrielCarpr/cqrs/log"
+)
+
+// DefaultQueryTimeout is how long a remote query is waited for, unless
+// configured with UseRemoteQueries
+const DefaultQueryTimeout = time.Second * 10
+
+var (
+	// ErrQueryTimeout indicates a remote query wasn't answered in time
+	ErrQueryTimeout = errors.Error{Code: 504, Message: "Query timed out"}
+
+	// ErrRemoteQueryResult indicates a remote query's result didn't match the caller's
+	ErrRemoteQueryResult = stdErrors.New("cqrs.bus: remote query result has the wrong type")
+
+	// ErrNoReplyTopic indicates a query is routed to another process, but no reply
+	// topic was configured with UseRemoteQueries
+	ErrNoReplyTopic = stdErrors.New("cqrs.bus: remote queries require a reply topic")
+)
+
+// UseRemoteQueries configures queries routed to another process with Remote, and
+// is required if any are. Their results are published to the reply topic, which
+// must be consumed by this process alone, so each process needs its own, stable
+// across restarts, such as one named after the process's host or instance.
+// Queues implementing TopicQueue consume the reply topic once a query is routed
+// with Remote. The SQL queue only publishes to the reply topic with a topic
+// function honouring the route's topic, such as ByRoute.
+//
+// A remote query asked while handling a queued message needs another worker free to
+// receive its reply
+func UseRemoteQueries(replyTopic string, timeout time.Duration) Config {
+	return func(b *Bus) error {
+		b.remote.topic = replyTopic
+		b.remote.timeout = timeout
+		return nil
+	}
+}
+
+// RegisterQueryResult registers the results of remote queries, so they can be sent
+// over the queue. Results are registered automatically when the query is asked, so
+// only processes handling remote queries need to register them
+func RegisterQueryResult(results ...interface{}) {
+	for _, result := range results {
+		gob.Register(result)
+	}
+}
+
+// QueuedQuery is a query queued for a handler in another process, along with
+// the result to fill. Both are serialized, so queues running in process don't
+// share them between the caller and handler
+type QueuedQuery struct {
+	Query  []byte
+	Result []byte
+
+	// ReplyTopic is the topic the result is published to
+	ReplyTopic string
+}
+
+func (QueuedQuery) MessageType() message.Type {
+	return message.QueuedQuery
+}
+
+// QueryReply is the result of a queued query. Error is the message of the
+// query's error, and Code its code if it was an errors.Error or
+// errors.ValidationError, whose invalid fields are in Fields
+type QueryReply struct {
+	RequestID string
+	Result    []byte
+	Error     string
+	Code      int
+	Reason    string
+	Fields    map[string][]string
+}
+
+func (QueryReply) MessageType() message.Type {
+	return message.QueryReply
+}
+
+// Err returns the query's error, as an errors.ValidationError if it had invalid
+// fields, or an errors.Error if it had a code
+func (r QueryReply) Err() error {
+	switch {
+	case r.Error == "":
+		return nil
+	case r.Fields != nil:
+		return errors.ValidationError{Code: r.Code, Message: r.Error, Fields: r.Fields}
+	case r.Code != 0:
+		return errors.Error{Code: r.Code, Reason: r.Reason, Message: r.Error}
+	default:
+		return stdErrors.New(r.Error)
+	}
+}
+
+// remoteQueries tracks the remote queries waiting for their replies
+type remoteQueries struct {
+	topic   string
+	timeout time.Duration
+
+	mx      sync.Mutex
+	waiting map[string]chan QueryReply
+}
+
+func newRemoteQueries() *remoteQueries {
+	return &remoteQueries{
+		timeout: DefaultQueryTimeout,
+		waiting: make(map[string]chan QueryReply),
+	}
+}
+
+func (r *remoteQueries) wait(id string) chan QueryReply {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	reply := make(chan QueryReply, 1)
+	r.waiting[id] = reply
+	return reply
+}
+
+func (r *remoteQueries) forget(id string) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	delete(r.waiting, id)
+}
+
+// reply passes a reply to its waiting query, returning false if nothing is waiting
+func (r *remoteQueries) reply(reply QueryReply) bool {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	waiting, ok := r.waiting[reply.RequestID]
+	if ok {
+		waiting <- reply
+		delete(r.waiting, reply.RequestID)
+	}
+	return ok
+}
+
+// remoteQueryHandler is the handler of a remote query route. It queues the
+// query and waits for its reply, so runs within the bus's query middleware
+type remoteQueryHandler struct {
+	bus   *Bus
+	route QueryRoute
+}
+
+func (h remoteQueryHandler) Execute(ctx context.Context, q Query, result interface{}) error {
+	b := h.bus
+	if b.queue == nil {
+		return NoQueryHandler{q}
+	}
+	RegisterQueryResult(result)
+	queued := QueuedQuery{ReplyTopic: b.remote.topic}
+	var err error
+	queued.Query, err = SerializeMessage(q, Gob)
+	if err != nil {
+		return err
+	}
+	queued.Result, err = encodeResult(result)
+	if err != nil {
+		return err
+	}
+
+	ctx = Caused(ctx)
+	id := MessageID(ctx)
+	replies := b.remote.wait(id)
+	defer b.remote.forget(id)
+
+	log.Info(ctx, "Publishing remote query", log.F{"query": q.Query(), "id": id})
+	err = b.enqueue(WithTopic(ctx, h.route.Topic), queued)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(b.remote.timeout)
+	defer timeout.Stop()
+	var reply QueryReply
+	select {
+	case reply = <-replies:
+	case <-timeout.C:
+		return ErrQueryTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := reply.Err(); err != nil {
+		return err
+	}
+	answer, err := decodeResult(reply.Result)
+	if err != nil {
+		return err
+	}
+	return copyResult(answer, result)
+}
+
+func encodeResult(result interface{}) ([]byte, error) {
+	b := &bytes.Buffer{}
+	err := gob.NewEncoder(b).Encode(&result)
+	return b.Bytes(), err
+}
+
+func decodeResult(data []byte) (interface{}, error) {
+	var result interface{}
+	err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(&result)
+	return result, err
+}
+
+// copyResult copies a remote query's result into the caller's
+func copyResult(from interface{}, to interface{}) error {
+	src := reflect.ValueOf(from)
+	dst := reflect.ValueOf(to)
+	if !src.IsValid() {
+		return ErrRemoteQueryResult
+	}
+	if src.Type() != dst.Type() {
+		return fmt.Errorf("%w: got %s, expected %s", ErrRemoteQueryResult, src.Type(), dst.Type())
+	}
+	dst.Elem().Set(src.Elem())
+	return nil
+}
+
+// answerQuery runs a queued query and publishes its result to the reply topic. Failing
+// to run the query is replied with, so only failing to reply is returned to the queue
+func (b *Bus) answerQuery(ctx context.Context, queued QueuedQuery) error {
+	reply := QueryReply{RequestID: MessageID(ctx)}
+	result, err := b.runQueuedQuery(ctx, queued)
+	if err == nil {
+		reply.Result, err = encodeResult(result)
+	}
+	if err != nil {
+		reply.Error = err.Error()
+		public, _ := errors.Public(err)
+		switch public := public.(type) {
+		case errors.Error:
+			reply.Error, reply.Code, reply.Reason = public.Message, public.Code, public.Reason
+		case errors.ValidationError:
+			reply.Error, reply.Code, reply.Fields = public.Message, public.Code, public.Fields
+		}
+	}
+
+	log.Info(ctx, "Replying to remote query", log.F{"id": reply.RequestID, "topic": queued.ReplyTopic})
+	return b.enqueue(WithTopic(Caused(ctx), queued.ReplyTopic), reply)
+}
+
+func (b *Bus) runQueuedQuery(ctx context.Context, queued QueuedQuery) (interface{}, error) {
+	msg, err := DeserializeMessage(queued.Query)
+	if err != nil {
+		return nil, err
+	}
+	q, ok := msg.(Query)
+	if !ok {
+		return nil, fmt.Errorf("cqrs.bus: queued query is a %T", msg)
+	}
+	result, err := decodeResult(queued.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	if route, ok := b.routes.RouteQuery(q); !ok || route.Remote {
+		return nil, NoQueryHandler{q}
+	}
+	return result, b.Query(ctx, q, result)
+}
+
+// receiveReply passes a queued reply to the remote query waiting for it. Replies
+// for queries that have timed out, or were asked by another process, are dropped,
+// as retrying them would hold up the replies queries are still waiting for
+func (b *Bus) receiveReply(ctx context.Context, reply QueryReply) error {
+	if !b.remote.reply(reply) {
+		log.Warn(ctx, "Dropping reply no query is waiting for", log.F{"id": reply.RequestID})
+	}
+	return nil
+}
+
+// configureRemote checks a reply topic is configured if any query is routed to
+// another process, and has queues implementing TopicQueue consume it
+func (b *Bus) configureRemote() error {
+	for _, route := range b.routes.queryRoutes {
+		if !route.Remote {
+			continue
+		}
+		if b.remote.topic == "" {
+			return ErrNoReplyTopic
+		}
+		if q, ok := b.queue.(TopicQueue); ok {
+			q.Consume(b.remote.topic)
+		}
+		return nil
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package bus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type greetingQuery struct {
+	bus.QueryType
+
+	Name  string
+	Delay time.Duration
+}
+
+func (greetingQuery) Query() string {
+	return "greeting"
+}
+
+func (greetingQuery) Valid() error {
+	return nil
+}
+
+type greeting struct {
+	Message string
+}
+
+type greetingHandler struct{}
+
+func (greetingHandler) Execute(ctx context.Context, q bus.Query, res interface{}) error {
+	query := q.(greetingQuery)
+	if query.Name == "" {
+		return errors.Error{Code: 404, Message: "Nobody to greet"}
+	}
+	if query.Name == "-" {
+		invalid := errors.NewValidationError()
+		invalid.Add("name", "isn't a name")
+		return invalid
+	}
+	time.Sleep(query.Delay)
+	res.(*greeting).Message = "Hello " + query.Name
+	return nil
+}
+
+// topicQueue is an in process queue with a memory queue per topic,
+// so each process can consume its own topic
+type topicQueue struct {
+	topics   map[string]*queueMemory.MemoryQueue
+	consumes string
+}
+
+func (q topicQueue) Publish(ctx context.Context, msgs ...message.Message) error {
+	return q.topics[bus.Topic(ctx)].Publish(ctx, msgs...)
+}
+
+func (q topicQueue) Subscribe(ctx context.Context, fn func(context.Context, message.Message) error) {
+	q.topics[q.consumes].Subscribe(ctx, fn)
+}
+
+func (q topicQueue) Close() {
+	q.topics[q.consumes].Close()
+}
+
+func TestRemoteQueries(t *testing.T) {
+	topics := map[string]*queueMemory.MemoryQueue{
+		"greetings": queueMemory.NewMemoryQueue(queueMemory.Config{}),
+		"replies":   queueMemory.NewMemoryQueue(queueMemory.Config{}),
+	}
+
+	handlerCtx, handlerCancel := context.WithCancel(context.Background())
+	handler := bus.Default(handlerCtx, []bus.Module{bus.FuncModule{
+		QueriesFunc: func(b bus.QueryBuilder) {
+			b.Query(greetingQuery{}).Handled(greetingHandler{})
+		},
+		Defs: []bus.Def{{
+			Name: greetingHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return greetingHandler{}, nil
+			},
+		}},
+	}}, bus.UseQueue(topicQueue{topics, "greetings"}))
+	bus.RegisterQueryResult(&greeting{})
+	bus.Instance = nil
+
+	callerCtx, callerCancel := context.WithCancel(context.Background())
+	caller := bus.Default(callerCtx, []bus.Module{bus.FuncModule{
+		QueriesFunc: func(b bus.QueryBuilder) {
+			b.Query(greetingQuery{}).Remote("greetings")
+		},
+	}}, bus.UseQueue(topicQueue{topics, "replies"}), bus.UseRemoteQueries("replies", time.Millisecond*200))
+
+	defer runBus(handler, handlerCancel)()
+	defer runBus(caller, callerCancel)()
+
+	var result greeting
+	err := caller.Query(context.Background(), greetingQuery{Name: "Gabriel"}, &result)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello Gabriel", result.Message)
+
+	err = caller.Query(context.Background(), greetingQuery{}, &result)
+	assert.Equal(t, errors.Error{Code: 404, Message: "Nobody to greet"}, err)
+
+	err = caller.Query(context.Background(), greetingQuery{Name: "-"}, &result)
+	assert.Equal(t, errors.ValidationError{Code: 422, Message: "Validation failed", Fields: map[string][]string{"name": {"isn't a name"}}}, err)
+
+	err = caller.Query(context.Background(), greetingQuery{Name: "Gabriel", Delay: time.Millisecond * 400}, &result)
+	assert.Equal(t, bus.ErrQueryTimeout, err)
+}
+
+// consumingQueue is a memory queue recording the topics it's asked to consume
+type consumingQueue struct {
+	*queueMemory.MemoryQueue
+
+	consumed []string
+}
+
+func (q *consumingQueue) Consume(topic string) {
+	q.consumed = append(q.consumed, topic)
+}
+
+func TestRemoteQueriesConsumeTheirReplyTopic(t *testing.T) {
+	module := bus.FuncModule{
+		QueriesFunc: func(b bus.QueryBuilder) {
+			b.Query(greetingQuery{}).Remote("greetings")
+		},
+	}
+
+	q := &consumingQueue{MemoryQueue: queueMemory.NewMemoryQueue(queueMemory.Config{})}
+	assert.PanicsWithValue(t, bus.ErrNoReplyTopic, func() {
+		bus.New(context.Background(), []bus.Module{module}, bus.UseQueue(q))
+	})
+	assert.Empty(t, q.consumed)
+
+	b := bus.New(context.Background(), []bus.Module{module}, bus.UseQueue(q), bus.UseRemoteQueries("replies.api-1", time.Second))
+	b.Close()
+	bus.Instance = nil
+	assert.Equal(t, []string{"replies.api-1"}, q.consumed)
+}
+
+func TestUnwaitedRepliesAreDropped(t *testing.T) {
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{MaxRetries: 1, InitialInterval: time.Second})
+	ctx, cancel := context.WithCancel(context.Background())
+	b := bus.New(ctx, []bus.Module{}, bus.UseQueue(queue))
+	defer runBus(b, cancel)()
+
+	require.NoError(t, queue.Publish(context.Background(), bus.QueryReply{RequestID: "nobody"}))
+	require.NoError(t, queue.Wait(time.Millisecond*500))
+
+	count, err := queue.CountDeadLetters(context.Background(), bus.DeadLetterFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
@@ -0,0 +1,180 @@
+package bus
+
+import (
+	"context"
+	stdErrors "errors"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/GabrielCarpr/cqrs/log"
+)
+
+var (
+	// ErrResultNotFound indicates a ticket has no stored result
+	ErrResultNotFound = stdErrors.New("cqrs.bus: command result not found")
+
+	// ErrResultTimeout indicates a command didn't finish while its result was awaited
+	ErrResultTimeout = stdErrors.New("cqrs.bus: timed out awaiting command result")
+
+	// ErrNoResultStore indicates results were requested without a result store configured
+	ErrNoResultStore = stdErrors.New("cqrs.bus: command results require a result store")
+)
+
+// resultOwnerKey is the context key of the owner of a queued command's result, so
+// the worker stores its result with the owner it was dispatched with
+var resultOwnerKey = contextKey("result_owner")
+
+// resultOwner identifies who dispatched a command, registered with RegisterResultOwner
+var resultOwner = func(context.Context) string { return "" }
+
+func init() {
+	RegisterContextKey(resultOwnerKey, "")
+}
+
+// RegisterResultOwner sets how the dispatcher of a command is identified, so
+// its result can be kept private to them. The auth package registers the ID of
+// the context's credentials
+func RegisterResultOwner(owner func(context.Context) string) {
+	resultOwner = owner
+}
+
+// ResultOwner returns the owner of results dispatched with the context, which is
+// the owner of the command being handled, if there is one
+func ResultOwner(ctx context.Context) string {
+	if owner, ok := ctx.Value(resultOwnerKey).(string); ok && owner != "" {
+		return owner
+	}
+	return resultOwner(ctx)
+}
+
+// CommandStatus is the progress of an asynchronously dispatched command
+type CommandStatus string
+
+const (
+	CommandPending   CommandStatus = "pending"
+	CommandSucceeded CommandStatus = "succeeded"
+	CommandFailed    CommandStatus = "failed"
+)
+
+// CommandResult is the stored response of an asynchronously dispatched command.
+// A failed command may still be retried by the queue, updating its result
+type CommandResult struct {
+	Ticket  string        `json:"ticket"`
+	Command string        `json:"command"`
+	Status  CommandStatus `json:"status"`
+
+	// Owner identifies who dispatched the command, from ResultOwner
+	Owner string `json:"-"`
+
+	// ID is the ID of the command's response
+	ID string `json:"id,omitempty"`
+
+	// Error is the message of the command's error, and Code its code if it was an
+	// errors.Error or errors.ValidationError, whose invalid fields are in Fields
+	Error  string              `json:"error,omitempty"`
+	Code   int                 `json:"code,omitempty"`
+	Fields map[string][]string `json:"fields,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Done returns whether the command has finished
+func (r CommandResult) Done() bool {
+	return r.Status != CommandPending
+}
+
+// Err returns the command's error, as an errors.ValidationError if it had invalid
+// fields, or an errors.Error if it had a code
+func (r CommandResult) Err() error {
+	switch {
+	case r.Status != CommandFailed:
+		return nil
+	case r.Fields != nil:
+		return errors.ValidationError{Code: r.Code, Message: r.Error, Fields: r.Fields}
+	case r.Code != 0:
+		return errors.Error{Code: r.Code, Message: r.Error}
+	default:
+		return stdErrors.New(r.Error)
+	}
+}
+
+// ResultStore stores the results of asynchronously dispatched commands, by ticket
+type ResultStore interface {
+	// Store creates or replaces a ticket's result
+	Store(context.Context, CommandResult) error
+
+	// Result returns a ticket's result, or ErrResultNotFound
+	Result(ctx context.Context, ticket string) (CommandResult, error)
+
+	// Purge removes results last updated before a time
+	Purge(ctx context.Context, before time.Time) error
+}
+
+// UseResultStore stores the results of asynchronously dispatched commands, so they
+// can be awaited with their response's ticket. Results are kept for the retention window
+func UseResultStore(s ResultStore, retention time.Duration) Config {
+	return func(b *Bus) error {
+		b.results = s
+		b.plugins = append(b.plugins, &purger{name: "command results", purge: s.Purge, retention: retention})
+		return nil
+	}
+}
+
+// Result returns the result of an asynchronously dispatched command
+func (b *Bus) Result(ctx context.Context, ticket string) (CommandResult, error) {
+	if b.results == nil {
+		return CommandResult{}, ErrNoResultStore
+	}
+	return b.results.Result(ctx, ticket)
+}
+
+// Await polls the result of an asynchronously dispatched command until it has finished.
+// If the timeout passes first, the pending result is returned with ErrResultTimeout
+func (b *Bus) Await(ctx context.Context, ticket string, timeout time.Duration) (CommandResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
+
+	for {
+		result, err := b.Result(ctx, ticket)
+		if err != nil || result.Done() {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, ErrResultTimeout
+		case <-ticker.C:
+		}
+	}
+}
+
+// storeResult records the result of a queued command, by its message ID. Failures are
+// only logged, as the command has already run
+func (b *Bus) storeResult(ctx context.Context, cmd Command, res *CommandResponse, err error) {
+	ticket := MessageID(ctx)
+	if b.results == nil || ticket == "" {
+		return
+	}
+
+	result := CommandResult{Ticket: ticket, Command: cmd.Command(), Status: CommandSucceeded, Owner: ResultOwner(ctx), UpdatedAt: time.Now()}
+	if res != nil {
+		result.ID = res.ID
+	}
+	if err != nil {
+		result.Status = CommandFailed
+		result.Error = err.Error()
+		public, _ := errors.Public(err)
+		switch public := public.(type) {
+		case errors.Error:
+			result.Error, result.Code = public.Message, public.Code
+		case errors.ValidationError:
+			result.Error, result.Code, result.Fields = public.Message, public.Code, public.Fields
+		}
+	}
+
+	if err := b.results.Store(ctx, result); err != nil {
+		log.Error(ctx, "failed storing command result", log.F{"ticket": ticket, "error": err.Error()})
+	}
+}
@@ -0,0 +1,2 @@
+// Package result contains the stores of asynchronously dispatched commands' results
+package result
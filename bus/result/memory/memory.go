@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+)
+
+var _ bus.ResultStore = (*MemoryResultStore)(nil)
+
+// MemoryResultStore stores command results in memory
+type MemoryResultStore struct {
+	results map[string]bus.CommandResult
+
+	mx sync.Mutex
+}
+
+func (s *MemoryResultStore) Store(ctx context.Context, result bus.CommandResult) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.results == nil {
+		s.results = make(map[string]bus.CommandResult)
+	}
+	s.results[result.Ticket] = result
+	return nil
+}
+
+func (s *MemoryResultStore) Result(ctx context.Context, ticket string) (bus.CommandResult, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	result, ok := s.results[ticket]
+	if !ok {
+		return bus.CommandResult{}, bus.ErrResultNotFound
+	}
+	return result, nil
+}
+
+func (s *MemoryResultStore) Purge(ctx context.Context, before time.Time) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	for ticket, result := range s.results {
+		if result.UpdatedAt.Before(before) {
+			delete(s.results, ticket)
+		}
+	}
+	return nil
+}
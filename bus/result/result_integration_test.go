@@ -0,0 +1,120 @@
+// +build !unit
+
+package result_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/result/memory"
+	"github.com/GabrielCarpr/cqrs/bus/result/sql"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+var TestConfig = sql.Config{
+	DBName: "cqrs",
+	DBHost: "db",
+	DBUser: "cqrs",
+	DBPass: "cqrs",
+}
+
+func TestMemoryResultStore(t *testing.T) {
+	suite.Run(t, &ResultStoreBlackboxTest{factory: func() bus.ResultStore {
+		return &memory.MemoryResultStore{}
+	}})
+}
+
+func TestSQLResultStore(t *testing.T) {
+	suite.Run(t, &ResultStoreBlackboxTest{
+		factory: func() bus.ResultStore {
+			return sql.NewSQLResultStore(TestConfig)
+		},
+		setupHook: func() {
+			sql.ResetSQLDB(TestConfig.DBDsn())
+		},
+	})
+}
+
+type ResultStoreBlackboxTest struct {
+	suite.Suite
+
+	factory   func() bus.ResultStore
+	setupHook func()
+
+	store  bus.ResultStore
+	ticket string
+}
+
+func (s *ResultStoreBlackboxTest) SetupTest() {
+	s.store = s.factory()
+	if s.setupHook != nil {
+		s.setupHook()
+	}
+	s.ticket = uuid.New().String()
+}
+
+func (s *ResultStoreBlackboxTest) TestStoresResults() {
+	_, err := s.store.Result(context.Background(), s.ticket)
+	s.Equal(bus.ErrResultNotFound, err)
+
+	at := time.Now().Truncate(time.Second)
+	s.Require().NoError(s.store.Store(context.Background(), bus.CommandResult{
+		Ticket:    s.ticket,
+		Command:   "cmd",
+		Status:    bus.CommandPending,
+		Owner:     "user",
+		UpdatedAt: at,
+	}))
+	s.Require().NoError(s.store.Store(context.Background(), bus.CommandResult{
+		Ticket:    s.ticket,
+		Command:   "cmd",
+		Status:    bus.CommandFailed,
+		Error:     "Conflict",
+		Code:      409,
+		Owner:     "user",
+		UpdatedAt: at,
+	}))
+
+	result, err := s.store.Result(context.Background(), s.ticket)
+	s.Require().NoError(err)
+	s.Equal(bus.CommandFailed, result.Status)
+	s.Equal("Conflict", result.Error)
+	s.Equal(409, result.Code)
+	s.Equal("user", result.Owner)
+	s.Nil(result.Fields)
+	s.True(at.Equal(result.UpdatedAt))
+
+	fields := map[string][]string{"name": {"is required"}}
+	s.Require().NoError(s.store.Store(context.Background(), bus.CommandResult{
+		Ticket:    s.ticket,
+		Command:   "cmd",
+		Status:    bus.CommandFailed,
+		Error:     "Validation failed",
+		Code:      422,
+		Fields:    fields,
+		UpdatedAt: at,
+	}))
+	result, err = s.store.Result(context.Background(), s.ticket)
+	s.Require().NoError(err)
+	s.Equal(fields, result.Fields)
+}
+
+func (s *ResultStoreBlackboxTest) TestPurgesOldResults() {
+	s.Require().NoError(s.store.Store(context.Background(), bus.CommandResult{
+		Ticket:    s.ticket,
+		Command:   "cmd",
+		Status:    bus.CommandSucceeded,
+		UpdatedAt: time.Now(),
+	}))
+
+	s.Require().NoError(s.store.Purge(context.Background(), time.Now().Add(-time.Hour)))
+	_, err := s.store.Result(context.Background(), s.ticket)
+	s.Require().NoError(err)
+
+	s.Require().NoError(s.store.Purge(context.Background(), time.Now().Add(time.Second)))
+	_, err = s.store.Result(context.Background(), s.ticket)
+	s.Equal(bus.ErrResultNotFound, err)
+}
@@ -0,0 +1,52 @@
+package sql
+
+import (
+	stdSQL "database/sql"
+	"log"
+	"strings"
+)
+
+// PostgreSQLSchema creates the command results table
+type PostgreSQLSchema struct {
+	Config Config
+}
+
+func (s PostgreSQLSchema) Make() error {
+	log.Print("Creating command results")
+	db, err := stdSQL.Open("postgres", s.Config.DBDsn())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS command_results (
+		"ticket" VARCHAR(36) PRIMARY KEY,
+		"command" VARCHAR(255) NOT NULL,
+		"status" VARCHAR(16) NOT NULL,
+		"id" VARCHAR(255) NOT NULL DEFAULT '',
+		"error" TEXT NOT NULL DEFAULT '',
+		"code" INT NOT NULL DEFAULT 0,
+		"updated_at" TIMESTAMP NOT NULL
+	);
+	ALTER TABLE command_results ADD COLUMN IF NOT EXISTS "fields" JSON;
+	ALTER TABLE command_results ADD COLUMN IF NOT EXISTS "owner" VARCHAR(255) NOT NULL DEFAULT '';`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS command_results_updated_at ON command_results ("updated_at")`)
+	return err
+}
+
+func ResetSQLDB(dsn string) {
+	log.Print("Resetting command results")
+	db, err := stdSQL.Open("postgres", dsn)
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM command_results")
+	if err != nil && !strings.Contains(err.Error(), "does not exist") {
+		panic(err)
+	}
+}
@@ -0,0 +1,87 @@
+package sql
+
+import (
+	"context"
+	stdSQL "database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+
+	_ "github.com/lib/pq"
+)
+
+func makeDB(c Config) *stdSQL.DB {
+	db, err := stdSQL.Open("postgres", c.DBDsn())
+	if err != nil {
+		panic(err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	return db
+}
+
+var _ bus.ResultStore = (*SQLResultStore)(nil)
+
+// NewSQLResultStore returns a result store, creating its table if required
+func NewSQLResultStore(c Config) *SQLResultStore {
+	db := makeDB(c)
+	schema := PostgreSQLSchema{c}
+	err := schema.Make()
+	if err != nil {
+		panic(err)
+	}
+	return &SQLResultStore{db: db}
+}
+
+// SQLResultStore stores command results in PostgreSQL
+type SQLResultStore struct {
+	db *stdSQL.DB
+}
+
+func (s *SQLResultStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLResultStore) Store(ctx context.Context, r bus.CommandResult) error {
+	fields, err := json.Marshal(r.Fields)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO command_results
+		(ticket, command, status, id, error, code, fields, owner, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (ticket) DO UPDATE SET
+			status = EXCLUDED.status,
+			id = EXCLUDED.id,
+			error = EXCLUDED.error,
+			code = EXCLUDED.code,
+			fields = EXCLUDED.fields,
+			updated_at = EXCLUDED.updated_at`,
+		r.Ticket, r.Command, r.Status, r.ID, r.Error, r.Code, fields, r.Owner, r.UpdatedAt)
+	return err
+}
+
+func (s *SQLResultStore) Result(ctx context.Context, ticket string) (bus.CommandResult, error) {
+	var r bus.CommandResult
+	var fields []byte
+	row := s.db.QueryRowContext(ctx, `SELECT ticket, command, status, id, error, code, fields, owner, updated_at
+		FROM command_results WHERE ticket = $1`, ticket)
+	err := row.Scan(&r.Ticket, &r.Command, &r.Status, &r.ID, &r.Error, &r.Code, &fields, &r.Owner, &r.UpdatedAt)
+	if err == stdSQL.ErrNoRows {
+		return r, bus.ErrResultNotFound
+	}
+	if err != nil || fields == nil {
+		return r, err
+	}
+	return r, json.Unmarshal(fields, &r.Fields)
+}
+
+func (s *SQLResultStore) Purge(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM command_results WHERE updated_at < $1`, before)
+	return err
+}
@@ -0,0 +1,125 @@
+package bus_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/auth"
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	resultMemory "github.com/GabrielCarpr/cqrs/bus/result/memory"
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/google/uuid"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncDispatchResults(t *testing.T) {
+	var failures int32
+	handler := renameHandler{owner: uuid.New()}
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(renameCmd{}).Handled(handler)
+			b.Command(failingCmd{}).Handled(countingHandler{&failures}).Retry(bus.NeverRetry)
+		},
+		Defs: []bus.Def{{
+			Name: handler,
+			Build: func(ctn di.Container) (interface{}, error) {
+				return handler, nil
+			},
+		}, {
+			Name: countingHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return countingHandler{&failures}, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{module}, bus.UseQueue(queue), bus.UseResultStore(&resultMemory.MemoryResultStore{}, time.Hour))
+
+	user := uuid.New()
+	res, err := b.Dispatch(auth.TestCtx(user), renameCmd{}, false)
+	require.NoError(t, err)
+	require.NotEmpty(t, res.Ticket)
+
+	result, err := b.Result(context.Background(), res.Ticket)
+	require.NoError(t, err)
+	assert.Equal(t, bus.CommandPending, result.Status)
+	assert.Equal(t, "rename", result.Command)
+	assert.Equal(t, user.String(), result.Owner)
+
+	_, err = b.Await(context.Background(), res.Ticket, time.Millisecond*10)
+	assert.Equal(t, bus.ErrResultTimeout, err)
+
+	defer runBus(b, cancel)()
+	result, err = b.Await(context.Background(), res.Ticket, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, bus.CommandSucceeded, result.Status)
+	assert.Equal(t, handler.owner.String(), result.ID)
+	assert.Equal(t, user.String(), result.Owner)
+	assert.NoError(t, result.Err())
+
+	res, err = b.Dispatch(context.Background(), failingCmd{}, false)
+	require.NoError(t, err)
+	result, err = b.Await(context.Background(), res.Ticket, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, bus.CommandFailed, result.Status)
+	assert.Equal(t, errors.InternalServerError, result.Err())
+
+	_, err = b.Result(context.Background(), "missing")
+	assert.Equal(t, bus.ErrResultNotFound, err)
+}
+
+type invalidCmd struct {
+	bus.CommandType
+}
+
+func (invalidCmd) Command() string {
+	return "invalid"
+}
+
+func (invalidCmd) Valid() error {
+	return nil
+}
+
+type invalidHandler struct{}
+
+func (invalidHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	invalid := errors.NewValidationError()
+	invalid.Add("name", "is required")
+	return bus.CommandResponse{Error: fmt.Errorf("renaming: %w", invalid.Err())}, nil
+}
+
+func TestAsyncDispatchResultsKeepValidationErrors(t *testing.T) {
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(invalidCmd{}).Handled(invalidHandler{}).Retry(bus.NeverRetry)
+		},
+		Defs: []bus.Def{{
+			Name: invalidHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return invalidHandler{}, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{module}, bus.UseQueue(queue), bus.UseResultStore(&resultMemory.MemoryResultStore{}, time.Hour))
+	defer runBus(b, cancel)()
+
+	res, err := b.Dispatch(context.Background(), invalidCmd{}, false)
+	require.NoError(t, err)
+	result, err := b.Await(context.Background(), res.Ticket, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 422, result.Code)
+	assert.Equal(t, "Validation failed", result.Error)
+
+	var invalid errors.ValidationError
+	require.ErrorAs(t, result.Err(), &invalid)
+	assert.Equal(t, map[string][]string{"name": {"is required"}}, invalid.Fields)
+}
@@ -0,0 +1,138 @@
+package bus
+
+import (
+	stdErrors "errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/errors"
+)
+
+// DefaultRetryPolicy is used by queues for messages without a retry policy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:     4,
+	InitialInterval: time.Second * 2,
+	Multiplier:      2,
+	NonRetryable:    IsClientError,
+}
+
+// IsClientError returns whether a message failed with a public error caused by
+// the message itself, a 4xx errors.Error or an errors.ValidationError, which fails
+// the same way however often it's retried. errors.Conflict, which is a concurrent
+// change, and errors.RateLimited are transient, so aren't client errors
+func IsClientError(err error) bool {
+	public, ok := errors.Public(err)
+	if !ok {
+		return false
+	}
+
+	switch e := public.(type) {
+	case errors.ValidationError:
+		return true
+	case errors.Error:
+		switch {
+		case e.Code < 400 || e.Code >= 500:
+			return false
+		case e.Code == errors.Conflict.Code && e.Reason == "":
+			return false
+		case e.Code == errors.RateLimited.Code:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// NeverRetry is a retry policy for handlers that must only run once
+var NeverRetry = RetryPolicy{MaxAttempts: 1}
+
+// RetryPolicy decides whether, and when, a queue retries a failed message.
+// A message that runs out of attempts is poisoned
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a message is handled, including the first.
+	// Zero allows any number of attempts within MaxElapsed
+	MaxAttempts int
+
+	// MaxElapsed stops retrying once this long has passed since the first attempt.
+	// Zero allows any amount of time within MaxAttempts. If both are zero, the
+	// message is never retried
+	MaxElapsed time.Duration
+
+	// InitialInterval is the delay before the first retry
+	InitialInterval time.Duration
+
+	// MaxInterval caps the delay between retries, if set
+	MaxInterval time.Duration
+
+	// Multiplier increases the delay after each retry. Zero keeps the delay constant
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction of it, between 0 and 1
+	Jitter float64
+
+	// NonRetryable classifies errors that poison the message immediately
+	NonRetryable func(error) bool
+}
+
+// Next returns the delay before retrying a message that has failed its attempt'th
+// attempt, or false if it shouldn't be retried
+func (p RetryPolicy) Next(attempt int, elapsed time.Duration, err error) (time.Duration, bool) {
+	if p.MaxAttempts == 0 && p.MaxElapsed == 0 {
+		return 0, false
+	}
+	if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+		return 0, false
+	}
+	if p.NonRetryable != nil && p.NonRetryable(err) {
+		return 0, false
+	}
+
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialInterval) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxInterval > 0 && delay > float64(p.MaxInterval) {
+		delay = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		delay += delay * p.Jitter * (rand.Float64()*2 - 1)
+	}
+
+	if p.MaxElapsed > 0 && elapsed+time.Duration(delay) > p.MaxElapsed {
+		return 0, false
+	}
+	return time.Duration(delay), true
+}
+
+// retryError carries the retry policy of the route that failed back to the queue
+type retryError struct {
+	err    error
+	policy RetryPolicy
+}
+
+func (e retryError) Error() string {
+	return e.err.Error()
+}
+
+func (e retryError) Unwrap() error {
+	return e.err
+}
+
+func withRetryPolicy(err error, policy *RetryPolicy) error {
+	if err == nil || policy == nil {
+		return err
+	}
+	return retryError{err: err, policy: *policy}
+}
+
+// RetryPolicyOf returns the retry policy of the route a queued message failed in,
+// or the fallback if the route didn't declare one
+func RetryPolicyOf(err error, fallback RetryPolicy) RetryPolicy {
+	var r retryError
+	if stdErrors.As(err, &r) {
+		return r.policy
+	}
+	return fallback
+}
@@ -0,0 +1,89 @@
+package bus_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	cqrsErrs "github.com/GabrielCarpr/cqrs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var errRetry = errors.New("failed")
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := bus.RetryPolicy{MaxAttempts: 4, InitialInterval: time.Second, Multiplier: 2, MaxInterval: time.Second * 3}
+
+	for attempt, expected := range []time.Duration{time.Second, time.Second * 2, time.Second * 3} {
+		delay, ok := p.Next(attempt+1, 0, errRetry)
+		assert.True(t, ok)
+		assert.Equal(t, expected, delay)
+	}
+
+	_, ok := p.Next(4, 0, errRetry)
+	assert.False(t, ok)
+}
+
+func TestRetryPolicyMaxElapsed(t *testing.T) {
+	p := bus.RetryPolicy{MaxElapsed: time.Hour, InitialInterval: time.Minute}
+
+	delay, ok := p.Next(100, time.Minute*30, errRetry)
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, delay)
+
+	_, ok = p.Next(100, time.Minute*59+time.Second, errRetry)
+	assert.False(t, ok)
+}
+
+func TestRetryPolicyJitter(t *testing.T) {
+	p := bus.RetryPolicy{MaxAttempts: 2, InitialInterval: time.Second, Jitter: 0.5}
+
+	for i := 0; i < 100; i++ {
+		delay, ok := p.Next(1, 0, errRetry)
+		assert.True(t, ok)
+		assert.GreaterOrEqual(t, int64(delay), int64(time.Millisecond*500))
+		assert.LessOrEqual(t, int64(delay), int64(time.Millisecond*1500))
+	}
+}
+
+func TestRetryPolicyNonRetryable(t *testing.T) {
+	permanent := errors.New("permanent")
+	p := bus.RetryPolicy{MaxAttempts: 10, NonRetryable: func(err error) bool {
+		return errors.Is(err, permanent)
+	}}
+
+	_, ok := p.Next(1, 0, fmt.Errorf("wrapped: %w", permanent))
+	assert.False(t, ok)
+
+	_, ok = p.Next(1, 0, errRetry)
+	assert.True(t, ok)
+}
+
+func TestNeverRetry(t *testing.T) {
+	_, ok := bus.NeverRetry.Next(1, 0, errRetry)
+	assert.False(t, ok)
+
+	_, ok = bus.RetryPolicy{}.Next(1, 0, errRetry)
+	assert.False(t, ok)
+}
+
+func TestRetryPolicyOfDefault(t *testing.T) {
+	assert.Equal(t, 4, bus.RetryPolicyOf(errRetry, bus.DefaultRetryPolicy).MaxAttempts)
+}
+
+func TestDefaultRetryPolicyGivesUpOnClientErrors(t *testing.T) {
+	taken := cqrsErrs.Conflict.WithReason("user.email_taken")
+	invalid := cqrsErrs.NewValidationError()
+	invalid.Add("email", "is required")
+
+	for _, err := range []error{cqrsErrs.NotFound, fmt.Errorf("registering: %w", taken), invalid} {
+		_, ok := bus.DefaultRetryPolicy.Next(1, 0, err)
+		assert.False(t, ok, "retried %v", err)
+	}
+	for _, err := range []error{errRetry, cqrsErrs.InternalServerError, cqrsErrs.Conflict, cqrsErrs.RateLimited} {
+		_, ok := bus.DefaultRetryPolicy.Next(1, 0, err)
+		assert.True(t, ok, "didn't retry %v", err)
+	}
+}
@@ -0,0 +1,281 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/sarulabs/di/v2"
+)
+
+var (
+	// ErrSagaNotFound indicates a saga has no stored state for a correlation ID
+	ErrSagaNotFound = errors.New("cqrs.bus: saga not found")
+
+	// ErrNoScheduler indicates a saga requested a timeout without a scheduler configured
+	ErrNoScheduler = errors.New("cqrs.bus: saga timeouts require a scheduler")
+)
+
+// Saga is a long running process, which reacts to events by issuing commands.
+// Each instance of a saga keeps its own state, and is identified by a correlation ID
+type Saga interface {
+	// Saga returns the saga's unique name
+	Saga() string
+
+	// Events returns the events the saga listens to
+	Events() []Event
+
+	// Correlate returns the correlation ID of the instance an event belongs to.
+	// Events with an empty correlation ID are ignored
+	Correlate(Event) string
+
+	// NewState returns a pointer to the blank state of a new instance
+	NewState() interface{}
+
+	// Handle reacts to an event, mutating the instance's state, and returns the messages to route
+	Handle(context.Context, *SagaInstance, Event) ([]message.Message, error)
+
+	// Timeout reacts to a timeout the instance requested
+	Timeout(context.Context, *SagaInstance, string) ([]message.Message, error)
+}
+
+// SagaType can be embedded in sagas to provide sane defaults
+// for the Saga interface
+type SagaType struct {
+}
+
+// Correlate implements the Saga interface, using the event's correlation ID metadata.
+// This is the ID of the event's causal chain, unless set with WithCorrelationID
+func (SagaType) Correlate(e Event) string {
+	return e.HasMetadata()[CorrelationIDKey.String()]
+}
+
+// Timeout implements the Saga interface, ignoring timeouts
+func (SagaType) Timeout(context.Context, *SagaInstance, string) ([]message.Message, error) {
+	return nil, nil
+}
+
+// SagaInstance is one running instance of a saga
+type SagaInstance struct {
+	CorrelationID string
+
+	// State is the pointer returned by the saga's NewState, filled with the instance's stored state
+	State interface{}
+
+	completed bool
+	timeouts  []sagaTimeoutRequest
+}
+
+type sagaTimeoutRequest struct {
+	at   time.Time
+	name string
+}
+
+// Complete finishes the instance. Completed instances ignore further events and timeouts
+func (i *SagaInstance) Complete() {
+	i.completed = true
+}
+
+// Completed returns whether the instance has finished
+func (i *SagaInstance) Completed() bool {
+	return i.completed
+}
+
+// Timeout requests the saga's Timeout method is called with name after a duration.
+// Timeouts may arrive after the instance has moved on, so sagas should check their state
+func (i *SagaInstance) Timeout(after time.Duration, name string) {
+	i.timeouts = append(i.timeouts, sagaTimeoutRequest{at: time.Now().Add(after), name: name})
+}
+
+// SagaRecord is the stored state of a saga instance
+type SagaRecord struct {
+	Saga          string
+	CorrelationID string
+	State         []byte
+	Completed     bool
+
+	// Version is incremented on every save, and used for optimistic locking
+	Version int64
+}
+
+// SagaStore stores the state of saga instances
+type SagaStore interface {
+	// Load returns an instance's state, or ErrSagaNotFound
+	Load(ctx context.Context, saga string, correlationID string) (SagaRecord, error)
+
+	// Save stores an instance's state, expecting the stored version to be one behind
+	// the record's version. Returns ErrConcurrencyViolation otherwise
+	Save(context.Context, SagaRecord) error
+}
+
+// Scheduler executes a command at a later time
+type Scheduler interface {
+	Schedule(ctx context.Context, at time.Time, cmd Command) error
+}
+
+// SagaTimeout is dispatched by the scheduler to deliver a saga's timeout
+type SagaTimeout struct {
+	CommandType
+
+	Saga          string
+	CorrelationID string
+	Name          string
+}
+
+// Command implements the Command interface
+func (SagaTimeout) Command() string {
+	return "cqrs.saga.timeout"
+}
+
+// Valid implements the Command interface
+func (c SagaTimeout) Valid() error {
+	if c.Saga == "" || c.CorrelationID == "" {
+		return errors.New("saga timeout requires a saga and correlation ID")
+	}
+	return nil
+}
+
+// NewSagaModule returns a module routing the sagas' events and timeouts.
+// The scheduler may be nil if no saga uses timeouts
+func NewSagaModule(store SagaStore, scheduler Scheduler, sagas ...Saga) Module {
+	timeouts := sagaTimeoutHandler{sagas: make(map[string]sagaHandler)}
+	handlers := make([]sagaHandler, len(sagas))
+	defs := make([]Def, 0, len(sagas)+1)
+	for i, saga := range sagas {
+		if _, exists := timeouts.sagas[saga.Saga()]; exists {
+			panic(fmt.Sprint("Cannot register saga twice: ", saga.Saga()))
+		}
+		handler := sagaHandler{saga: saga, store: store, scheduler: scheduler}
+		handlers[i] = handler
+		timeouts.sagas[saga.Saga()] = handler
+		defs = append(defs, Def{
+			Name: handler.HandlerName(),
+			Build: func(ctn di.Container) (interface{}, error) {
+				return handler, nil
+			},
+		})
+	}
+	defs = append(defs, Def{
+		Name: timeouts,
+		Build: func(ctn di.Container) (interface{}, error) {
+			return timeouts, nil
+		},
+	})
+
+	return FuncModule{
+		EventsFunc: func(b EventBuilder) {
+			for _, handler := range handlers {
+				b.Event(handler.saga.Events()...).Handled(handler)
+			}
+		},
+		CommandsFunc: func(b CmdBuilder) {
+			b.Command(SagaTimeout{}).Handled(timeouts)
+		},
+		Defs: defs,
+	}
+}
+
+var _ NamedEventHandler = sagaHandler{}
+
+// sagaHandler adapts a saga to an event handler, loading and
+// saving the instance around each event
+type sagaHandler struct {
+	saga      Saga
+	store     SagaStore
+	scheduler Scheduler
+}
+
+// HandlerName implements NamedEventHandler, as all sagas share the handler type
+func (h sagaHandler) HandlerName() string {
+	return "cqrs.saga." + h.saga.Saga()
+}
+
+func (h sagaHandler) Handle(ctx context.Context, e Event) ([]message.Message, error) {
+	id := h.saga.Correlate(e)
+	if id == "" {
+		log.Warn(ctx, "ignoring uncorrelated saga event", log.F{"saga": h.saga.Saga(), "event": e.Event()})
+		return nil, nil
+	}
+
+	return h.run(ctx, id, func(ctx context.Context, instance *SagaInstance) ([]message.Message, error) {
+		return h.saga.Handle(ctx, instance, e)
+	})
+}
+
+func (h sagaHandler) timeout(ctx context.Context, id string, name string) ([]message.Message, error) {
+	return h.run(ctx, id, func(ctx context.Context, instance *SagaInstance) ([]message.Message, error) {
+		return h.saga.Timeout(ctx, instance, name)
+	})
+}
+
+// run loads an instance, runs fn against it, then saves it and schedules its timeouts.
+// Timeouts are scheduled once the instance is saved, so an instance that's retried
+// after a concurrent update doesn't schedule them twice
+func (h sagaHandler) run(ctx context.Context, id string, fn func(context.Context, *SagaInstance) ([]message.Message, error)) ([]message.Message, error) {
+	record, err := h.store.Load(ctx, h.saga.Saga(), id)
+	if err == ErrSagaNotFound {
+		record = SagaRecord{Saga: h.saga.Saga(), CorrelationID: id}
+	} else if err != nil {
+		return nil, err
+	}
+
+	instance := &SagaInstance{CorrelationID: id, State: h.saga.NewState(), completed: record.Completed}
+	if instance.completed {
+		return nil, nil
+	}
+	if record.State != nil {
+		err = json.Unmarshal(record.State, instance.State)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msgs, err := fn(WithCorrelationID(ctx, id), instance)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instance.timeouts) > 0 && h.scheduler == nil {
+		return nil, ErrNoScheduler
+	}
+
+	record.State, err = json.Marshal(instance.State)
+	if err != nil {
+		return nil, err
+	}
+	record.Completed = instance.completed
+	record.Version++
+	err = h.store.Save(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, timeout := range instance.timeouts {
+		err = h.scheduler.Schedule(ctx, timeout.at, SagaTimeout{Saga: h.saga.Saga(), CorrelationID: id, Name: timeout.name})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return msgs, nil
+}
+
+// sagaTimeoutHandler delivers timeouts to the saga that requested them
+type sagaTimeoutHandler struct {
+	sagas map[string]sagaHandler
+}
+
+func (h sagaTimeoutHandler) Execute(ctx context.Context, c Command) (CommandResponse, []message.Message) {
+	timeout := c.(SagaTimeout)
+	handler, ok := h.sagas[timeout.Saga]
+	if !ok {
+		return CommandResponse{Error: fmt.Errorf("unknown saga: %s", timeout.Saga)}, nil
+	}
+
+	msgs, err := handler.timeout(ctx, timeout.CorrelationID, timeout.Name)
+	return CommandResponse{Error: err, ID: timeout.CorrelationID}, msgs
+}
@@ -0,0 +1,2 @@
+// Package saga contains the saga state stores
+package saga
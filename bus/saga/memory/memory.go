@@ -0,0 +1,48 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+)
+
+var _ bus.SagaStore = (*MemorySagaStore)(nil)
+
+type sagaKey struct {
+	saga          string
+	correlationID string
+}
+
+// MemorySagaStore keeps the state of saga instances in memory
+type MemorySagaStore struct {
+	records map[sagaKey]bus.SagaRecord
+
+	mx sync.Mutex
+}
+
+func (s *MemorySagaStore) Load(ctx context.Context, saga string, correlationID string) (bus.SagaRecord, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	record, ok := s.records[sagaKey{saga, correlationID}]
+	if !ok {
+		return bus.SagaRecord{}, bus.ErrSagaNotFound
+	}
+	return record, nil
+}
+
+func (s *MemorySagaStore) Save(ctx context.Context, record bus.SagaRecord) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.records == nil {
+		s.records = make(map[sagaKey]bus.SagaRecord)
+	}
+	key := sagaKey{record.Saga, record.CorrelationID}
+	if s.records[key].Version != record.Version-1 {
+		return bus.ErrConcurrencyViolation
+	}
+	s.records[key] = record
+	return nil
+}
@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	_ "github.com/lib/pq"
+)
+
+var _ bus.SagaStore = (*PostgresSagaStore)(nil)
+
+// New returns a saga store, creating its table if required
+func New(c Config) *PostgresSagaStore {
+	db, err := sql.Open("postgres", c.DBDsn())
+	if err != nil {
+		panic(err)
+	}
+	err = db.Ping()
+	if err != nil {
+		panic(err)
+	}
+
+	schema := PostgreSQLSchema{c}
+	err = schema.Make()
+	if err != nil {
+		panic(err)
+	}
+	return &PostgresSagaStore{db: db}
+}
+
+// PostgresSagaStore keeps the state of saga instances in PostgreSQL
+type PostgresSagaStore struct {
+	db *sql.DB
+}
+
+func (s *PostgresSagaStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresSagaStore) Load(ctx context.Context, saga string, correlationID string) (bus.SagaRecord, error) {
+	record := bus.SagaRecord{Saga: saga, CorrelationID: correlationID}
+	row := s.db.QueryRowContext(ctx, `SELECT state, completed, version FROM sagas
+		WHERE saga = $1 AND correlation_id = $2`, saga, correlationID)
+	err := row.Scan(&record.State, &record.Completed, &record.Version)
+	if err == sql.ErrNoRows {
+		return record, bus.ErrSagaNotFound
+	}
+	return record, err
+}
+
+func (s *PostgresSagaStore) Save(ctx context.Context, record bus.SagaRecord) error {
+	var result sql.Result
+	var err error
+	if record.Version == 1 {
+		result, err = s.db.ExecContext(ctx, `INSERT INTO sagas (saga, correlation_id, state, completed, version, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (saga, correlation_id) DO NOTHING`,
+			record.Saga, record.CorrelationID, record.State, record.Completed, record.Version, time.Now())
+	} else {
+		result, err = s.db.ExecContext(ctx, `UPDATE sagas
+			SET state = $3, completed = $4, version = $5, updated_at = $6
+			WHERE saga = $1 AND correlation_id = $2 AND version = $5 - 1`,
+			record.Saga, record.CorrelationID, record.State, record.Completed, record.Version, time.Now())
+	}
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return bus.ErrConcurrencyViolation
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package postgres
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+)
+
+// PostgreSQLSchema creates the saga store's table
+type PostgreSQLSchema struct {
+	Config Config
+}
+
+func (s PostgreSQLSchema) Make() error {
+	log.Print("Creating saga store")
+	db, err := sql.Open("postgres", s.Config.DBDsn())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS sagas (
+		"saga" VARCHAR(128) NOT NULL,
+		"correlation_id" VARCHAR(128) NOT NULL,
+		"state" BYTEA NOT NULL,
+		"completed" BOOLEAN NOT NULL DEFAULT FALSE,
+		"version" BIGINT NOT NULL,
+		"updated_at" TIMESTAMP NOT NULL,
+		PRIMARY KEY ("saga", "correlation_id")
+	);`)
+	return err
+}
+
+func (s PostgreSQLSchema) Reset() {
+	log.Print("Resetting saga store")
+	db, err := sql.Open("postgres", s.Config.DBDsn())
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DELETE FROM sagas")
+	if err != nil && !strings.Contains(err.Error(), "does not exist") {
+		panic(err)
+	}
+}
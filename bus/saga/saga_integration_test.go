@@ -0,0 +1,102 @@
+// +build !unit
+
+package saga_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/saga/memory"
+	"github.com/GabrielCarpr/cqrs/bus/saga/postgres"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMemorySagaStore(t *testing.T) {
+	suite.Run(t, &SagaStoreBlackboxTest{factory: func() bus.SagaStore {
+		return &memory.MemorySagaStore{}
+	}})
+}
+
+func TestPostgresSagaStore(t *testing.T) {
+	c := postgres.Config{
+		DBName: "cqrs",
+		DBPass: "cqrs",
+		DBHost: "db",
+		DBUser: "cqrs",
+	}
+	s := &SagaStoreBlackboxTest{
+		factory: func() bus.SagaStore {
+			return postgres.New(c)
+		},
+	}
+	s.setupHook = func() error {
+		schema := postgres.PostgreSQLSchema{Config: c}
+		schema.Reset()
+		return nil
+	}
+	suite.Run(t, s)
+}
+
+type SagaStoreBlackboxTest struct {
+	suite.Suite
+
+	factory   func() bus.SagaStore
+	setupHook func() error
+
+	store bus.SagaStore
+	id    string
+}
+
+func (s *SagaStoreBlackboxTest) SetupTest() {
+	if s.setupHook != nil {
+		err := s.setupHook()
+		if err != nil {
+			panic(err)
+		}
+	}
+	s.store = s.factory()
+	s.id = uuid.New().String()
+}
+
+func (s *SagaStoreBlackboxTest) record(version int64, state string) bus.SagaRecord {
+	return bus.SagaRecord{
+		Saga:          "order",
+		CorrelationID: s.id,
+		State:         []byte(state),
+		Version:       version,
+	}
+}
+
+func (s *SagaStoreBlackboxTest) TestNoInstance() {
+	_, err := s.store.Load(context.Background(), "order", s.id)
+	s.Equal(bus.ErrSagaNotFound, err)
+}
+
+func (s *SagaStoreBlackboxTest) TestSavesAndLoads() {
+	s.Require().NoError(s.store.Save(context.Background(), s.record(1, `{"Placed":1}`)))
+	completed := s.record(2, `{"Placed":2}`)
+	completed.Completed = true
+	s.Require().NoError(s.store.Save(context.Background(), completed))
+
+	result, err := s.store.Load(context.Background(), "order", s.id)
+	s.Require().NoError(err)
+	s.Equal(int64(2), result.Version)
+	s.True(result.Completed)
+	s.JSONEq(`{"Placed":2}`, string(result.State))
+
+	_, err = s.store.Load(context.Background(), "other", s.id)
+	s.Equal(bus.ErrSagaNotFound, err)
+}
+
+func (s *SagaStoreBlackboxTest) TestDetectsConcurrentSaves() {
+	s.Require().NoError(s.store.Save(context.Background(), s.record(1, `{}`)))
+
+	err := s.store.Save(context.Background(), s.record(1, `{}`))
+	s.Equal(bus.ErrConcurrencyViolation, err)
+
+	s.Require().NoError(s.store.Save(context.Background(), s.record(2, `{}`)))
+	err = s.store.Save(context.Background(), s.record(2, `{}`))
+	s.Equal(bus.ErrConcurrencyViolation, err)
+}
@@ -0,0 +1,242 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"github.com/stretchr/testify/suite"
+)
+
+type orderPlaced struct {
+	EventType
+}
+
+func (orderPlaced) Event() string {
+	return "order.placed"
+}
+
+type orderPaid struct {
+	EventType
+}
+
+func (orderPaid) Event() string {
+	return "order.paid"
+}
+
+type cancelOrder struct {
+	CommandType
+
+	Reason string
+}
+
+func (cancelOrder) Command() string {
+	return "order.cancel"
+}
+
+func (cancelOrder) Valid() error {
+	return nil
+}
+
+type orderState struct {
+	Placed int
+	Paid   bool
+}
+
+type orderSaga struct {
+	SagaType
+}
+
+func (orderSaga) Saga() string {
+	return "order"
+}
+
+func (orderSaga) Events() []Event {
+	return []Event{&orderPlaced{}, &orderPaid{}}
+}
+
+func (orderSaga) NewState() interface{} {
+	return &orderState{}
+}
+
+func (orderSaga) Handle(ctx context.Context, i *SagaInstance, e Event) ([]message.Message, error) {
+	state := i.State.(*orderState)
+	switch e.(type) {
+	case *orderPlaced:
+		state.Placed++
+		i.Timeout(time.Hour, "payment")
+	case *orderPaid:
+		state.Paid = true
+		i.Complete()
+	}
+	return nil, nil
+}
+
+func (orderSaga) Timeout(ctx context.Context, i *SagaInstance, name string) ([]message.Message, error) {
+	if i.State.(*orderState).Paid {
+		return nil, nil
+	}
+	return []message.Message{cancelOrder{Reason: name}}, nil
+}
+
+// sagaStore is a minimal SagaStore, as the memory store's package imports bus
+type sagaStore struct {
+	records map[string]SagaRecord
+}
+
+func (s *sagaStore) Load(ctx context.Context, saga string, id string) (SagaRecord, error) {
+	record, ok := s.records[saga+id]
+	if !ok {
+		return SagaRecord{}, ErrSagaNotFound
+	}
+	return record, nil
+}
+
+func (s *sagaStore) Save(ctx context.Context, record SagaRecord) error {
+	if s.records[record.Saga+record.CorrelationID].Version != record.Version-1 {
+		return ErrConcurrencyViolation
+	}
+	s.records[record.Saga+record.CorrelationID] = record
+	return nil
+}
+
+type scheduled struct {
+	at  time.Time
+	cmd Command
+}
+
+type scheduler struct {
+	scheduled []scheduled
+}
+
+func (s *scheduler) Schedule(ctx context.Context, at time.Time, cmd Command) error {
+	s.scheduled = append(s.scheduled, scheduled{at, cmd})
+	return nil
+}
+
+func TestSagas(t *testing.T) {
+	suite.Run(t, new(SagaTest))
+}
+
+type SagaTest struct {
+	suite.Suite
+
+	store     *sagaStore
+	scheduler *scheduler
+	handler   EventHandler
+	timeouts  CommandHandler
+}
+
+func (s *SagaTest) SetupTest() {
+	s.store = &sagaStore{records: make(map[string]SagaRecord)}
+	s.scheduler = &scheduler{}
+	module := NewSagaModule(s.store, s.scheduler, orderSaga{})
+
+	for _, def := range module.Services() {
+		service, err := def.Build(nil)
+		s.Require().NoError(err)
+		switch v := service.(type) {
+		case EventHandler:
+			s.handler = v
+		case CommandHandler:
+			s.timeouts = v
+		}
+	}
+}
+
+func (s *SagaTest) event(e Event, id string) Event {
+	e.WithMetadata(Metadata{CorrelationIDKey.String(): id})
+	return e
+}
+
+func (s *SagaTest) TestRoutesSagaEvents() {
+	router := NewMessageRouter()
+	module := NewSagaModule(s.store, s.scheduler, orderSaga{})
+	router.ExtendEvents(module.Events)
+	router.ExtendCommands(module.Commands)
+
+	route := router.RouteEvent(&orderPaid{})
+	s.Require().Len(route.handlers, 1)
+	s.Equal("cqrs.saga.order", EventHandlerName(route.handlers[0].handler))
+
+	_, ok := router.RouteCommand(SagaTimeout{})
+	s.True(ok)
+}
+
+func (s *SagaTest) TestKeepsStatePerCorrelationID() {
+	_, err := s.handler.Handle(context.Background(), s.event(&orderPlaced{}, "1"))
+	s.Require().NoError(err)
+	_, err = s.handler.Handle(context.Background(), s.event(&orderPlaced{}, "1"))
+	s.Require().NoError(err)
+	_, err = s.handler.Handle(context.Background(), s.event(&orderPlaced{}, "2"))
+	s.Require().NoError(err)
+
+	s.JSONEq(`{"Placed":2,"Paid":false}`, string(s.store.records["order1"].State))
+	s.Equal(int64(2), s.store.records["order1"].Version)
+	s.JSONEq(`{"Placed":1,"Paid":false}`, string(s.store.records["order2"].State))
+}
+
+func (s *SagaTest) TestIgnoresUncorrelatedEvents() {
+	_, err := s.handler.Handle(context.Background(), &orderPlaced{})
+	s.Require().NoError(err)
+	s.Empty(s.store.records)
+}
+
+func (s *SagaTest) TestSchedulesTimeouts() {
+	_, err := s.handler.Handle(context.Background(), s.event(&orderPlaced{}, "1"))
+	s.Require().NoError(err)
+
+	s.Require().Len(s.scheduler.scheduled, 1)
+	s.WithinDuration(time.Now().Add(time.Hour), s.scheduler.scheduled[0].at, time.Second)
+	s.Equal(SagaTimeout{Saga: "order", CorrelationID: "1", Name: "payment"}, s.scheduler.scheduled[0].cmd)
+
+	res, msgs := s.timeouts.Execute(context.Background(), s.scheduler.scheduled[0].cmd)
+	s.Require().NoError(res.Error)
+	s.Equal([]message.Message{cancelOrder{Reason: "payment"}}, msgs)
+}
+
+func (s *SagaTest) TestCompletedSagasIgnoreTimeouts() {
+	_, err := s.handler.Handle(context.Background(), s.event(&orderPlaced{}, "1"))
+	s.Require().NoError(err)
+	_, err = s.handler.Handle(context.Background(), s.event(&orderPaid{}, "1"))
+	s.Require().NoError(err)
+	s.True(s.store.records["order1"].Completed)
+
+	res, msgs := s.timeouts.Execute(context.Background(), s.scheduler.scheduled[0].cmd)
+	s.Require().NoError(res.Error)
+	s.Empty(msgs)
+
+	_, err = s.handler.Handle(context.Background(), s.event(&orderPlaced{}, "1"))
+	s.Require().NoError(err)
+	s.Equal(int64(2), s.store.records["order1"].Version)
+}
+
+func (s *SagaTest) TestDetectsConcurrentUpdates() {
+	_, err := s.handler.Handle(context.Background(), s.event(&orderPlaced{}, "1"))
+	s.Require().NoError(err)
+
+	module := NewSagaModule(racingSagaStore{s.store}, s.scheduler, orderSaga{})
+	handler, err := module.Services()[0].Build(nil)
+	s.Require().NoError(err)
+
+	_, err = handler.(EventHandler).Handle(context.Background(), s.event(&orderPlaced{}, "1"))
+	s.Equal(ErrConcurrencyViolation, err)
+	s.Len(s.scheduler.scheduled, 1, "scheduled a timeout for a conflicting update")
+}
+
+// racingSagaStore updates an instance after it is loaded, as if another handler had
+type racingSagaStore struct {
+	*sagaStore
+}
+
+func (s racingSagaStore) Load(ctx context.Context, saga string, id string) (SagaRecord, error) {
+	record, err := s.sagaStore.Load(ctx, saga, id)
+	if err != nil {
+		return record, err
+	}
+	updated := record
+	updated.Version++
+	s.records[saga+id] = updated
+	return record, nil
+}
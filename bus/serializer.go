@@ -23,13 +23,8 @@ type SerialType int
 
 type SerializedContext map[string]string
 
-var contextMap map[fmt.Stringer]reflect.Type
-var messageMap map[string]reflect.Type
-
-func init() {
-	contextMap = make(map[fmt.Stringer]reflect.Type)
-	messageMap = make(map[string]reflect.Type)
-}
+var contextMap = make(map[fmt.Stringer]reflect.Type)
+var messageMap = make(map[string]reflect.Type)
 
 func msgKey(msg message.Message) string {
 	return reflect.TypeOf(msg).String()
@@ -81,6 +76,12 @@ func DeserializeContext(ctx context.Context, data SerializedContext) context.Con
 			continue
 		}
 
+		// Strings are serialized as is, so may look like other JSON values
+		if t.Kind() == reflect.String {
+			ctx = context.WithValue(ctx, name, reflect.ValueOf(val).Convert(t).Interface())
+			continue
+		}
+
 		if !json.Valid([]byte(val)) {
 			ctx = context.WithValue(ctx, name, val)
 			continue
@@ -112,6 +112,15 @@ func (s *SerializerSuite) TestDeserializeString() {
 	s.Equal("hi", val.(string))
 }
 
+func (s *SerializerSuite) TestDeserializeNumericString() {
+	ctx := context.WithValue(context.Background(), stringKey, "123")
+
+	ctx = bus.DeserializeContext(context.Background(), bus.SerializeContext(ctx))
+
+	val := ctx.Value(stringKey)
+	s.Equal("123", val.(string))
+}
+
 func (s *SerializerSuite) TestDeserializeMap() {
 	serial := map[string]string{
 		"mapKey": "{\"hello\":\"hi\"}",
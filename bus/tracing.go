@@ -0,0 +1,155 @@
+package bus
+
+import (
+	"context"
+
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation name of the bus's spans
+const tracerName = "github.com/GabrielCarpr/cqrs/bus"
+
+// traceParentKey is the context key of a message's W3C trace context. It's set when
+// a message is queued, or an event published, so the spans of asynchronous work
+// continue the trace that caused them
+var traceParentKey = contextKey("traceparent")
+
+func init() {
+	RegisterContextKey(traceParentKey, "")
+}
+
+var traceContext = propagation.TraceContext{}
+
+// UseTracing traces commands, queries and events with the tracer provider's spans,
+// including their handlers, the queue, and the event store. Trace context is carried
+// in messages' metadata, so queued messages and events continue their trace
+func UseTracing(tp trace.TracerProvider) Config {
+	return func(b *Bus) error {
+		b.tracerProvider = tp
+		b.tracer = tp.Tracer(tracerName)
+		return nil
+	}
+}
+
+// TraceEventStore returns an event store whose appends and streams are traced,
+// for repositories that use the store directly. The bus traces its event store
+// itself when UseTracing is configured
+func TraceEventStore(s EventStore, tp trace.TracerProvider) EventStore {
+	return tracedEventStore{s, tp.Tracer(tracerName)}
+}
+
+type tracedEventStore struct {
+	EventStore
+	tracer trace.Tracer
+}
+
+func (s tracedEventStore) Append(ctx context.Context, v ExpectedVersion, events ...Event) (err error) {
+	ctx, span := s.tracer.Start(ctx, "eventstore.append", trace.WithAttributes(attribute.Int("cqrs.events", len(events))))
+	defer func() { endSpan(span, err) }()
+
+	return s.EventStore.Append(ctx, v, events...)
+}
+
+func (s tracedEventStore) Stream(ctx context.Context, stream Stream, q Select) (err error) {
+	ctx, span := s.tracer.Start(ctx, "eventstore.stream", trace.WithAttributes(
+		attribute.String("cqrs.aggregate", q.Type),
+		attribute.String("cqrs.owner", q.ID),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return s.EventStore.Stream(ctx, stream, q)
+}
+
+// endSpan records the error a span ended with, if any
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// withTraceParent returns a context carrying the trace context of its span, so
+// it's serialized with the context
+func withTraceParent(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{}
+	traceContext.Inject(ctx, carrier)
+	if parent := carrier.Get(traceParentKey.String()); parent != "" {
+		return context.WithValue(ctx, traceParentKey, parent)
+	}
+	return ctx
+}
+
+// continueTrace returns a context continuing the serialized trace context of a
+// queued message or event, unless the context already has a span
+func continueTrace(ctx context.Context, parent string) context.Context {
+	if parent == "" || trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	return traceContext.Extract(ctx, propagation.MapCarrier{traceParentKey.String(): parent})
+}
+
+// traceEvent records the trace context of the context's span in the event's metadata
+func traceEvent(ctx context.Context, e Event) {
+	if parent, ok := withTraceParent(ctx).Value(traceParentKey).(string); ok && trace.SpanContextFromContext(ctx).IsValid() {
+		e.WithMetadata(Metadata{traceParentKey.String(): parent})
+	}
+}
+
+// enqueue publishes messages to the queue within a producer span, carrying its trace context
+func (b *Bus) enqueue(ctx context.Context, msgs ...message.Message) (err error) {
+	ctx, span := b.tracer.Start(ctx, "queue.publish", trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(
+		attribute.String("cqrs.message_id", MessageID(ctx)),
+		attribute.String("cqrs.topic", Topic(ctx)),
+	))
+	defer func() { endSpan(span, err) }()
+
+	return b.queue.Publish(withQueuedAt(withTraceParent(ctx)), msgs...)
+}
+
+// consume runs a queued message within a consumer span, continuing the trace it was queued in
+func (b *Bus) consume(ctx context.Context, msg message.Message, fn func(context.Context) error) (err error) {
+	parent, _ := ctx.Value(traceParentKey).(string)
+	ctx, span := b.tracer.Start(continueTrace(ctx, parent), "queue.consume", trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(
+		attribute.String("cqrs.message_id", MessageID(ctx)),
+		attribute.String("cqrs.message_type", string(msg.MessageType())),
+	))
+	defer func() { endSpan(span, err) }()
+
+	b.observeQueueWait(ctx, msg)
+	return fn(ctx)
+}
+
+// traceCommandHandler runs a command handler within a span
+func (b *Bus) traceCommandHandler(name string, next CommandHandler) CommandHandler {
+	return CmdMiddlewareFunc(func(ctx context.Context, c Command) (CommandResponse, []message.Message) {
+		ctx, span := b.tracer.Start(ctx, "handle "+c.Command(), trace.WithAttributes(attribute.String("cqrs.handler", name)))
+		res, msgs := next.Execute(ctx, c)
+		endSpan(span, res.Error)
+		return res, msgs
+	})
+}
+
+// traceQueryHandler runs a query handler within a span
+func (b *Bus) traceQueryHandler(name string, next QueryHandler) QueryHandler {
+	return QueryMiddlewareFunc(func(ctx context.Context, q Query, res interface{}) error {
+		ctx, span := b.tracer.Start(ctx, "handle "+q.Query(), trace.WithAttributes(attribute.String("cqrs.handler", name)))
+		err := next.Execute(ctx, q, res)
+		endSpan(span, err)
+		return err
+	})
+}
+
+// traceEventHandler runs an event handler within a span
+func (b *Bus) traceEventHandler(name string, next EventHandler) EventHandler {
+	return EventHandlerFunc(func(ctx context.Context, e Event) ([]message.Message, error) {
+		ctx, span := b.tracer.Start(ctx, "handle "+e.Event(), trace.WithAttributes(attribute.String("cqrs.handler", name)))
+		msgs, err := next.Handle(ctx, e)
+		endSpan(span, err)
+		return msgs, err
+	})
+}
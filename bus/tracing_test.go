@@ -0,0 +1,65 @@
+package bus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	"github.com/GabrielCarpr/cqrs/eventstore/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, len(spans))
+	for i, span := range spans {
+		names[i] = span.Name
+	}
+	return names
+}
+
+func TestTracesAsyncWorkInOneTrace(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	c := &chain{contexts: make(map[string]context.Context)}
+	ctx, cancel := context.WithCancel(context.Background())
+	queue := queueMemory.NewMemoryQueue(queueMemory.Config{})
+	b := bus.Default(ctx, []bus.Module{chainModule(c)}, bus.UseQueue(queue), bus.UseTracing(tp))
+	defer runBus(b, cancel)()
+
+	_, err := b.Dispatch(context.Background(), renameCmd{}, true)
+	require.NoError(t, err)
+	require.NoError(t, queue.Wait(time.Second))
+
+	spans := exporter.GetSpans()
+	names := spanNames(spans)
+	for _, name := range []string{
+		"dispatch rename", "handle rename", "publish", "fan out event.test",
+		"queue.publish", "queue.consume", "handle event.test", "dispatch follow", "handle follow",
+	} {
+		assert.Contains(t, names, name)
+	}
+	for _, span := range spans {
+		assert.Equal(t, spans[0].SpanContext.TraceID(), span.SpanContext.TraceID(), span.Name)
+	}
+}
+
+func TestTracesEventStore(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	store := bus.TraceEventStore(&memory.MemoryEventStore{}, sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	buffer := bus.NewEventBuffer(uuid.New(), "test")
+	buffer.Buffer(true, &TestEvent{Payload: "lol"})
+	require.NoError(t, store.Append(context.Background(), bus.Any, buffer.Events(context.Background())...))
+
+	stream := make(chan bus.Event, 1)
+	require.NoError(t, store.Stream(context.Background(), stream, bus.Select{}))
+
+	assert.Equal(t, []string{"eventstore.append", "eventstore.stream"}, spanNames(exporter.GetSpans()))
+}
@@ -1,11 +1,42 @@
 // Package errors includes standard error helpers
 package errors
 
+import (
+	"encoding/json"
+	stdErrors "errors"
+)
+
 var (
 	// InternalServerError is an error that has been hidden from the port-interface
-	InternalServerError = Error{500, "Internal server error"}
+	InternalServerError = Error{Code: 500, Message: "Internal server error"}
+
+	// Conflict is an error indicating the request conflicted with a concurrent change
+	Conflict = Error{Code: 409, Message: "Conflict"}
+
+	// NotFound is an error indicating the requested entity doesn't exist
+	NotFound = Error{Code: 404, Message: "Not found"}
+
+	// Validation is an error indicating the request was invalid. ValidationError
+	// reports which fields were invalid, and is Validation
+	Validation = Error{Code: 422, Message: "Validation failed"}
+
+	// Unauthorized is an error indicating the request lacked valid credentials
+	Unauthorized = Error{Code: 401, Message: "Unauthorized"}
+
+	// RateLimited is an error indicating too many requests were made
+	RateLimited = Error{Code: 429, Message: "Too many requests"}
 )
 
+// classes are the messages of the error classes above, by their code
+var classes = map[int]string{
+	InternalServerError.Code: InternalServerError.Message,
+	Conflict.Code:            Conflict.Message,
+	NotFound.Code:            NotFound.Message,
+	Validation.Code:          Validation.Message,
+	Unauthorized.Code:        Unauthorized.Message,
+	RateLimited.Code:         RateLimited.Message,
+}
+
 // Error is a port-interface visible error
 // If an error is provided to a port and it's not an Error,
 // it should be hidden
@@ -13,19 +44,141 @@ var (
 // Ports will interpret Error however they choose. Eg, CLI may just show the
 // message, and HTTP may show the message and the error code. Or, HTTP
 // may maintain a mapping from codes to HTTP statuses
+//
+// Reason is a machine-readable code, eg user.email_taken, and Details is any
+// extra information for clients. The classes above are built on with the With
+// methods:
+//
+//	errors.Conflict.WithReason("user.email_taken").WithMessage("Email is taken")
+//
+// An Error can wrap the internal error that caused it, which is available to
+// errors.Is and errors.As but never shown to ports. Details and the cause are
+// held by reference, so Errors can always be compared with ==, but only Errors
+// sharing them are equal
 type Error struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int
+	Reason  string
+	Message string
+
+	extra *extra
+}
+
+// extra holds an Error's details and cause
+type extra struct {
+	details interface{}
+	cause   error
+}
+
+// New returns an error with a code, reason and message
+func New(code int, reason, message string) Error {
+	return Error{Code: code, Reason: reason, Message: message}
 }
 
 func (e Error) Error() string {
 	return e.Message
 }
 
-// Block hides non-Error errors
-func Block(e error) Error {
-	err, ok := e.(Error)
+// WithReason returns a copy of the error with a machine-readable reason
+func (e Error) WithReason(reason string) Error {
+	e.Reason = reason
+	return e
+}
+
+// WithMessage returns a copy of the error with a message
+func (e Error) WithMessage(message string) Error {
+	e.Message = message
+	return e
+}
+
+// WithDetails returns a copy of the error with details
+func (e Error) WithDetails(details interface{}) Error {
+	e.extra = &extra{details: details, cause: e.Unwrap()}
+	return e
+}
+
+// Details returns the error's details
+func (e Error) Details() interface{} {
+	if e.extra == nil {
+		return nil
+	}
+	return e.extra.details
+}
+
+// Wrap returns a copy of the error caused by an internal error
+func (e Error) Wrap(cause error) Error {
+	e.extra = &extra{details: e.Details(), cause: cause}
+	return e
+}
+
+// Unwrap returns the error's cause
+func (e Error) Unwrap() error {
+	if e.extra == nil {
+		return nil
+	}
+	return e.extra.cause
+}
+
+// Is reports whether the error matches the target. Any error with a class's code
+// is that class, eg errors.Is(err, errors.NotFound). A target with a reason matches
+// errors with the same code and reason, and other targets match errors with the
+// same code and message
+func (e Error) Is(target error) bool {
+	t, ok := target.(Error)
 	if !ok {
+		return false
+	}
+	switch {
+	case t.Reason == "" && t.Message == classes[t.Code]:
+		return e.Code == t.Code
+	case t.Reason != "":
+		return e.Code == t.Code && e.Reason == t.Reason
+	default:
+		return e.Code == t.Code && e.Reason == "" && e.Message == t.Message
+	}
+}
+
+// jsonError is an Error's JSON
+type jsonError struct {
+	Code    int         `json:"code"`
+	Reason  string      `json:"reason,omitempty"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// MarshalJSON encodes the error's code, reason, message and details
+func (e Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonError{e.Code, e.Reason, e.Message, e.Details()})
+}
+
+// UnmarshalJSON decodes an error encoded by MarshalJSON
+func (e *Error) UnmarshalJSON(data []byte) error {
+	var decoded jsonError
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*e = Error{Code: decoded.Code, Reason: decoded.Reason, Message: decoded.Message}
+	if decoded.Details != nil {
+		*e = e.WithDetails(decoded.Details)
+	}
+	return nil
+}
+
+// Public finds the first port-interface visible error, an Error or
+// ValidationError, in an error's chain
+func Public(e error) (error, bool) {
+	for ; e != nil; e = stdErrors.Unwrap(e) {
+		switch e.(type) {
+		case Error, ValidationError:
+			return e, true
+		}
+	}
+	return nil, false
+}
+
+// Block hides non-Error errors, unwrapping an Error from a wrapped error
+func Block(e error) Error {
+	var err Error
+	if !stdErrors.As(e, &err) {
 		return InternalServerError
 	}
 	return err
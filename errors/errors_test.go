@@ -0,0 +1,85 @@
+package errors_test
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+var errDuplicate = stdErrors.New("duplicate key")
+
+func TestErrorIsItsClassAndReason(t *testing.T) {
+	taken := errors.Conflict.WithReason("user.email_taken").WithMessage("Email is taken")
+	err := fmt.Errorf("saving user: %w", taken.Wrap(errDuplicate))
+
+	assert.True(t, stdErrors.Is(err, errors.Conflict))
+	assert.True(t, stdErrors.Is(err, errors.New(409, "user.email_taken", "")))
+	assert.True(t, stdErrors.Is(err, errDuplicate))
+	assert.False(t, stdErrors.Is(err, errors.NotFound))
+	assert.False(t, stdErrors.Is(err, errors.Conflict.WithReason("user.name_taken")))
+	assert.Equal(t, "Email is taken", taken.Error())
+
+	var public errors.Error
+	assert.True(t, stdErrors.As(err, &public))
+	assert.Equal(t, "user.email_taken", public.Reason)
+}
+
+func TestValidationErrorIsValidation(t *testing.T) {
+	invalid := errors.NewValidationError()
+	invalid.Add("email", "is required")
+
+	assert.True(t, stdErrors.Is(fmt.Errorf("registering: %w", invalid), errors.Validation))
+	assert.False(t, stdErrors.Is(invalid, errors.Conflict))
+}
+
+func TestBlockUnwraps(t *testing.T) {
+	assert.Equal(t, errors.NotFound, errors.Block(fmt.Errorf("finding user: %w", errors.NotFound)))
+	assert.Equal(t, errors.InternalServerError, errors.Block(errDuplicate))
+}
+
+func TestPublic(t *testing.T) {
+	public, ok := errors.Public(fmt.Errorf("finding user: %w", errors.NotFound))
+	assert.True(t, ok)
+	assert.Equal(t, errors.NotFound, public)
+
+	_, ok = errors.Public(errDuplicate)
+	assert.False(t, ok)
+}
+
+func TestDistinctErrorsAreNotEqual(t *testing.T) {
+	userExists := errors.Error{Code: 400, Message: "User exists"}
+	roleNotFound := errors.Error{Code: 400, Message: "Role not found"}
+
+	assert.False(t, stdErrors.Is(roleNotFound, userExists))
+	assert.True(t, stdErrors.Is(fmt.Errorf("registering: %w", userExists), userExists))
+	assert.False(t, stdErrors.Is(errors.Conflict.WithMessage("Name is taken"), errors.Error{Code: 409, Message: "Email is taken"}))
+	assert.True(t, stdErrors.Is(errors.Conflict.WithMessage("Name is taken"), errors.Conflict))
+}
+
+func TestErrorsWithDetailsAreComparable(t *testing.T) {
+	invalid := errors.NewValidationError()
+	detailed := errors.NotFound.WithDetails(map[string]string{"id": "1"}).Wrap(invalid)
+
+	var err error = detailed
+	assert.NotPanics(t, func() {
+		assert.False(t, err == error(errors.NotFound.WithDetails(map[string]string{"id": "1"})))
+		assert.True(t, err == error(detailed))
+	})
+	assert.True(t, stdErrors.Is(err, detailed))
+	assert.Equal(t, map[string]string{"id": "1"}, detailed.Details())
+}
+
+func TestErrorJSON(t *testing.T) {
+	encoded, err := json.Marshal(errors.Conflict.WithReason("user.email_taken").WithDetails(map[string]string{"email": "a@example.com"}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"code": 409, "reason": "user.email_taken", "message": "Conflict", "details": {"email": "a@example.com"}}`, string(encoded))
+
+	var decoded errors.Error
+	assert.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, "user.email_taken", decoded.Reason)
+	assert.Equal(t, map[string]interface{}{"email": "a@example.com"}, decoded.Details())
+}
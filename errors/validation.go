@@ -0,0 +1,56 @@
+package errors
+
+import (
+	"sort"
+	"strings"
+)
+
+// ValidationError is a port-interface visible error reporting the invalid fields
+// of a command or query. Fields maps each invalid field's name to its problems
+type ValidationError struct {
+	Code    int                 `json:"code"`
+	Message string              `json:"message"`
+	Fields  map[string][]string `json:"fields"`
+}
+
+// NewValidationError returns a validation error without any invalid fields
+func NewValidationError() ValidationError {
+	return ValidationError{Code: Validation.Code, Message: Validation.Message, Fields: make(map[string][]string)}
+}
+
+// Add records a problem with a field
+func (e ValidationError) Add(field, problem string) {
+	e.Fields[field] = append(e.Fields[field], problem)
+}
+
+// Err returns the validation error if any fields are invalid, or nil
+func (e ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error lists each invalid field's problems, in order of the fields' names
+func (e ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	problems := make([]string, len(names))
+	for i, name := range names {
+		problems[i] = name + " " + strings.Join(e.Fields[name], ", ")
+	}
+	if len(problems) == 0 {
+		return e.Message
+	}
+	return e.Message + ": " + strings.Join(problems, "; ")
+}
+
+// Is reports whether the validation error matches the target, which it does as
+// an Error with its code and message, so errors.Is(err, errors.Validation) holds
+func (e ValidationError) Is(target error) bool {
+	return Error{Code: e.Code, Message: e.Message}.Is(target)
+}
@@ -275,7 +275,7 @@ func (s EventStoreBlackboxTest) TestSubscribesAll() {
 	}
 
 	var result []bus.Event
-	err := s.store.Subscribe(ctx, func(e bus.Event) error {
+	err := s.store.Subscribe(ctx, "test", func(e bus.Event) error {
 		result = append(result, e)
 		return nil
 	})
@@ -291,7 +291,7 @@ func (s EventStoreBlackboxTest) TestNoEventsDoesntCallBack() {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
 	defer cancel()
 
-	err := s.store.Subscribe(ctx, func(e bus.Event) error {
+	err := s.store.Subscribe(ctx, "test", func(e bus.Event) error {
 		s.FailNow("Called back")
 		cancel()
 		return nil
@@ -317,7 +317,7 @@ func (s EventStoreBlackboxTest) TestSubscribesConcurrentlyOnceOnly() {
 	for i := 0; i < 25; i++ {
 		group.Go(func() error {
 			<-start
-			return s.store.Subscribe(ctx, func(e bus.Event) error {
+			return s.store.Subscribe(ctx, "test", func(e bus.Event) error {
 				results <- e
 				return nil
 			})
@@ -365,7 +365,7 @@ func (s EventStoreBlackboxTest) TestSubscribeErrorNacks() {
 	}
 
 	received := 0
-	err := s.store.Subscribe(ctx, func(e bus.Event) error {
+	err := s.store.Subscribe(ctx, "test", func(e bus.Event) error {
 		s.Equal(25, e.(*TestEvent).Age)
 		received++
 		if received >= 3 {
@@ -424,7 +424,7 @@ func (s EventStoreBlackboxTest) TestSubscribesInOrder() {
 	}
 
 	results := []int{}
-	s.store.Subscribe(ctx, func(e bus.Event) error {
+	s.store.Subscribe(ctx, "test", func(e bus.Event) error {
 		age := e.(*TestEvent).Age
 		results = append(results, age)
 		if age == 524 {
@@ -453,13 +453,13 @@ func (s EventStoreBlackboxTest) TestHandlesPanic() {
 	}
 
 	results := make(map[int]int)
-	s.store.Subscribe(ctx, func(e bus.Event) error {
+	s.store.Subscribe(ctx, "test", func(e bus.Event) error {
 		panic("error")
 	})
 
 	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*400)
 	defer cancel()
-	err := s.store.Subscribe(ctx, func(e bus.Event) error {
+	err := s.store.Subscribe(ctx, "test", func(e bus.Event) error {
 		results[e.(*TestEvent).Age] += 1
 		return nil
 	})
@@ -472,3 +472,34 @@ func (s EventStoreBlackboxTest) TestHandlesPanic() {
 
 // TODO: Add further test to simulate crashing of
 // subscribe callback: https://stackoverflow.com/questions/26225513/how-to-test-os-exit-scenarios-in-go
+
+func (s EventStoreBlackboxTest) TestSubscriptionsCheckpointIndependently() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*1500)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		s.buffer.Buffer(true, &TestEvent{Name: "Gabriel", Age: 25 + i})
+		err := s.store.Append(ctx, bus.ExpectedVersion(s.buffer.Version), s.buffer.Events(ctx)...)
+		s.buffer.Commit()
+		s.Require().NoError(err)
+	}
+
+	received := func(name string, count int) []int {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		ages := []int{}
+		err := s.store.Subscribe(ctx, name, func(e bus.Event) error {
+			ages = append(ages, e.(*TestEvent).Age)
+			if len(ages) == count {
+				cancel()
+			}
+			return nil
+		})
+		s.Require().NoError(err)
+		return ages
+	}
+
+	s.Equal([]int{25, 26}, received("projection", 2))
+	s.Equal([]int{25, 26, 27}, received("integration", 3))
+	s.Equal([]int{27}, received("projection", 1))
+}
@@ -8,7 +8,7 @@ import (
 
 var (
 	// ErrConcurrencyViolation indicates an optimistic locking failure
-	ErrConcurrencyViolation = errors.New("cqrs.eventstore: concurrency violation")
+	ErrConcurrencyViolation = bus.ErrConcurrencyViolation
 	// ErrConsistencyViolation indicates appended events cross a consistency boundary
 	ErrConsistencyViolation = errors.New("cqrs.eventstore: consistency violation")
 )
@@ -17,7 +17,7 @@ type MemoryEventStore struct {
 	mx     sync.Mutex
 	closed bool
 
-	offset int
+	offsets map[string]int
 }
 
 func (s *MemoryEventStore) Append(ctx context.Context, v bus.ExpectedVersion, events ...bus.Event) error {
@@ -75,7 +75,7 @@ func (s *MemoryEventStore) Stream(ctx context.Context, stream bus.Stream, q bus.
 	return nil
 }
 
-func (s *MemoryEventStore) Subscribe(ctx context.Context, subscription func(bus.Event) error) error {
+func (s *MemoryEventStore) Subscribe(ctx context.Context, name string, subscription func(bus.Event) error) error {
 	if s.closed {
 		return errors.New("closed")
 	}
@@ -89,7 +89,11 @@ func (s *MemoryEventStore) Subscribe(ctx context.Context, subscription func(bus.
 			err := func() error {
 				s.mx.Lock()
 				defer s.mx.Unlock()
-				if len(s.events) == s.offset {
+				if s.offsets == nil {
+					s.offsets = make(map[string]int)
+				}
+				offset := s.offsets[name]
+				if len(s.events) == offset {
 					return nil // Up to date
 				}
 				err := func() (err error) {
@@ -98,7 +102,7 @@ func (s *MemoryEventStore) Subscribe(ctx context.Context, subscription func(bus.
 							err = fmt.Errorf("panicked: %s", r)
 						}
 					}()
-					err = subscription(s.events[s.offset])
+					err = subscription(s.events[offset])
 					return
 				}()
 				if err != nil {
@@ -111,7 +115,7 @@ func (s *MemoryEventStore) Subscribe(ctx context.Context, subscription func(bus.
 				if s.closed {
 					return errors.New("closed")
 				}
-				s.offset++
+				s.offsets[name]++
 				return nil // Success
 			}()
 			if err != nil {
@@ -121,6 +125,23 @@ func (s *MemoryEventStore) Subscribe(ctx context.Context, subscription func(bus.
 	}
 }
 
+func (s *MemoryEventStore) ResetSubscription(ctx context.Context, name string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.offsets != nil {
+		s.offsets[name] = 0
+	}
+	return nil
+}
+
+func (s *MemoryEventStore) SubscriptionLag(ctx context.Context, name string) (int64, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return int64(len(s.events) - s.offsets[name]), nil
+}
+
 func (s *MemoryEventStore) Close() error {
 	s.closed = true
 	return nil
@@ -0,0 +1,43 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/eventstore"
+)
+
+var _ eventstore.SnapshotStore = (*MemorySnapshotStore)(nil)
+
+// MemorySnapshotStore keeps the latest snapshot of each stream in memory
+type MemorySnapshotStore struct {
+	snapshots map[bus.StreamID]eventstore.Snapshot
+
+	mx sync.Mutex
+}
+
+func (s *MemorySnapshotStore) Save(ctx context.Context, snapshot eventstore.Snapshot) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.snapshots == nil {
+		s.snapshots = make(map[bus.StreamID]eventstore.Snapshot)
+	}
+	if existing, ok := s.snapshots[snapshot.StreamID]; ok && existing.Version > snapshot.Version {
+		return nil
+	}
+	s.snapshots[snapshot.StreamID] = snapshot
+	return nil
+}
+
+func (s *MemorySnapshotStore) Latest(ctx context.Context, id bus.StreamID) (eventstore.Snapshot, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	snapshot, ok := s.snapshots[id]
+	if !ok {
+		return eventstore.Snapshot{}, eventstore.ErrSnapshotNotFound
+	}
+	return snapshot, nil
+}
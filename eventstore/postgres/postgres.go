@@ -207,27 +207,32 @@ func (s *PostgresEventStore) buildStreamQuery(q bus.Select) (string, []interface
 	return strings.Join(query, " "), args
 }
 
-func (s *PostgresEventStore) Subscribe(ctx context.Context, subscribe func(bus.Event) error) (err error) {
+func (s *PostgresEventStore) Subscribe(ctx context.Context, name string, subscribe func(bus.Event) error) (err error) {
 	if s.closed {
 		return errors.New("store is closed")
 	}
 	s.wg.Add(1)
 	defer s.wg.Done()
 
+	_, err = s.db.ExecContext(ctx, `INSERT INTO event_checkpoints (name) VALUES ($1) ON CONFLICT DO NOTHING`, name)
+	if err != nil {
+		return log.Error(ctx, "could not create subscription checkpoint", log.F{"subscription": name, "error": err.Error()})
+	}
+
 	backoff := 0
 	for {
 		select {
 		case <-s.closing:
-			log.Info(ctx, "subscriber closing", log.F{})
+			log.Info(ctx, "subscriber closing", log.F{"subscription": name})
 			return nil
 		case <-ctx.Done():
-			log.Info(ctx, "subscribe context finished", log.F{"reason": ctx.Err().Error()})
+			log.Info(ctx, "subscribe context finished", log.F{"subscription": name, "reason": ctx.Err().Error()})
 			return nil
 		case <-time.After(time.Millisecond * time.Duration(backoff)):
 			break
 		}
 
-		err, processed := s.run(ctx, subscribe)
+		err, processed := s.run(ctx, name, subscribe)
 		switch {
 		case err != nil:
 			backoff = 100
@@ -239,44 +244,45 @@ func (s *PostgresEventStore) Subscribe(ctx context.Context, subscribe func(bus.E
 	}
 }
 
-func (s *PostgresEventStore) run(ctx context.Context, subscribe func(bus.Event) error) (error, bool) {
+// run delivers the next event after a subscription's checkpoint. The checkpoint row
+// is locked so that subscribers sharing a name process events one at a time, in order.
+// Only events from transactions older than any running transaction are read,
+// so events committed out of offset order are never skipped
+func (s *PostgresEventStore) run(ctx context.Context, name string, subscribe func(bus.Event) error) (error, bool) {
 	var tx *sql.Tx
 	tx, err := s.db.Begin()
 	if err != nil {
 		return log.Error(ctx, "could not open transaction", log.F{"error": err.Error()}), false
 	}
 
-	claim := `
-	UPDATE events
-	SET reserved_at = NOW()
-	WHERE "offset" = (
-		SELECT "offset"
-		FROM events
-		WHERE (reserved_at IS NULL
-			OR (reserved_at < $1 AND acked_at IS NULL))
-		ORDER BY "offset" ASC
-		LIMIT 1
-		FOR UPDATE SKIP LOCKED
-	)
-	RETURNING "offset"`
-
-	var offset int
-	err = tx.QueryRow(claim, Now().Add(-time.Minute)).Scan(&offset)
+	var transaction string
+	var offset int64
+	err = tx.QueryRow(`SELECT transaction_id::text, "offset" FROM event_checkpoints
+		WHERE name = $1
+		FOR UPDATE SKIP LOCKED`, name).Scan(&transaction, &offset)
 	if err != nil && err != sql.ErrNoRows {
 		tx.Rollback()
-		return log.Error(ctx, "Error claiming event", log.F{"error": err.Error()}), false
+		return log.Error(ctx, "Error claiming subscription", log.F{"subscription": name, "error": err.Error()}), false
 	}
 	if err != nil && err == sql.ErrNoRows {
 		tx.Rollback()
-		return nil, false
+		return nil, false // Another subscriber holds the checkpoint
 	}
 
 	var data []byte
-	err = tx.QueryRow(`SELECT payload FROM events WHERE "offset" = $1`, offset).Scan(&data)
-	if err != nil {
+	err = tx.QueryRow(`SELECT transaction_id::text, "offset", payload FROM events
+		WHERE (transaction_id, "offset") > ($1::xid8, $2)
+		AND transaction_id < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY transaction_id ASC, "offset" ASC
+		LIMIT 1`, transaction, offset).Scan(&transaction, &offset, &data)
+	if err != nil && err != sql.ErrNoRows {
 		tx.Rollback()
 		return log.Error(ctx, "could not get event payload", log.F{"error": err.Error()}), false
 	}
+	if err != nil && err == sql.ErrNoRows {
+		tx.Rollback()
+		return nil, false
+	}
 
 	var msg message.Message
 	msg, err = bus.DeserializeMessage(data)
@@ -305,10 +311,12 @@ func (s *PostgresEventStore) run(ctx context.Context, subscribe func(bus.Event)
 		return err, false
 	}
 
-	_, err = tx.Exec(`UPDATE events SET acked_at = $1 WHERE "offset" = $2`, Now(), offset)
+	_, err = tx.Exec(`UPDATE event_checkpoints
+		SET transaction_id = $2::xid8, "offset" = $3, updated_at = $4
+		WHERE name = $1`, name, transaction, offset, Now())
 	if err != nil {
 		tx.Rollback()
-		return log.Error(ctx, "error marking event as acked", log.F{"error": err.Error()}), false
+		return log.Error(ctx, "error advancing checkpoint", log.F{"error": err.Error()}), false
 	}
 
 	err = tx.Commit()
@@ -317,6 +325,23 @@ func (s *PostgresEventStore) run(ctx context.Context, subscribe func(bus.Event)
 		return log.Error(ctx, "error commiting subscribed event", log.F{"error": err.Error()}), false
 	}
 
-	log.Info(ctx, "processed event subscription", log.F{"event": msg.(bus.Event).Event()})
+	log.Info(ctx, "processed event subscription", log.F{"subscription": name, "event": msg.(bus.Event).Event()})
 	return nil, true
 }
+
+func (s *PostgresEventStore) ResetSubscription(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO event_checkpoints (name, updated_at) VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE
+		SET transaction_id = '0', "offset" = 0, updated_at = $2`, name, Now())
+	return err
+}
+
+func (s *PostgresEventStore) SubscriptionLag(ctx context.Context, name string) (int64, error) {
+	var lag int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM events
+		WHERE (transaction_id, "offset") > (
+			SELECT COALESCE(MAX(transaction_id::text), '0')::xid8, COALESCE(MAX("offset"), 0)
+			FROM event_checkpoints WHERE name = $1
+		)`, name).Scan(&lag)
+	return lag, err
+}
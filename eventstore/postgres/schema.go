@@ -25,9 +25,22 @@ func (s PostgreSQLSchema) Make() error {
 		"at" TIMESTAMP NOT NULL,
 		"version" BIGINT,
 		"payload" JSON NOT NULL,
-		"reserved_at" TIMESTAMP DEFAULT NULL,
-		"acked_at" TIMESTAMP DEFAULT NULL,
-		"unique" BOOLEAN DEFAULT TRUE
+		"unique" BOOLEAN DEFAULT TRUE,
+		"transaction_id" xid8 NOT NULL DEFAULT pg_current_xact_id()
+	);`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE events
+		ADD COLUMN IF NOT EXISTS "transaction_id" xid8 NOT NULL DEFAULT pg_current_xact_id()`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS event_checkpoints (
+		"name" VARCHAR(128) PRIMARY KEY,
+		"transaction_id" xid8 NOT NULL DEFAULT '0',
+		"offset" BIGINT NOT NULL DEFAULT 0,
+		"updated_at" TIMESTAMP DEFAULT NULL
 	);`)
 	if err != nil {
 		return err
@@ -37,6 +50,18 @@ func (s PostgreSQLSchema) Make() error {
 		ON events ("type", "owner", "version")
 		WHERE ("unique" is NOT null)
 	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS snapshots (
+		"owner" VARCHAR(36) NOT NULL,
+		"type" VARCHAR(64) NOT NULL,
+		"version" BIGINT NOT NULL,
+		"schema" INT NOT NULL,
+		"at" TIMESTAMP NOT NULL,
+		"data" BYTEA NOT NULL,
+		PRIMARY KEY ("type", "owner")
+	);`)
 
 	return err
 }
@@ -53,6 +78,16 @@ func (s PostgreSQLSchema) Reset() {
 		panic(err)
 	}
 
+	_, err = db.Exec("DELETE FROM event_checkpoints")
+	if err != nil && !strings.Contains(err.Error(), "does not exist") {
+		panic(err)
+	}
+
+	_, err = db.Exec("DELETE FROM snapshots")
+	if err != nil && !strings.Contains(err.Error(), "does not exist") {
+		panic(err)
+	}
+
 	err = db.Close()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/eventstore"
+)
+
+var _ eventstore.SnapshotStore = (*PostgresSnapshotStore)(nil)
+
+// NewSnapshotStore returns a snapshot store, creating its table if required
+func NewSnapshotStore(c Config) *PostgresSnapshotStore {
+	db := makeDB(c)
+	schema := PostgreSQLSchema{c}
+	err := schema.Make()
+	if err != nil {
+		panic(err)
+	}
+	return &PostgresSnapshotStore{db: db}
+}
+
+// PostgresSnapshotStore keeps the latest snapshot of each stream
+type PostgresSnapshotStore struct {
+	db *sql.DB
+}
+
+func (s *PostgresSnapshotStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *PostgresSnapshotStore) Save(ctx context.Context, snapshot eventstore.Snapshot) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO snapshots (owner, type, version, "schema", at, data)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (type, owner) DO UPDATE
+		SET version = EXCLUDED.version, "schema" = EXCLUDED."schema", at = EXCLUDED.at, data = EXCLUDED.data
+		WHERE snapshots.version <= EXCLUDED.version`,
+		snapshot.ID,
+		snapshot.Type,
+		snapshot.Version,
+		snapshot.Schema,
+		snapshot.At,
+		snapshot.Data,
+	)
+	return err
+}
+
+func (s *PostgresSnapshotStore) Latest(ctx context.Context, id bus.StreamID) (eventstore.Snapshot, error) {
+	snapshot := eventstore.Snapshot{StreamID: id}
+	row := s.db.QueryRowContext(ctx, `SELECT version, "schema", at, data FROM snapshots
+		WHERE owner = $1 AND type = $2`, id.ID, id.Type)
+	err := row.Scan(&snapshot.Version, &snapshot.Schema, &snapshot.At, &snapshot.Data)
+	if err == sql.ErrNoRows {
+		return snapshot, eventstore.ErrSnapshotNotFound
+	}
+	return snapshot, err
+}
@@ -0,0 +1,218 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/log"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	// ErrAggregateNotFound indicates a stream has no events to load an aggregate from
+	ErrAggregateNotFound = errors.New("cqrs.eventstore: aggregate not found")
+)
+
+// Aggregate is an event sourced entity. Embedding a bus.EventBuffer
+// satisfies the interface.
+type Aggregate interface {
+	// Buffer records events against the aggregate. Historical events
+	// are buffered with isNew false, which only advances the version
+	Buffer(isNew bool, events ...bus.Event)
+
+	// Events returns the aggregate's pending events
+	Events(context.Context) []bus.Event
+
+	// CurrentVersion is the version of the aggregate as it was loaded
+	CurrentVersion() int64
+
+	// ForceVersion sets the aggregate's version, used when restoring a snapshot
+	ForceVersion(int64)
+
+	// Commit marks pending events as persisted
+	Commit()
+}
+
+// ApplyFunc mutates an aggregate's state with an event
+type ApplyFunc = func(Aggregate, bus.Event)
+
+// AggregateFactory returns a blank aggregate for a stream, ready to
+// have events applied to it
+type AggregateFactory = func(bus.StreamID) Aggregate
+
+// Store is the subset of bus.EventStore required by Repository
+type Store interface {
+	bus.Appendable
+	bus.Streamable
+}
+
+// RepositoryOption configures a Repository
+type RepositoryOption = func(*Repository)
+
+// UseSnapshots loads aggregates from their latest snapshot, and takes
+// new snapshots when the policy allows. Aggregates are snapshotted as JSON.
+// Incrementing schema invalidates all existing snapshots, and should be done
+// whenever the aggregate's serialized form changes
+func UseSnapshots(store SnapshotStore, schema int, policy SnapshotPolicy) RepositoryOption {
+	return func(r *Repository) {
+		r.snapshots = store
+		r.schema = schema
+		r.policy = policy
+	}
+}
+
+// NewRepository returns a repository for one type of aggregate
+func NewRepository(store Store, factory AggregateFactory, opts ...RepositoryOption) *Repository {
+	r := &Repository{
+		store:    store,
+		factory:  factory,
+		appliers: make(map[string]ApplyFunc),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Repository loads and saves event sourced aggregates
+type Repository struct {
+	store    Store
+	factory  AggregateFactory
+	appliers map[string]ApplyFunc
+
+	snapshots SnapshotStore
+	schema    int
+	policy    SnapshotPolicy
+}
+
+// On registers the apply method for an event. Events without an
+// apply method still advance the aggregate's version when loaded
+func (r *Repository) On(e bus.Event, fn ApplyFunc) *Repository {
+	if _, exists := r.appliers[e.Event()]; exists {
+		panic(fmt.Sprint("Cannot register apply method twice: ", e.Event()))
+	}
+	r.appliers[e.Event()] = fn
+	return r
+}
+
+// Load rebuilds an aggregate by replaying its stream, starting from
+// the latest snapshot if there is one
+func (r *Repository) Load(ctx context.Context, id bus.StreamID) (Aggregate, error) {
+	aggregate := r.factory(id)
+
+	restored, err := r.restore(ctx, aggregate, id)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := r.replay(ctx, aggregate, bus.Select{StreamID: id, From: aggregate.CurrentVersion() + 1})
+	if err != nil {
+		return nil, err
+	}
+	if applied == 0 && !restored {
+		return nil, ErrAggregateNotFound
+	}
+
+	return aggregate, nil
+}
+
+// restore loads the latest valid snapshot into an aggregate,
+// returning whether one was found
+func (r *Repository) restore(ctx context.Context, aggregate Aggregate, id bus.StreamID) (bool, error) {
+	if r.snapshots == nil {
+		return false, nil
+	}
+
+	snapshot, err := r.snapshots.Latest(ctx, id)
+	if err == ErrSnapshotNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if snapshot.Schema != r.schema {
+		log.Info(ctx, "ignoring outdated snapshot", log.F{"stream": id.ID, "schema": fmt.Sprint(snapshot.Schema)})
+		return false, nil
+	}
+
+	err = json.Unmarshal(snapshot.Data, aggregate)
+	if err != nil {
+		return false, err
+	}
+	aggregate.ForceVersion(snapshot.Version)
+	return true, nil
+}
+
+// replay applies a selection of events to an aggregate, returning
+// the number of events applied
+func (r *Repository) replay(ctx context.Context, aggregate Aggregate, q bus.Select) (int, error) {
+	stream := make(chan bus.Event)
+	group, ctx := errgroup.WithContext(ctx)
+	group.Go(func() error {
+		return r.store.Stream(ctx, stream, q)
+	})
+
+	applied := 0
+	for event := range stream {
+		r.Apply(aggregate, event)
+		applied++
+	}
+
+	return applied, group.Wait()
+}
+
+// Apply applies historical events to an aggregate
+func (r *Repository) Apply(aggregate Aggregate, events ...bus.Event) {
+	for _, event := range events {
+		if fn, ok := r.appliers[event.Event()]; ok {
+			fn(aggregate, event)
+		}
+		aggregate.Buffer(false, event)
+	}
+}
+
+// Save appends an aggregate's pending events, using the aggregate's
+// current version for optimistic locking, then commits the aggregate
+func (r *Repository) Save(ctx context.Context, aggregate Aggregate) error {
+	events := aggregate.Events(ctx)
+	if len(events) == 0 {
+		return nil
+	}
+
+	from := aggregate.CurrentVersion()
+	err := r.store.Append(ctx, bus.ExpectedVersion(from), events...)
+	if err != nil {
+		return err
+	}
+
+	aggregate.Commit()
+	if r.snapshots != nil && r.policy(from, aggregate.CurrentVersion()) {
+		r.snapshot(ctx, aggregate, events[0])
+	}
+	return nil
+}
+
+// snapshot stores a snapshot of the aggregate. The events have already been
+// stored, so failures are logged rather than returned
+func (r *Repository) snapshot(ctx context.Context, aggregate Aggregate, sample bus.Event) {
+	data, err := json.Marshal(aggregate)
+	if err != nil {
+		log.Error(ctx, "failed serializing snapshot", log.F{"error": err.Error()})
+		return
+	}
+
+	err = r.snapshots.Save(ctx, Snapshot{
+		StreamID: bus.StreamID{Type: sample.FromAggregate(), ID: sample.Owned()},
+		Version:  aggregate.CurrentVersion(),
+		Schema:   r.schema,
+		At:       time.Now(),
+		Data:     data,
+	})
+	if err != nil {
+		log.Error(ctx, "failed storing snapshot", log.F{"error": err.Error()})
+	}
+}
@@ -0,0 +1,191 @@
+package eventstore_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/eventstore"
+	"github.com/GabrielCarpr/cqrs/eventstore/memory"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type accountOpened struct {
+	bus.EventType
+
+	Name string
+}
+
+func (accountOpened) Event() string {
+	return "account.opened"
+}
+
+type accountCredited struct {
+	bus.EventType
+
+	Amount int
+}
+
+func (accountCredited) Event() string {
+	return "account.credited"
+}
+
+func newAccount(id bus.StreamID) eventstore.Aggregate {
+	ID := uuid.MustParse(id.ID)
+	return &account{ID: ID, EventBuffer: bus.NewEventBuffer(ID, "account")}
+}
+
+type account struct {
+	ID      uuid.UUID
+	Name    string
+	Balance int
+
+	bus.EventBuffer
+}
+
+func (a *account) Credit(amount int) {
+	a.Balance += amount
+	a.Buffer(true, &accountCredited{Amount: amount})
+}
+
+func accountRepository(store eventstore.Store, opts ...eventstore.RepositoryOption) *eventstore.Repository {
+	return eventstore.NewRepository(store, newAccount, opts...).
+		On(&accountOpened{}, func(a eventstore.Aggregate, e bus.Event) {
+			a.(*account).Name = e.(*accountOpened).Name
+		}).
+		On(&accountCredited{}, func(a eventstore.Aggregate, e bus.Event) {
+			a.(*account).Balance += e.(*accountCredited).Amount
+		})
+}
+
+func TestRepository(t *testing.T) {
+	suite.Run(t, new(RepositoryTest))
+}
+
+type RepositoryTest struct {
+	suite.Suite
+
+	store *memory.MemoryEventStore
+	repo  *eventstore.Repository
+	id    bus.StreamID
+}
+
+func (s *RepositoryTest) SetupTest() {
+	s.store = &memory.MemoryEventStore{}
+	s.repo = accountRepository(s.store)
+	s.id = bus.StreamID{Type: "account", ID: uuid.New().String()}
+
+	opened := newAccount(s.id).(*account)
+	opened.Name = "Gabriel"
+	opened.Buffer(true, &accountOpened{Name: "Gabriel"})
+	s.Require().NoError(s.repo.Save(context.Background(), opened))
+}
+
+func (s *RepositoryTest) TestLoadsAggregate() {
+	a, err := s.repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+
+	s.Equal("Gabriel", a.(*account).Name)
+	s.Equal(int64(1), a.CurrentVersion())
+}
+
+func (s *RepositoryTest) TestSavesPendingEvents() {
+	a, err := s.repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+
+	a.(*account).Credit(10)
+	a.(*account).Credit(5)
+	s.Require().NoError(s.repo.Save(context.Background(), a))
+	s.Equal(int64(3), a.CurrentVersion())
+	s.Empty(a.Events(context.Background()))
+
+	loaded, err := s.repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+	s.Equal(15, loaded.(*account).Balance)
+	s.Equal(int64(3), loaded.CurrentVersion())
+}
+
+func (s *RepositoryTest) TestSaveDetectsConcurrentWrites() {
+	first, err := s.repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+	second, err := s.repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+
+	first.(*account).Credit(10)
+	s.Require().NoError(s.repo.Save(context.Background(), first))
+
+	second.(*account).Credit(20)
+	err = s.repo.Save(context.Background(), second)
+	s.Equal(eventstore.ErrConcurrencyViolation, err)
+}
+
+func (s *RepositoryTest) TestLoadMissingAggregate() {
+	_, err := s.repo.Load(context.Background(), bus.StreamID{Type: "account", ID: uuid.New().String()})
+	s.Equal(eventstore.ErrAggregateNotFound, err)
+}
+
+func (s *RepositoryTest) TestSnapshotsEveryNEvents() {
+	snapshots := &memory.MemorySnapshotStore{}
+	repo := accountRepository(s.store, eventstore.UseSnapshots(snapshots, 1, eventstore.EveryNEvents(3)))
+
+	a, err := repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+	a.(*account).Credit(10)
+	s.Require().NoError(repo.Save(context.Background(), a))
+
+	_, err = snapshots.Latest(context.Background(), s.id)
+	s.Equal(eventstore.ErrSnapshotNotFound, err)
+
+	a.(*account).Credit(5)
+	s.Require().NoError(repo.Save(context.Background(), a))
+
+	snapshot, err := snapshots.Latest(context.Background(), s.id)
+	s.Require().NoError(err)
+	s.Equal(int64(3), snapshot.Version)
+	s.Equal(1, snapshot.Schema)
+}
+
+func (s *RepositoryTest) TestEveryNEventsNeedsPositiveN() {
+	s.Panics(func() { eventstore.EveryNEvents(0) })
+	s.Panics(func() { eventstore.EveryNEvents(-1) })
+}
+
+func (s *RepositoryTest) TestLoadsFromSnapshot() {
+	snapshots := &memory.MemorySnapshotStore{}
+	repo := accountRepository(s.store, eventstore.UseSnapshots(snapshots, 1, eventstore.EveryNEvents(3)))
+	snapshots.Save(context.Background(), eventstore.Snapshot{
+		StreamID: s.id,
+		Version:  1,
+		Schema:   1,
+		Data:     []byte(`{"Name":"Snapshotted","Balance":100}`),
+	})
+
+	a, err := repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+	a.(*account).Credit(10)
+	s.Require().NoError(repo.Save(context.Background(), a))
+
+	loaded, err := repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+	s.Equal("Snapshotted", loaded.(*account).Name)
+	s.Equal(110, loaded.(*account).Balance)
+	s.Equal(int64(2), loaded.CurrentVersion())
+}
+
+func (s *RepositoryTest) TestIgnoresOutdatedSnapshot() {
+	snapshots := &memory.MemorySnapshotStore{}
+	repo := accountRepository(s.store, eventstore.UseSnapshots(snapshots, 2, eventstore.EveryNEvents(3)))
+	snapshots.Save(context.Background(), eventstore.Snapshot{
+		StreamID: s.id,
+		Version:  1,
+		Schema:   1,
+		Data:     []byte(`{"Name":"Snapshotted","Balance":100}`),
+	})
+
+	a, err := repo.Load(context.Background(), s.id)
+	s.Require().NoError(err)
+	s.Equal("Gabriel", a.(*account).Name)
+	s.Equal(0, a.(*account).Balance)
+	s.Equal(int64(1), a.CurrentVersion())
+}
@@ -0,0 +1,55 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+)
+
+var (
+	// ErrSnapshotNotFound indicates a stream has no snapshot
+	ErrSnapshotNotFound = errors.New("cqrs.eventstore: snapshot not found")
+)
+
+// Snapshot is the serialized state of an aggregate at a version
+type Snapshot struct {
+	bus.StreamID
+
+	// Version is the aggregate version the snapshot was taken at
+	Version int64
+
+	// Schema is the version of the aggregate's serialized form.
+	// Snapshots with a different schema to the repository's are ignored
+	Schema int
+
+	At time.Time
+
+	Data []byte
+}
+
+// SnapshotStore stores the latest snapshot of aggregates
+type SnapshotStore interface {
+	// Save stores a snapshot, replacing older snapshots of the stream
+	Save(context.Context, Snapshot) error
+
+	// Latest returns the newest snapshot of a stream, or ErrSnapshotNotFound
+	Latest(context.Context, bus.StreamID) (Snapshot, error)
+}
+
+// SnapshotPolicy decides whether to snapshot an aggregate after
+// it has been saved, moving from one version to another
+type SnapshotPolicy = func(from int64, to int64) bool
+
+// EveryNEvents snapshots an aggregate each time its version passes a multiple of n.
+// It panics if n isn't positive
+func EveryNEvents(n int64) SnapshotPolicy {
+	if n <= 0 {
+		panic(fmt.Sprintf("cqrs.eventstore: EveryNEvents needs a positive number of events, got %d", n))
+	}
+	return func(from int64, to int64) bool {
+		return to/n > from/n
+	}
+}
@@ -0,0 +1,99 @@
+// +build !unit
+
+package eventstore_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/eventstore"
+	"github.com/GabrielCarpr/cqrs/eventstore/memory"
+	"github.com/GabrielCarpr/cqrs/eventstore/postgres"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+func TestMemorySnapshotStore(t *testing.T) {
+	suite.Run(t, &SnapshotStoreBlackboxTest{factory: func() eventstore.SnapshotStore {
+		return &memory.MemorySnapshotStore{}
+	}})
+}
+
+func TestPostgresSnapshotStore(t *testing.T) {
+	c := postgres.Config{
+		DBName: "cqrs",
+		DBPass: "cqrs",
+		DBHost: "db",
+		DBUser: "cqrs",
+	}
+	s := &SnapshotStoreBlackboxTest{
+		factory: func() eventstore.SnapshotStore {
+			return postgres.NewSnapshotStore(c)
+		},
+	}
+	s.setupHook = func() error {
+		schema := postgres.PostgreSQLSchema{Config: c}
+		schema.Reset()
+		return nil
+	}
+	suite.Run(t, s)
+}
+
+type SnapshotStoreBlackboxTest struct {
+	suite.Suite
+
+	factory   func() eventstore.SnapshotStore
+	setupHook func() error
+
+	store eventstore.SnapshotStore
+	id    bus.StreamID
+}
+
+func (s *SnapshotStoreBlackboxTest) SetupTest() {
+	if s.setupHook != nil {
+		err := s.setupHook()
+		if err != nil {
+			panic(err)
+		}
+	}
+	s.store = s.factory()
+	s.id = bus.StreamID{Type: "testEntity", ID: uuid.New().String()}
+}
+
+func (s *SnapshotStoreBlackboxTest) snapshot(version int64) eventstore.Snapshot {
+	return eventstore.Snapshot{
+		StreamID: s.id,
+		Version:  version,
+		Schema:   1,
+		At:       time.Now().UTC().Truncate(time.Second),
+		Data:     []byte(`{"Name":"Gabriel"}`),
+	}
+}
+
+func (s *SnapshotStoreBlackboxTest) TestNoSnapshot() {
+	_, err := s.store.Latest(context.Background(), s.id)
+	s.Equal(eventstore.ErrSnapshotNotFound, err)
+}
+
+func (s *SnapshotStoreBlackboxTest) TestSavesAndReturnsLatest() {
+	s.Require().NoError(s.store.Save(context.Background(), s.snapshot(10)))
+	s.Require().NoError(s.store.Save(context.Background(), s.snapshot(20)))
+
+	result, err := s.store.Latest(context.Background(), s.id)
+	s.Require().NoError(err)
+	s.Equal(int64(20), result.Version)
+	s.Equal(1, result.Schema)
+	s.Equal(s.id, result.StreamID)
+	s.JSONEq(`{"Name":"Gabriel"}`, string(result.Data))
+}
+
+func (s *SnapshotStoreBlackboxTest) TestKeepsNewerSnapshot() {
+	s.Require().NoError(s.store.Save(context.Background(), s.snapshot(20)))
+	s.Require().NoError(s.store.Save(context.Background(), s.snapshot(10)))
+
+	result, err := s.store.Latest(context.Background(), s.id)
+	s.Require().NoError(err)
+	s.Equal(int64(20), result.Version)
+}
@@ -0,0 +1,161 @@
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a logged line
+type Entry struct {
+	Time    time.Time
+	Level   LogLevel
+	Message string
+
+	// Fields are the line's fields, including the context's registered fields
+	Fields F
+
+	// Caller is where the line was logged
+	Caller Caller
+}
+
+// Caller is the location a line was logged from
+type Caller struct {
+	PC   uintptr
+	Func string
+	File string
+	Line int
+}
+
+func (c Caller) String() string {
+	return fmt.Sprintf("%s:%d", c.File, c.Line)
+}
+
+// Backend writes logged lines
+type Backend interface {
+	Log(context.Context, Entry)
+}
+
+var (
+	backend   Backend = TextBackend{}
+	backendMx sync.RWMutex
+)
+
+// SetBackend sets the backend lines are written with. The default is TextBackend
+func SetBackend(b Backend) {
+	backendMx.Lock()
+	defer backendMx.Unlock()
+
+	backend = b
+}
+
+func getBackend() Backend {
+	backendMx.RLock()
+	defer backendMx.RUnlock()
+
+	return backend
+}
+
+// TextBackend writes human readable lines with the standard library's logger
+type TextBackend struct{}
+
+func (TextBackend) Log(ctx context.Context, e Entry) {
+	log.Printf("%s: %s %v [%s %s]", e.Level, e.Message, e.Fields, e.Caller.Func, e.Caller)
+}
+
+// NewJSONBackend returns a backend writing a JSON object per line, with the time,
+// level, msg and caller keys, and a key for each field. Fields named the same as
+// those keys are left out
+func NewJSONBackend(w io.Writer) *JSONBackend {
+	return &JSONBackend{w: w}
+}
+
+// JSONBackend writes lines as JSON
+type JSONBackend struct {
+	mx sync.Mutex
+	w  io.Writer
+}
+
+func (b *JSONBackend) Log(ctx context.Context, e Entry) {
+	line := make(map[string]string, len(e.Fields)+4)
+	for key, val := range e.Fields {
+		line[key] = val
+	}
+	line["time"] = e.Time.Format(time.RFC3339Nano)
+	line["level"] = strings.ToLower(e.Level.String())
+	line["msg"] = e.Message
+	line["caller"] = e.Caller.String()
+
+	encoded, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.w.Write(append(encoded, '\n'))
+}
+
+// NewLogfmtBackend returns a backend writing lines in logfmt, with the time, level,
+// msg and caller keys, then each field in order of its name. Fields named the same as
+// those keys are left out
+func NewLogfmtBackend(w io.Writer) *LogfmtBackend {
+	return &LogfmtBackend{w: w}
+}
+
+// LogfmtBackend writes lines as logfmt
+type LogfmtBackend struct {
+	mx sync.Mutex
+	w  io.Writer
+}
+
+func (b *LogfmtBackend) Log(ctx context.Context, e Entry) {
+	var line strings.Builder
+	writeLogfmt(&line, "time", e.Time.Format(time.RFC3339Nano))
+	writeLogfmt(&line, "level", strings.ToLower(e.Level.String()))
+	writeLogfmt(&line, "msg", e.Message)
+	writeLogfmt(&line, "caller", e.Caller.String())
+
+	for _, key := range fieldNames(e.Fields) {
+		switch key {
+		case "time", "level", "msg", "caller":
+			continue
+		}
+		writeLogfmt(&line, key, e.Fields[key])
+	}
+	line.WriteByte('\n')
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	io.WriteString(b.w, line.String())
+}
+
+// writeLogfmt writes a key value pair, quoting the value if it needs to be
+func writeLogfmt(w *strings.Builder, key, val string) {
+	if w.Len() > 0 {
+		w.WriteByte(' ')
+	}
+	w.WriteString(key)
+	w.WriteByte('=')
+	if val == "" || strings.ContainsAny(val, " =") || strconv.Quote(val) != `"`+val+`"` {
+		val = strconv.Quote(val)
+	}
+	w.WriteString(val)
+}
+
+// fieldNames returns the fields' names in order
+func fieldNames(fields F) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,6 +2,9 @@ package log
 
 import (
 	"context"
+	"fmt"
+	"sync"
+
 	"github.com/google/uuid"
 )
 
@@ -13,6 +16,40 @@ func (k ctxIDKeyType) String() string {
 
 var CtxIDKey = ctxIDKeyType("ID")
 
+// FieldsKey is the context key of the fields added with With. Its value is an F,
+// so it can be serialized with the context
+var FieldsKey = fieldsKeyType("log_fields")
+
+type fieldsKeyType string
+
+func (k fieldsKeyType) String() string {
+	return string(k)
+}
+
+// With returns a context whose fields are logged on every line logged with it,
+// along with the fields of its parent. Fields set to an empty string are removed
+func With(ctx context.Context, fields F) context.Context {
+	parent := Fields(ctx)
+	result := make(F, len(parent)+len(fields))
+	for key, val := range parent {
+		result[key] = val
+	}
+	for key, val := range fields {
+		if val == "" {
+			delete(result, key)
+			continue
+		}
+		result[key] = val
+	}
+	return context.WithValue(ctx, FieldsKey, result)
+}
+
+// Fields returns the fields added to the context with With
+func Fields(ctx context.Context) F {
+	fields, _ := ctx.Value(FieldsKey).(F)
+	return fields
+}
+
 // WithID adds a correlation ID to the ctx. If one already exists, it's a no-op
 func WithID(ctx context.Context) context.Context {
 	existing := GetID(ctx)
@@ -33,3 +70,65 @@ func GetID(ctx context.Context) uuid.UUID {
 	}
 	return id.(uuid.UUID)
 }
+
+func init() {
+	RegisterContextField("request_id", func(ctx context.Context) string {
+		if id := GetID(ctx); id != uuid.Nil {
+			return id.String()
+		}
+		return ""
+	})
+}
+
+// contextField is a field logged from the context
+type contextField struct {
+	name  string
+	value func(context.Context) string
+}
+
+var (
+	contextFields   []contextField
+	contextFieldsMx sync.RWMutex
+)
+
+// RegisterContextField includes a field in every line logged with a context, whose
+// value is read from the context. Empty values are left out. The request ID is
+// registered as request_id
+func RegisterContextField(name string, value func(context.Context) string) {
+	contextFieldsMx.Lock()
+	defer contextFieldsMx.Unlock()
+
+	contextFields = append(contextFields, contextField{name, value})
+}
+
+// RegisterContextKey includes a context value in every line logged with the context,
+// as a field named by the key. Values that aren't set, or aren't strings, are left out
+func RegisterContextKey(key fmt.Stringer) {
+	RegisterContextField(key.String(), func(ctx context.Context) string {
+		val, _ := ctx.Value(key).(string)
+		return val
+	})
+}
+
+// withContextFields returns the fields with the context's registered fields, and
+// those added with With, added. Fields added with With take precedence over
+// registered fields, and fields logged explicitly over both
+func withContextFields(ctx context.Context, fields F) F {
+	contextFieldsMx.RLock()
+	defer contextFieldsMx.RUnlock()
+
+	added := Fields(ctx)
+	result := make(F, len(fields)+len(added)+len(contextFields))
+	for _, field := range contextFields {
+		if val := field.value(ctx); val != "" {
+			result[field.name] = val
+		}
+	}
+	for key, val := range added {
+		result[key] = val
+	}
+	for key, val := range fields {
+		result[key] = val
+	}
+	return result
+}
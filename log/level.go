@@ -0,0 +1,129 @@
+package log
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	level         = INFO
+	packageLevels = make(map[string]LogLevel)
+	levelsMx      sync.RWMutex
+)
+
+// SetLevel sets the lowest level logged, unless a package's level is set
+func SetLevel(lvl LogLevel) {
+	levelsMx.Lock()
+	defer levelsMx.Unlock()
+
+	level = lvl
+}
+
+// SetPackageLevel sets the lowest level logged by a package, and its subpackages,
+// by import path. The most specific package's level applies
+func SetPackageLevel(pkg string, lvl LogLevel) {
+	levelsMx.Lock()
+	defer levelsMx.Unlock()
+
+	packageLevels[strings.TrimSuffix(pkg, "/")] = lvl
+}
+
+// levelFor returns the lowest level logged by a package
+func levelFor(pkg string) LogLevel {
+	levelsMx.RLock()
+	defer levelsMx.RUnlock()
+
+	for p := pkg; p != ""; {
+		if lvl, ok := packageLevels[p]; ok {
+			return lvl
+		}
+		i := strings.LastIndex(p, "/")
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return level
+}
+
+// packageOf returns the import path of a function's package, from its qualified name
+func packageOf(fun string) string {
+	slash := strings.LastIndex(fun, "/")
+	if dot := strings.Index(fun[slash+1:], "."); dot >= 0 {
+		return fun[:slash+1+dot]
+	}
+	return fun
+}
+
+// Sampling limits repeated lines. In each Tick, the First lines with the same
+// level and message are logged, then every Thereafter'th, or none if it's zero.
+// Errors, panics and fatal lines are never sampled
+type Sampling struct {
+	First      int
+	Thereafter int
+	Tick       time.Duration
+}
+
+var (
+	sampling  Sampling
+	samples   = make(map[sampleKey]*sampleCount)
+	pruned    time.Time
+	samplesMx sync.Mutex
+)
+
+type sampleKey struct {
+	level   LogLevel
+	message string
+}
+
+type sampleCount struct {
+	since time.Time
+	n     int
+}
+
+// SetSampling samples repeated lines. The zero value logs every line
+func SetSampling(s Sampling) {
+	samplesMx.Lock()
+	defer samplesMx.Unlock()
+
+	sampling = s
+	samples = make(map[sampleKey]*sampleCount)
+}
+
+// sample returns whether a line is logged
+func sample(lvl LogLevel, msg string) bool {
+	if lvl >= ERROR {
+		return true
+	}
+
+	samplesMx.Lock()
+	defer samplesMx.Unlock()
+
+	if sampling.Tick <= 0 {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(pruned) >= sampling.Tick {
+		for key, count := range samples {
+			if now.Sub(count.since) >= sampling.Tick {
+				delete(samples, key)
+			}
+		}
+		pruned = now
+	}
+
+	key := sampleKey{lvl, msg}
+	count, ok := samples[key]
+	if !ok || now.Sub(count.since) >= sampling.Tick {
+		count = &sampleCount{since: now}
+		samples[key] = count
+	}
+	count.n++
+
+	if count.n <= sampling.First {
+		return true
+	}
+	return sampling.Thereafter > 0 && (count.n-sampling.First)%sampling.Thereafter == 0
+}
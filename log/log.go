@@ -4,11 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"runtime"
-
-	"github.com/google/uuid"
+	"time"
 )
 
 type LogLevel int
@@ -18,58 +16,75 @@ const (
 	INFO
 	WARN
 	ERROR
+	PANIC
+	FATAL
 )
 
-var level = INFO
-
-func SetLevel(lvl LogLevel) {
-	level = lvl
+func (l LogLevel) String() string {
+	switch l {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	case PANIC:
+		return "PANIC"
+	case FATAL:
+		return "FATAL"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
 }
 
 type F map[string]string
 
-func logln(ctx context.Context, lvl string, loc bool, msg string, fields F) {
-	fn, file, line, _ := runtime.Caller(2)
-	fun := runtime.FuncForPC(fn).Name()
-	if id := GetID(ctx); id != uuid.Nil {
-		log.Printf("[%s] %s: %s %v [%s %s:%d]", id, lvl, msg, fields, fun, file, line)
-	} else {
-		log.Printf("%s: %s %v [%s %s:%d]", lvl, msg, fields, fun, file, line)
+// logln logs a line with the backend, if its level is enabled for the calling
+// package and it isn't sampled out
+func logln(ctx context.Context, lvl LogLevel, msg string, fields F) {
+	pc, file, line, _ := runtime.Caller(2)
+	fun := runtime.FuncForPC(pc).Name()
+	if lvl < levelFor(packageOf(fun)) || !sample(lvl, msg) {
+		return
 	}
+
+	getBackend().Log(ctx, Entry{
+		Time:    time.Now(),
+		Level:   lvl,
+		Message: msg,
+		Fields:  withContextFields(ctx, fields),
+		Caller:  Caller{PC: pc, Func: fun, File: file, Line: line},
+	})
 }
 
 func Debug(ctx context.Context, msg string, fields F) {
-	if level <= DEBUG {
-		logln(ctx, "DEBUG", false, msg, fields)
-	}
+	logln(ctx, DEBUG, msg, fields)
 }
 
 func Info(ctx context.Context, msg string, fields F) {
-	if level <= INFO {
-		logln(ctx, "INFO", false, msg, fields)
-	}
+	logln(ctx, INFO, msg, fields)
 }
 
 func Warn(ctx context.Context, msg string, fields F) {
-	if level <= WARN {
-		logln(ctx, "WARN", true, msg, fields)
-	}
+	logln(ctx, WARN, msg, fields)
 }
 
 func Error(ctx context.Context, msg interface{}, fields F) error {
 	err := interfaceToError(msg, fields)
-	logln(ctx, "ERROR", true, err.Error(), fields)
+	logln(ctx, ERROR, err.Error(), fields)
 	return err
 }
 
 func Fatal(msg string, fields F) {
-	log.Printf("FATAL: %s %v", msg, fields)
+	logln(context.Background(), FATAL, msg, fields)
 	os.Exit(1)
 }
 
 func Panic(ctx context.Context, msg interface{}, fields F) {
 	err := interfaceToError(msg, fields)
-	logln(ctx, "PANIC", true, err.Error(), fields)
+	logln(ctx, PANIC, err.Error(), fields)
 	panic(err)
 }
 
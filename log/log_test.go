@@ -0,0 +1,115 @@
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testKey string
+
+func (k testKey) String() string {
+	return string(k)
+}
+
+var tenantKey = testKey("tenant")
+
+func init() {
+	log.RegisterContextKey(tenantKey)
+}
+
+// useBackend logs to a backend for the rest of the test
+func useBackend(t *testing.T, b log.Backend) {
+	log.SetBackend(b)
+	t.Cleanup(func() {
+		log.SetBackend(log.TextBackend{})
+	})
+}
+
+func TestJSONBackend(t *testing.T) {
+	var out bytes.Buffer
+	useBackend(t, log.NewJSONBackend(&out))
+
+	ctx := context.WithValue(log.WithID(context.Background()), tenantKey, "acme")
+	log.Info(ctx, "renamed user", log.F{"user": "a b", "msg": "ignored"})
+
+	var line map[string]string
+	require.NoError(t, json.Unmarshal(out.Bytes(), &line))
+	assert.Equal(t, "info", line["level"])
+	assert.Equal(t, "renamed user", line["msg"])
+	assert.Equal(t, "a b", line["user"])
+	assert.Equal(t, "acme", line["tenant"])
+	assert.Equal(t, log.GetID(ctx).String(), line["request_id"])
+	assert.Contains(t, line["caller"], "log_test.go:")
+	_, err := time.Parse(time.RFC3339Nano, line["time"])
+	assert.NoError(t, err)
+}
+
+func TestLogfmtBackend(t *testing.T) {
+	var out bytes.Buffer
+	useBackend(t, log.NewLogfmtBackend(&out))
+
+	err := log.Error(context.Background(), "failed", log.F{"reason": `said "no"`, "b": "x=y", "a": "plain"})
+	assert.Error(t, err)
+
+	line := out.String()
+	assert.True(t, strings.HasPrefix(line, "time="), line)
+	assert.Contains(t, line, ` level=error msg="failed: `)
+	assert.Contains(t, line, ` a=plain b="x=y" reason="said \"no\""`+"\n")
+}
+
+func TestPackageLevels(t *testing.T) {
+	var out bytes.Buffer
+	useBackend(t, log.NewLogfmtBackend(&out))
+	log.SetPackageLevel("github.com/GabrielCarpr/cqrs", log.DEBUG)
+	log.SetPackageLevel("github.com/GabrielCarpr/cqrs/log_test", log.WARN)
+	t.Cleanup(func() {
+		log.SetPackageLevel("github.com/GabrielCarpr/cqrs", log.INFO)
+		log.SetPackageLevel("github.com/GabrielCarpr/cqrs/log_test", log.INFO)
+	})
+
+	log.Info(context.Background(), "hidden", log.F{})
+	log.Warn(context.Background(), "shown", log.F{})
+
+	assert.NotContains(t, out.String(), "hidden")
+	assert.Contains(t, out.String(), "shown")
+}
+
+func TestSampling(t *testing.T) {
+	var out bytes.Buffer
+	useBackend(t, log.NewLogfmtBackend(&out))
+	log.SetSampling(log.Sampling{First: 2, Thereafter: 3, Tick: time.Minute})
+	t.Cleanup(func() {
+		log.SetSampling(log.Sampling{})
+	})
+
+	for i := 0; i < 8; i++ {
+		log.Info(context.Background(), "repeated", log.F{})
+		log.Error(context.Background(), "failed", log.F{})
+	}
+
+	assert.Equal(t, 4, strings.Count(out.String(), "msg=repeated"))
+	assert.Equal(t, 8, strings.Count(out.String(), "msg=failed"))
+}
+
+func TestWithAccumulatesFields(t *testing.T) {
+	var out bytes.Buffer
+	useBackend(t, log.NewLogfmtBackend(&out))
+
+	ctx := log.With(context.Background(), log.F{"user_id": "u1", "tenant": "fields"})
+	ctx = log.With(ctx, log.F{"order_id": "o1"})
+	removed := log.With(ctx, log.F{"order_id": ""})
+
+	assert.Equal(t, log.F{"user_id": "u1", "tenant": "fields", "order_id": "o1"}, log.Fields(ctx))
+	assert.Equal(t, log.F{"user_id": "u1", "tenant": "fields"}, log.Fields(removed))
+
+	log.Info(context.WithValue(ctx, tenantKey, "acme"), "placed order", log.F{"order_id": "o2"})
+	assert.Contains(t, out.String(), "order_id=o2 tenant=fields user_id=u1\n")
+}
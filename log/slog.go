@@ -0,0 +1,50 @@
+//go:build go1.21
+// +build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogBackend returns a backend that writes lines with a log/slog handler,
+// with each field as a string attribute
+func NewSlogBackend(h slog.Handler) SlogBackend {
+	return SlogBackend{h}
+}
+
+// SlogBackend writes lines with a log/slog handler
+type SlogBackend struct {
+	handler slog.Handler
+}
+
+func (b SlogBackend) Log(ctx context.Context, e Entry) {
+	lvl := slogLevel(e.Level)
+	if !b.handler.Enabled(ctx, lvl) {
+		return
+	}
+
+	record := slog.NewRecord(e.Time, lvl, e.Message, e.Caller.PC)
+	for _, key := range fieldNames(e.Fields) {
+		record.AddAttrs(slog.String(key, e.Fields[key]))
+	}
+	b.handler.Handle(ctx, record)
+}
+
+// slogLevel returns the slog level of a level. Panics and fatal lines are logged
+// above slog's error level
+func slogLevel(lvl LogLevel) slog.Level {
+	switch lvl {
+	case DEBUG:
+		return slog.LevelDebug
+	case INFO:
+		return slog.LevelInfo
+	case WARN:
+		return slog.LevelWarn
+	case ERROR:
+		return slog.LevelError
+	default:
+		return slog.LevelError + slog.Level(lvl-ERROR)*4
+	}
+}
@@ -0,0 +1,25 @@
+//go:build go1.21
+// +build go1.21
+
+package log_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogBackend(t *testing.T) {
+	var out bytes.Buffer
+	useBackend(t, log.NewSlogBackend(slog.NewTextHandler(&out, &slog.HandlerOptions{AddSource: true})))
+
+	log.Warn(context.WithValue(context.Background(), tenantKey, "acme"), "slow query", log.F{"query": "users"})
+
+	assert.Contains(t, out.String(), "level=WARN")
+	assert.Contains(t, out.String(), `msg="slow query" query=users tenant=acme`)
+	assert.Contains(t, out.String(), "slog_test.go:")
+}
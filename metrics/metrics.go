@@ -0,0 +1,69 @@
+// Package metrics defines the measurements the bus, queue, event store and
+// background jobs record, and the interface they're recorded with. Adapters, such
+// as metrics/prometheus, export them to a monitoring system
+package metrics
+
+const (
+	// HandledTotal counts messages handled, by type, name and handler
+	HandledTotal = "cqrs_handled_total"
+
+	// HandlerErrorsTotal counts handlers that returned an error, by type, name and handler
+	HandlerErrorsTotal = "cqrs_handler_errors_total"
+
+	// HandlerDuration observes how long handlers take, in seconds, by type, name and handler
+	HandlerDuration = "cqrs_handler_duration_seconds"
+
+	// QueueWait observes how long queued messages wait before they're consumed, in
+	// seconds, by message type. Delayed messages are measured from when they're due
+	QueueWait = "cqrs_queue_wait_seconds"
+
+	// QueueDepth is the number of messages waiting in the queue
+	QueueDepth = "cqrs_queue_depth"
+
+	// DeadLetters is the number of messages that failed all of their retries
+	DeadLetters = "cqrs_dead_letters"
+
+	// SubscriptionLag is the number of events a subscription is behind the head of the event log
+	SubscriptionLag = "cqrs_subscription_lag"
+
+	// Jobs is the number of background jobs, by status
+	Jobs = "cqrs_jobs"
+)
+
+// Help describes each metric, for adapters that document their metrics
+var Help = map[string]string{
+	HandledTotal:       "Messages handled, by type, name and handler",
+	HandlerErrorsTotal: "Handlers that returned an error, by type, name and handler",
+	HandlerDuration:    "Handler duration in seconds, by type, name and handler",
+	QueueWait:          "Time queued messages waited before being consumed, in seconds",
+	QueueDepth:         "Messages waiting in the queue",
+	DeadLetters:        "Messages that failed all of their retries",
+	SubscriptionLag:    "Events an event store subscription is behind the head of the log",
+	Jobs:               "Background jobs, by status",
+}
+
+// Labels are the dimensions of a measurement. Each metric is always recorded with the same label names
+type Labels map[string]string
+
+// Metrics records measurements
+type Metrics interface {
+	// Count increments a counter
+	Count(name string, labels Labels)
+
+	// Observe records a value in a histogram
+	Observe(name string, value float64, labels Labels)
+
+	// Gauge sets a gauge's current value
+	Gauge(name string, value float64, labels Labels)
+}
+
+// Nop discards measurements. It's the bus's metrics unless configured otherwise
+var Nop Metrics = nop{}
+
+type nop struct{}
+
+func (nop) Count(string, Labels) {}
+
+func (nop) Observe(string, float64, Labels) {}
+
+func (nop) Gauge(string, float64, Labels) {}
@@ -0,0 +1,108 @@
+// Package prometheus exports metrics to Prometheus
+package prometheus
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/GabrielCarpr/cqrs/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var _ metrics.Metrics = (*Metrics)(nil)
+
+// New returns metrics registered with the registry. Each metric's collector is
+// registered the first time it's recorded, with the label names it's recorded with
+func New(reg *prometheus.Registry) *Metrics {
+	return &Metrics{
+		registry:   reg,
+		counters:   make(map[string]*prometheus.CounterVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+		gauges:     make(map[string]*prometheus.GaugeVec),
+	}
+}
+
+// Metrics records metrics as Prometheus counters, histograms and gauges
+type Metrics struct {
+	registry *prometheus.Registry
+
+	mx         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+	gauges     map[string]*prometheus.GaugeVec
+}
+
+func (m *Metrics) Count(name string, labels metrics.Labels) {
+	m.mx.Lock()
+	vec, ok := m.counters[name]
+	if !ok {
+		vec = prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help(name)}, labelNames(labels))
+		vec = m.register(vec).(*prometheus.CounterVec)
+		m.counters[name] = vec
+	}
+	m.mx.Unlock()
+
+	vec.With(prometheus.Labels(labels)).Inc()
+}
+
+func (m *Metrics) Observe(name string, value float64, labels metrics.Labels) {
+	m.mx.Lock()
+	vec, ok := m.histograms[name]
+	if !ok {
+		vec = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help(name)}, labelNames(labels))
+		vec = m.register(vec).(*prometheus.HistogramVec)
+		m.histograms[name] = vec
+	}
+	m.mx.Unlock()
+
+	vec.With(prometheus.Labels(labels)).Observe(value)
+}
+
+func (m *Metrics) Gauge(name string, value float64, labels metrics.Labels) {
+	m.mx.Lock()
+	vec, ok := m.gauges[name]
+	if !ok {
+		vec = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: help(name)}, labelNames(labels))
+		vec = m.register(vec).(*prometheus.GaugeVec)
+		m.gauges[name] = vec
+	}
+	m.mx.Unlock()
+
+	vec.With(prometheus.Labels(labels)).Set(value)
+}
+
+// Handler serves the registry's metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// register registers a collector, returning the collector already registered
+// under its name if there is one
+func (m *Metrics) register(c prometheus.Collector) prometheus.Collector {
+	err := m.registry.Register(c)
+	if existing, ok := err.(prometheus.AlreadyRegisteredError); ok {
+		return existing.ExistingCollector
+	}
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func help(name string) string {
+	if h, ok := metrics.Help[name]; ok {
+		return h
+	}
+	return name
+}
+
+func labelNames(labels metrics.Labels) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,43 @@
+package prometheus_test
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/metrics"
+	cqrsPrometheus "github.com/GabrielCarpr/cqrs/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServesRecordedMetrics(t *testing.T) {
+	m := cqrsPrometheus.New(prometheus.NewRegistry())
+	labels := metrics.Labels{"type": "command", "name": "rename", "handler": "renameHandler"}
+	m.Count(metrics.HandledTotal, labels)
+	m.Count(metrics.HandledTotal, labels)
+	m.Observe(metrics.HandlerDuration, 0.2, labels)
+	m.Gauge(metrics.QueueDepth, 3, metrics.Labels{})
+	m.Gauge(metrics.QueueDepth, 5, metrics.Labels{})
+
+	res := httptest.NewRecorder()
+	m.Handler().ServeHTTP(res, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "# HELP cqrs_handled_total "+metrics.Help[metrics.HandledTotal])
+	assert.Contains(t, string(body), `cqrs_handled_total{handler="renameHandler",name="rename",type="command"} 2`)
+	assert.Contains(t, string(body), `cqrs_handler_duration_seconds_count{handler="renameHandler",name="rename",type="command"} 1`)
+	assert.Contains(t, string(body), "cqrs_queue_depth 5")
+}
+
+func TestSharesCollectorsRegisteredWithTheRegistry(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	first, second := cqrsPrometheus.New(reg), cqrsPrometheus.New(reg)
+
+	first.Gauge(metrics.DeadLetters, 1, metrics.Labels{})
+	assert.NotPanics(t, func() {
+		second.Gauge(metrics.DeadLetters, 2, metrics.Labels{})
+	})
+}
@@ -0,0 +1,24 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// Error responds with an error returned by the bus. Validation errors respond
+// 422 Unprocessable Entity with each invalid field, other errors.Error respond
+// with their code, and any other error is hidden. Wrapped errors respond with the
+// public error they wrap
+func (s *Server) Error(c *gin.Context, err error) {
+	public, _ := errors.Public(err)
+	switch err := public.(type) {
+	case errors.ValidationError:
+		c.JSON(http.StatusUnprocessableEntity, err)
+	case errors.Error:
+		c.JSON(err.Code, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
+	}
+}
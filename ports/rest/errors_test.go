@@ -0,0 +1,51 @@
+package rest_test
+
+import (
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/GabrielCarpr/cqrs/ports/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := &rest.Server{Router: gin.New()}
+	invalid := errors.NewValidationError()
+	invalid.Add("email", "is required")
+
+	cases := map[string]struct {
+		err    error
+		status int
+		body   map[string]interface{}
+	}{
+		"validation": {invalid, http.StatusUnprocessableEntity, map[string]interface{}{
+			"code": 422.0, "message": "Validation failed", "fields": map[string]interface{}{"email": []interface{}{"is required"}},
+		}},
+		"public": {errors.Error{Code: 404, Message: "Not found"}, http.StatusNotFound, map[string]interface{}{"code": 404.0, "message": "Not found"}},
+		"wrapped": {fmt.Errorf("saving user: %w", errors.Conflict.WithReason("user.email_taken").WithDetails(map[string]string{"email": "a@example.com"}).Wrap(stdErrors.New("duplicate key"))),
+			http.StatusConflict, map[string]interface{}{
+				"code": 409.0, "reason": "user.email_taken", "message": "Conflict", "details": map[string]interface{}{"email": "a@example.com"},
+			}},
+		"internal": {stdErrors.New("secret"), http.StatusInternalServerError, map[string]interface{}{"message": "Something went wrong"}},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resp := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(resp)
+			server.Error(ctx, c.err)
+
+			assert.Equal(t, c.status, resp.Code)
+			var body map[string]interface{}
+			require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			assert.Equal(t, c.body, body)
+		})
+	}
+}
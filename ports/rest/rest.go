@@ -16,11 +16,24 @@ type Config struct {
 	Secret      string
 	URL         string
 	Development bool
+
+	// StatusPath is where the results of asynchronous commands are served, by
+	// ticket, once mounted with Server.Statuses. Defaults to /commands
+	StatusPath string
+
+	// MetricsPath is where a metrics handler is served, once mounted with
+	// Server.Metrics. Defaults to /metrics
+	MetricsPath string
 }
 
 func NewServer(b *bus.Bus, conf Config) *Server {
-	s := &Server{b, gin.Default(), conf}
-	return s
+	if conf.StatusPath == "" {
+		conf.StatusPath = "/commands"
+	}
+	if conf.MetricsPath == "" {
+		conf.MetricsPath = "/metrics"
+	}
+	return &Server{b, gin.Default(), conf}
 }
 
 type Server struct {
@@ -38,6 +51,11 @@ func (s *Server) Map(method string, route string, handler func(*bus.Bus) gin.Han
 	s.Router.Handle(method, route, handlers...)
 }
 
+// Metrics serves a metrics handler, such as the Prometheus adapter's, at the MetricsPath
+func (s *Server) Metrics(h http.Handler) {
+	s.Router.GET(s.Config.MetricsPath, gin.WrapH(h))
+}
+
 func (s *Server) Run(ctx context.Context) error {
 	srv := &http.Server{
 		Addr:    ":80",
@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/auth"
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/gin-gonic/gin"
+)
+
+// maxWait is the longest a status request can wait for a command to finish
+const maxWait = time.Second * 30
+
+// Accepted responds to a dispatched command. Asynchronous commands respond
+// 202 Accepted, with the URL of their result in the Location header, which is
+// served once mounted with Statuses
+func (s *Server) Accepted(c *gin.Context, res *bus.CommandResponse) {
+	if res == nil || res.Ticket == "" {
+		c.JSON(http.StatusOK, res)
+		return
+	}
+
+	c.Header("Location", s.StatusURL(res.Ticket))
+	c.JSON(http.StatusAccepted, res)
+}
+
+// StatusURL returns the URL an asynchronous command's result is served at
+func (s *Server) StatusURL(ticket string) string {
+	return s.Config.URL + path.Join(s.Config.StatusPath, ticket)
+}
+
+// Statuses serves the results of asynchronous commands at the StatusPath, by ticket.
+// Requests go through the server's Auth, and must be authenticated. Middlewares,
+// such as further access checks, run after Auth, and before Status checks the
+// caller dispatched the command
+func (s *Server) Statuses(middlewares ...gin.HandlerFunc) {
+	handlers := append([]gin.HandlerFunc{s.Auth(), authenticated}, middlewares...)
+	s.Router.GET(path.Join(s.Config.StatusPath, ":ticket"), append(handlers, s.Status())...)
+}
+
+// authenticated rejects requests without valid credentials
+func authenticated(c *gin.Context) {
+	if !auth.GetCredentials(c.Request.Context()).Valid() {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized", "code": http.StatusUnauthorized})
+		return
+	}
+	c.Next()
+}
+
+// Status serves the results of asynchronous commands. Pending commands respond 202,
+// and finished commands 200. The wait query parameter, a duration such as 5s,
+// waits for the command to finish before responding. Commands dispatched by anyone
+// but the caller, as identified by bus.ResultOwner, respond 404 like unknown tickets
+func (s *Server) Status() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket := c.Param("ticket")
+		wait, err := time.ParseDuration(c.DefaultQuery("wait", "0s"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid wait duration", "code": http.StatusBadRequest})
+			return
+		}
+		if wait > maxWait {
+			wait = maxWait
+		}
+
+		ctx := c.Request.Context()
+		result, err := s.bus.Result(ctx, ticket)
+		if err == nil && (result.Owner == "" || result.Owner != bus.ResultOwner(ctx)) {
+			err = bus.ErrResultNotFound
+		}
+		if err == nil && wait > 0 && !result.Done() {
+			result, err = s.bus.Await(ctx, ticket, wait)
+		}
+		switch err {
+		case nil, bus.ErrResultTimeout:
+		case bus.ErrResultNotFound, bus.ErrNoResultStore:
+			c.JSON(http.StatusNotFound, errors.Error{Code: http.StatusNotFound, Message: "Command not found"})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Something went wrong"})
+			return
+		}
+
+		if !result.Done() {
+			c.JSON(http.StatusAccepted, result)
+			return
+		}
+		if result.Status == bus.CommandFailed && result.Code == 0 {
+			result.Error = "Something went wrong"
+		}
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,130 @@
+package rest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/auth"
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/bus/message"
+	queueMemory "github.com/GabrielCarpr/cqrs/bus/queue/memory"
+	resultMemory "github.com/GabrielCarpr/cqrs/bus/result/memory"
+	"github.com/GabrielCarpr/cqrs/ports/rest"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sarulabs/di/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type asyncCmd struct {
+	bus.CommandType
+}
+
+func (asyncCmd) Command() string {
+	return "async"
+}
+
+func (asyncCmd) Valid() error {
+	return nil
+}
+
+type asyncHandler struct{}
+
+func (asyncHandler) Execute(ctx context.Context, c bus.Command) (bus.CommandResponse, []message.Message) {
+	return bus.CommandResponse{ID: "done"}, nil
+}
+
+func TestAsyncCommandStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	module := bus.FuncModule{
+		CommandsFunc: func(b bus.CmdBuilder) {
+			b.Command(asyncCmd{}).Handled(asyncHandler{})
+		},
+		Defs: []bus.Def{{
+			Name: asyncHandler{},
+			Build: func(ctn di.Container) (interface{}, error) {
+				return asyncHandler{}, nil
+			},
+		}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	b := bus.Default(
+		ctx,
+		[]bus.Module{module},
+		bus.UseQueue(queueMemory.NewMemoryQueue(queueMemory.Config{})),
+		bus.UseResultStore(&resultMemory.MemoryResultStore{}, time.Hour),
+	)
+	server := rest.NewServer(b, rest.Config{URL: "http://api.test", Secret: "secret"})
+	server.Statuses()
+	token, err := auth.CreateAccessToken(auth.Credentials{ID: uuid.New()}, "secret")
+	require.NoError(t, err)
+	other, err := auth.CreateAccessToken(auth.Credentials{ID: uuid.New()}, "secret")
+	require.NoError(t, err)
+	request := func(method, url, token string) *http.Request {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req
+	}
+	get := func(url string) *http.Request {
+		return request("GET", url, token)
+	}
+	server.Router.POST("/async", server.Auth(), func(c *gin.Context) {
+		res, err := b.Dispatch(c.Request.Context(), asyncCmd{}, false)
+		require.NoError(t, err)
+		server.Accepted(c, res)
+	})
+
+	resp := httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, request("POST", "/async", token))
+	require.Equal(t, http.StatusAccepted, resp.Code)
+	location := resp.Header().Get("Location")
+	require.Contains(t, location, "http://api.test/commands/")
+	status := location[len("http://api.test"):]
+
+	resp = httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, httptest.NewRequest("GET", status, nil))
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	resp = httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, get(status))
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	resp = httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, request("GET", status, other))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.Run()
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	resp = httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, get(status+"?wait=1s"))
+	require.Equal(t, http.StatusOK, resp.Code)
+	var result bus.CommandResult
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &result))
+	assert.Equal(t, bus.CommandSucceeded, result.Status)
+	assert.Equal(t, "done", result.ID)
+
+	resp = httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, request("GET", status, other))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, get("/commands/missing"))
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	resp = httptest.NewRecorder()
+	server.Router.ServeHTTP(resp, get(status+"?wait=soon"))
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
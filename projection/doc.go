@@ -0,0 +1,2 @@
+// Package projection maintains rebuildable read models from the event store
+package projection
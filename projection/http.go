@@ -0,0 +1,47 @@
+package projection
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Handler returns an admin HTTP handler for the runner's projections.
+// GET / lists each projection's status, and POST /{name}/rebuild rebuilds a projection.
+// Mount it with http.StripPrefix, or gin.WrapH on a ports/rest Server
+func (r *Runner) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := strings.Trim(req.URL.Path, "/")
+
+		switch {
+		case req.Method == http.MethodGet && path == "":
+			statuses, err := r.Status(req.Context())
+			if err != nil {
+				writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "Internal server error", "code": 500})
+				return
+			}
+			writeJSON(w, http.StatusOK, statuses)
+
+		case req.Method == http.MethodPost && strings.HasSuffix(path, "/rebuild"):
+			name := strings.TrimSuffix(path, "/rebuild")
+			err := r.Rebuild(req.Context(), name)
+			switch err {
+			case nil:
+				writeJSON(w, http.StatusAccepted, map[string]interface{}{"name": name})
+			case ErrUnknownProjection:
+				writeJSON(w, http.StatusNotFound, map[string]interface{}{"message": "Projection not found", "code": 404})
+			default:
+				writeJSON(w, http.StatusInternalServerError, map[string]interface{}{"message": "Internal server error", "code": 500})
+			}
+
+		default:
+			writeJSON(w, http.StatusNotFound, map[string]interface{}{"message": "Not found", "code": 404})
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
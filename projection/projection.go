@@ -0,0 +1,220 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/log"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	// ErrUnknownProjection is returned when a projection is not registered with the runner
+	ErrUnknownProjection = errors.New("cqrs.projection: unknown projection")
+
+	// errRebuilding stops a projection handling events while it's being rebuilt
+	errRebuilding = errors.New("cqrs.projection: projection is rebuilding")
+)
+
+// Projection builds a read model from the event log
+type Projection interface {
+	// Name uniquely identifies the projection, and names its event store subscription
+	Name() string
+
+	// Events returns the events the projection handles
+	Events() []bus.Event
+
+	// Handle applies an event to the read model
+	Handle(context.Context, bus.Event) error
+
+	// Reset clears the read model, before it's rebuilt from the start of the log
+	Reset(context.Context) error
+}
+
+// Store is the subset of bus.EventStore required to run projections
+type Store interface {
+	bus.Subscribable
+	bus.Checkpointable
+}
+
+// Status reports the progress of a projection
+type Status struct {
+	Name string `json:"name"`
+	Lag  int64  `json:"lag"`
+}
+
+var _ bus.Plugin = (*Runner)(nil)
+
+// NewRunner returns a runner for a set of projections
+func NewRunner(store Store, projections ...Projection) *Runner {
+	r := &Runner{store: store, projections: make(map[string]*projected), closing: make(chan struct{})}
+	for _, p := range projections {
+		if _, exists := r.projections[p.Name()]; exists {
+			panic(fmt.Sprint("Cannot register projection twice: ", p.Name()))
+		}
+		r.names = append(r.names, p.Name())
+		r.projections[p.Name()] = newProjected(p)
+	}
+	return r
+}
+
+// Runner runs projections as a bus plugin, each with its own subscription
+type Runner struct {
+	store       Store
+	names       []string
+	projections map[string]*projected
+
+	closing chan struct{}
+	closed  sync.Once
+}
+
+// Register implements bus.Plugin
+func (r *Runner) Register(b *bus.Bus) error {
+	return nil
+}
+
+// Run runs every projection, blocking until the context cancels
+func (r *Runner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-r.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	group, groupCtx := errgroup.WithContext(ctx)
+	for _, name := range r.names {
+		p := r.projections[name]
+		group.Go(func() error {
+			return r.run(groupCtx, p)
+		})
+	}
+	return group.Wait()
+}
+
+// run subscribes a projection to the event store, resubscribing after failures
+func (r *Runner) run(ctx context.Context, p *projected) error {
+	for {
+		err := r.store.Subscribe(ctx, p.Name(), p.handle)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Warn(ctx, "projection subscription failed, resubscribing", log.F{"projection": p.Name(), "error": err.Error()})
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Close implements bus.Plugin
+func (r *Runner) Close() error {
+	r.closed.Do(func() {
+		close(r.closing)
+	})
+	return nil
+}
+
+// Rebuild clears a projection's read model and replays the event log into it
+// from the start. The replay is performed by the running projection
+func (r *Runner) Rebuild(ctx context.Context, name string) error {
+	p, ok := r.projections[name]
+	if !ok {
+		return ErrUnknownProjection
+	}
+
+	p.pause()
+	defer p.resume()
+
+	log.Info(ctx, "rebuilding projection", log.F{"projection": name})
+	err := p.Reset(ctx)
+	if err != nil {
+		return err
+	}
+	return r.store.ResetSubscription(ctx, name)
+}
+
+// Lag returns the number of events a projection is behind the head of the log
+func (r *Runner) Lag(ctx context.Context, name string) (int64, error) {
+	if _, ok := r.projections[name]; !ok {
+		return 0, ErrUnknownProjection
+	}
+	return r.store.SubscriptionLag(ctx, name)
+}
+
+// Status reports the progress of every projection
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	statuses := make([]Status, len(r.names))
+	for i, name := range r.names {
+		lag, err := r.Lag(ctx, name)
+		if err != nil {
+			return statuses, err
+		}
+		statuses[i] = Status{Name: name, Lag: lag}
+	}
+	return statuses, nil
+}
+
+func newProjected(p Projection) *projected {
+	events := make(map[string]struct{})
+	for _, e := range p.Events() {
+		events[e.Event()] = struct{}{}
+	}
+	return &projected{Projection: p, events: events}
+}
+
+// projected is a running projection, which can be paused for rebuilding
+type projected struct {
+	Projection
+
+	events map[string]struct{}
+
+	mx         sync.Mutex
+	rebuilding bool
+	inflight   sync.WaitGroup
+}
+
+// handle passes the projection events it handles. Whilst paused, events are
+// rejected rather than blocking, so the store releases the subscription's checkpoint
+func (p *projected) handle(e bus.Event) error {
+	if _, ok := p.events[e.Event()]; !ok {
+		return nil
+	}
+
+	p.mx.Lock()
+	if p.rebuilding {
+		p.mx.Unlock()
+		return errRebuilding
+	}
+	p.inflight.Add(1)
+	p.mx.Unlock()
+	defer p.inflight.Done()
+
+	return p.Handle(context.Background(), e)
+}
+
+// pause stops the projection handling events, waiting for in-flight events to finish
+func (p *projected) pause() {
+	p.mx.Lock()
+	p.rebuilding = true
+	p.mx.Unlock()
+
+	p.inflight.Wait()
+}
+
+func (p *projected) resume() {
+	p.mx.Lock()
+	p.rebuilding = false
+	p.mx.Unlock()
+}
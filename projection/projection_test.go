@@ -0,0 +1,164 @@
+package projection_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GabrielCarpr/cqrs/bus"
+	"github.com/GabrielCarpr/cqrs/eventstore/memory"
+	"github.com/GabrielCarpr/cqrs/log"
+	"github.com/GabrielCarpr/cqrs/projection"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/suite"
+)
+
+type userRegistered struct {
+	bus.EventType
+
+	Email string
+}
+
+func (userRegistered) Event() string {
+	return "user.registered"
+}
+
+type userRenamed struct {
+	bus.EventType
+}
+
+func (userRenamed) Event() string {
+	return "user.renamed"
+}
+
+type emailsProjection struct {
+	mx     sync.Mutex
+	emails []string
+	resets int
+}
+
+func (*emailsProjection) Name() string {
+	return "emails"
+}
+
+func (*emailsProjection) Events() []bus.Event {
+	return []bus.Event{&userRegistered{}}
+}
+
+func (p *emailsProjection) Handle(ctx context.Context, e bus.Event) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.emails = append(p.emails, e.(*userRegistered).Email)
+	return nil
+}
+
+func (p *emailsProjection) Reset(ctx context.Context) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	p.emails = nil
+	p.resets++
+	return nil
+}
+
+func (p *emailsProjection) Emails() []string {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return append([]string{}, p.emails...)
+}
+
+func TestProjection(t *testing.T) {
+	suite.Run(t, new(ProjectionTest))
+}
+
+type ProjectionTest struct {
+	suite.Suite
+
+	store      *memory.MemoryEventStore
+	projection *emailsProjection
+	runner     *projection.Runner
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+func (s *ProjectionTest) SetupTest() {
+	log.SetLevel(log.WARN)
+	s.store = &memory.MemoryEventStore{}
+	s.projection = &emailsProjection{}
+	s.runner = projection.NewRunner(s.store, s.projection)
+
+	for _, email := range []string{"a@example.com", "b@example.com"} {
+		buffer := bus.NewEventBuffer(uuid.New(), "user")
+		buffer.Buffer(true, &userRegistered{Email: email}, &userRenamed{})
+		s.Require().NoError(s.store.Append(context.Background(), bus.ExpectedVersion(0), buffer.Events(context.Background())...))
+	}
+
+	s.ctx, s.cancel = context.WithTimeout(context.Background(), time.Second*3)
+	go s.runner.Run(s.ctx)
+}
+
+func (s *ProjectionTest) TearDownTest() {
+	s.cancel()
+	s.runner.Close()
+}
+
+func (s *ProjectionTest) waitForLag(lag int64) {
+	s.Require().Eventually(func() bool {
+		current, err := s.runner.Lag(s.ctx, "emails")
+		s.Require().NoError(err)
+		return current == lag
+	}, time.Second, time.Millisecond*10)
+}
+
+func (s *ProjectionTest) TestProjectsHandledEvents() {
+	s.waitForLag(0)
+
+	s.Equal([]string{"a@example.com", "b@example.com"}, s.projection.Emails())
+}
+
+func (s *ProjectionTest) TestRebuilds() {
+	s.waitForLag(0)
+
+	err := s.runner.Rebuild(s.ctx, "emails")
+	s.Require().NoError(err)
+	s.waitForLag(0)
+
+	s.Equal(1, s.projection.resets)
+	s.Equal([]string{"a@example.com", "b@example.com"}, s.projection.Emails())
+}
+
+func (s *ProjectionTest) TestUnknownProjection() {
+	s.Equal(projection.ErrUnknownProjection, s.runner.Rebuild(s.ctx, "unknown"))
+
+	_, err := s.runner.Lag(s.ctx, "unknown")
+	s.Equal(projection.ErrUnknownProjection, err)
+}
+
+func (s *ProjectionTest) TestHandlerReportsStatus() {
+	s.waitForLag(0)
+
+	resp := httptest.NewRecorder()
+	s.runner.Handler().ServeHTTP(resp, httptest.NewRequest("GET", "/", nil))
+	s.Require().Equal(http.StatusOK, resp.Code)
+
+	var statuses []projection.Status
+	s.Require().NoError(json.Unmarshal(resp.Body.Bytes(), &statuses))
+	s.Equal([]projection.Status{{Name: "emails", Lag: 0}}, statuses)
+}
+
+func (s *ProjectionTest) TestHandlerRebuilds() {
+	s.waitForLag(0)
+
+	resp := httptest.NewRecorder()
+	s.runner.Handler().ServeHTTP(resp, httptest.NewRequest("POST", "/emails/rebuild", nil))
+	s.Equal(http.StatusAccepted, resp.Code)
+	s.waitForLag(0)
+	s.Equal(1, s.projection.resets)
+
+	resp = httptest.NewRecorder()
+	s.runner.Handler().ServeHTTP(resp, httptest.NewRequest("POST", "/unknown/rebuild", nil))
+	s.Equal(http.StatusNotFound, resp.Code)
+}
@@ -0,0 +1,112 @@
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	RegisterRule("required", required)
+	RegisterRule("email", email)
+	RegisterRule("url", validURL)
+	RegisterRule("uuid", validUUID)
+	RegisterRule("min", minimum)
+	RegisterRule("max", maximum)
+	RegisterRule("len", length)
+	RegisterRule("oneof", oneOf)
+}
+
+// numberRules are the rules whose parameter is a number
+var numberRules = map[string]bool{"min": true, "max": true, "len": true}
+
+func required(v reflect.Value, _ string) string {
+	if isEmpty(v) {
+		return "is required"
+	}
+	return ""
+}
+
+func email(v reflect.Value, _ string) string {
+	addr, err := mail.ParseAddress(v.String())
+	if v.Kind() != reflect.String || err != nil || addr.Address != v.String() {
+		return "must be an email address"
+	}
+	return ""
+}
+
+func validURL(v reflect.Value, _ string) string {
+	u, err := url.ParseRequestURI(v.String())
+	if v.Kind() != reflect.String || err != nil || u.Scheme == "" || u.Host == "" {
+		return "must be a URL"
+	}
+	return ""
+}
+
+func validUUID(v reflect.Value, _ string) string {
+	if _, err := uuid.Parse(v.String()); v.Kind() != reflect.String || err != nil {
+		return "must be a UUID"
+	}
+	return ""
+}
+
+func minimum(v reflect.Value, param string) string {
+	return compare(v, param, func(size, limit float64) bool { return size >= limit }, "at least")
+}
+
+func maximum(v reflect.Value, param string) string {
+	return compare(v, param, func(size, limit float64) bool { return size <= limit }, "at most")
+}
+
+func length(v reflect.Value, param string) string {
+	return compare(v, param, func(size, limit float64) bool { return size == limit }, "exactly")
+}
+
+// compare checks the length of a string, slice or map, in characters or items,
+// or the value of a number, against the rule's parameter, which is checked to be
+// a number when the tag is parsed
+func compare(v reflect.Value, param string, ok func(size, limit float64) bool, relation string) string {
+	limit, _ := strconv.ParseFloat(param, 64)
+
+	var size float64
+	var unit string
+	switch v.Kind() {
+	case reflect.String:
+		size, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		size, unit = float64(v.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		size = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		size = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		size = v.Float()
+	default:
+		return ""
+	}
+
+	if ok(size, limit) {
+		return ""
+	}
+	if unit != "" {
+		return fmt.Sprintf("must have %s %s%s", relation, param, unit)
+	}
+	return fmt.Sprintf("must be %s %s", relation, param)
+}
+
+// oneOf checks the value is one of the parameter's space separated options
+func oneOf(v reflect.Value, param string) string {
+	value := fmt.Sprint(v)
+	for _, option := range strings.Fields(param) {
+		if value == option {
+			return ""
+		}
+	}
+	return "must be one of " + strings.Join(strings.Fields(param), ", ")
+}
@@ -0,0 +1,230 @@
+// Package validate validates commands and queries with the rules in their cqrs struct tags.
+//
+// Rules follow the field's name and any other options, after validate=, and are
+// comma separated, so validate must be the tag's last option:
+//
+//	Email string `cqrs:"email,validate=required,email,max=256"`
+//
+// Fields are reported by their tag name, or their Go name if the tag has none.
+// Nested structs are validated too, with their fields reported as parent.child,
+// and embedded structs' fields are reported as the parent's own. Rules other than
+// required aren't checked on empty fields, so optional fields are only checked
+// when they're set
+package validate
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/GabrielCarpr/cqrs/errors"
+)
+
+// ErrInvalidTag indicates a tag uses a rule that isn't registered, or a number
+// rule such as min with a parameter that isn't a number
+var ErrInvalidTag = stdErrors.New("cqrs.validate: invalid validate tag")
+
+// Rule checks a field's value, with the rule's parameter, the text after = in
+// the tag, if it has one. It returns the problem with the value, or an empty string
+type Rule func(v reflect.Value, param string) string
+
+var (
+	rules   = make(map[string]Rule)
+	rulesMx sync.RWMutex
+)
+
+// RegisterRule registers a rule used in validate tags. Registering a rule with the
+// name of an existing rule replaces it. Rules must be registered before a struct
+// using them is first validated
+func RegisterRule(name string, rule Rule) {
+	rulesMx.Lock()
+	defer rulesMx.Unlock()
+
+	rules[name] = rule
+}
+
+func getRule(name string) (Rule, bool) {
+	rulesMx.RLock()
+	defer rulesMx.RUnlock()
+
+	rule, ok := rules[name]
+	return rule, ok
+}
+
+// Struct validates a struct, or a pointer to one, with the rules in its tags. It
+// returns an errors.ValidationError with each invalid field, or nil. If a tag is
+// invalid, it returns ErrInvalidTag instead
+func Struct(v interface{}) error {
+	result := errors.NewValidationError()
+	if err := validateStruct(reflect.ValueOf(v), "", result); err != nil {
+		return err
+	}
+	return result.Err()
+}
+
+// validateStruct validates a struct's fields, recording problems under the prefix
+func validateStruct(v reflect.Value, prefix string, result errors.ValidationError) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+
+	fields, err := fieldsOf(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		value := v.FieldByIndex(f.index)
+		name := prefix + f.name
+		for _, c := range f.checks {
+			target := indirect(value)
+			if c.name == "required" {
+				// A set pointer is present, even if it points to a zero value
+				target = value
+			} else if isEmpty(value) {
+				continue
+			}
+			if problem := c.rule(target, c.param); problem != "" {
+				result.Add(name, problem)
+			}
+		}
+
+		if f.nested {
+			nestedPrefix := name + "."
+			if f.embedded {
+				nestedPrefix = prefix
+			}
+			if err := validateStruct(value, nestedPrefix, result); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// field is a struct field's validation rules
+type field struct {
+	index    []int
+	name     string
+	checks   []check
+	nested   bool
+	embedded bool
+}
+
+// check is a rule applied to a field
+type check struct {
+	name  string
+	param string
+	rule  Rule
+}
+
+// parsed is a struct type's validated fields, or the error parsing its tags
+type parsed struct {
+	fields []field
+	err    error
+}
+
+var fieldCache sync.Map
+
+// fieldsOf returns the validated fields of a struct type. Types whose tags fail
+// to parse are cached too, so they aren't parsed on every validation
+func fieldsOf(t reflect.Type) ([]field, error) {
+	if cached, ok := fieldCache.Load(t); ok {
+		return cached.(parsed).fields, cached.(parsed).err
+	}
+
+	fields, err := parseFields(t)
+	fieldCache.Store(t, parsed{fields, err})
+	return fields, err
+}
+
+// parseFields parses the tags of a struct type's fields
+func parseFields(t reflect.Type) ([]field, error) {
+	fields := make([]field, 0)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+
+		name, checks, err := parseTag(t, sf)
+		if err != nil {
+			return nil, err
+		}
+		inner := sf.Type
+		for inner.Kind() == reflect.Ptr {
+			inner = inner.Elem()
+		}
+		nested := inner.Kind() == reflect.Struct
+		if len(checks) == 0 && !nested {
+			continue
+		}
+
+		fields = append(fields, field{
+			index:    sf.Index,
+			name:     name,
+			checks:   checks,
+			nested:   nested,
+			embedded: sf.Anonymous,
+		})
+	}
+	return fields, nil
+}
+
+// parseTag returns a field's reported name, and the checks in its tag
+func parseTag(t reflect.Type, sf reflect.StructField) (string, []check, error) {
+	parts := strings.Split(sf.Tag.Get("cqrs"), ",")
+	name := parts[0]
+	if name == "" {
+		name = sf.Name
+	}
+
+	checks := make([]check, 0)
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "validate=") {
+			continue
+		}
+
+		specs := append([]string{strings.TrimPrefix(part, "validate=")}, parts[i+1:]...)
+		for _, spec := range specs {
+			ruleName, param := spec, ""
+			if eq := strings.Index(spec, "="); eq >= 0 {
+				ruleName, param = spec[:eq], spec[eq+1:]
+			}
+			rule, ok := getRule(ruleName)
+			if !ok {
+				return "", nil, fmt.Errorf("%w: unknown rule %q on %s.%s", ErrInvalidTag, ruleName, t, sf.Name)
+			}
+			if _, err := strconv.ParseFloat(param, 64); numberRules[ruleName] && err != nil {
+				return "", nil, fmt.Errorf("%w: %s=%q on %s.%s isn't a number", ErrInvalidTag, ruleName, param, t, sf.Name)
+			}
+			checks = append(checks, check{ruleName, param, rule})
+		}
+		break
+	}
+	return name, checks, nil
+}
+
+// isEmpty returns whether a value is its type's zero value, or a nil pointer
+func isEmpty(v reflect.Value) bool {
+	return !v.IsValid() || v.IsZero()
+}
+
+// indirect dereferences a pointer, returning the zero Value if it's nil
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
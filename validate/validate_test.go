@@ -0,0 +1,117 @@
+package validate_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GabrielCarpr/cqrs/errors"
+	"github.com/GabrielCarpr/cqrs/validate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Paging struct {
+	Page int `cqrs:"page,validate=min=1"`
+}
+
+type address struct {
+	Postcode string `cqrs:"postcode,validate=required,max=8"`
+}
+
+type register struct {
+	Paging
+
+	Email    string   `cqrs:"email,validate=required,email,max=256"`
+	Name     string   `cqrs:"name,validate=min=2"`
+	Website  string   `cqrs:"website,validate=url"`
+	ID       string   `cqrs:"id,validate=uuid"`
+	Role     string   `cqrs:"role,validate=oneof=admin member"`
+	Tags     []string `cqrs:"tags,validate=max=2"`
+	Age      *int     `cqrs:"age,validate=required,min=18"`
+	Address  address  `cqrs:"address"`
+	Nickname string
+}
+
+func TestValidStruct(t *testing.T) {
+	age := 30
+	err := validate.Struct(register{
+		Paging:  Paging{Page: 1},
+		Email:   "gabriel@example.com",
+		Website: "https://example.com",
+		ID:      "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+		Role:    "admin",
+		Age:     &age,
+		Address: address{Postcode: "SW1A 1AA"},
+	})
+	assert.NoError(t, err)
+}
+
+func TestInvalidFieldsAreAggregated(t *testing.T) {
+	age := 12
+	err := validate.Struct(&register{
+		Paging:  Paging{Page: -1},
+		Email:   "not an email",
+		Name:    "G",
+		Website: "example.com",
+		ID:      "123",
+		Role:    "owner",
+		Tags:    []string{"a", "b", "c"},
+		Age:     &age,
+	})
+
+	var validation errors.ValidationError
+	require.IsType(t, validation, err)
+	validation = err.(errors.ValidationError)
+	assert.Equal(t, 422, validation.Code)
+	assert.Equal(t, map[string][]string{
+		"page":             {"must be at least 1"},
+		"email":            {"must be an email address"},
+		"name":             {"must have at least 2 characters"},
+		"website":          {"must be a URL"},
+		"id":               {"must be a UUID"},
+		"role":             {"must be one of admin, member"},
+		"tags":             {"must have at most 2 items"},
+		"age":              {"must be at least 18"},
+		"address.postcode": {"is required"},
+	}, validation.Fields)
+}
+
+func TestRequiredFields(t *testing.T) {
+	err := validate.Struct(register{Address: address{Postcode: "SW1A 1AA"}})
+
+	require.Error(t, err)
+	assert.Equal(t, map[string][]string{
+		"email": {"is required"},
+		"age":   {"is required"},
+	}, err.(errors.ValidationError).Fields)
+	assert.Equal(t, "Validation failed: age is required; email is required", err.Error())
+}
+
+type custom struct {
+	Code string `cqrs:"code,validate=upper"`
+}
+
+type unknownRule struct {
+	Code string `cqrs:"code,validate=shouting"`
+}
+
+type badParam struct {
+	Code string `cqrs:"code,validate=max=ten"`
+}
+
+func TestRegisterRule(t *testing.T) {
+	validate.RegisterRule("upper", func(v reflect.Value, _ string) string {
+		if v.String() != "ABC" {
+			return "must be ABC"
+		}
+		return ""
+	})
+
+	assert.NoError(t, validate.Struct(custom{Code: "ABC"}))
+	assert.Error(t, validate.Struct(custom{Code: "abc"}))
+
+	err := validate.Struct(unknownRule{})
+	assert.ErrorIs(t, err, validate.ErrInvalidTag)
+	assert.ErrorIs(t, validate.Struct(&unknownRule{Code: "ABC"}), validate.ErrInvalidTag)
+	assert.ErrorIs(t, validate.Struct(badParam{Code: "ABC"}), validate.ErrInvalidTag)
+}